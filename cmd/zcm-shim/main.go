@@ -0,0 +1,14 @@
+package main
+
+import (
+	"simpleconman/runtime"
+	"simpleconman/runtime/runc"
+)
+
+// zcm-shim is started by the manager for each container to create it with
+// runc and to stay with it: the shim writes the container output to the log,
+// serves the attach socket and the RPC of the container, and records its
+// exit.
+func main() {
+	runtime.Run(runc.New())
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"flag"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"simpleconman/pkg/cri"
+	"simpleconman/pkg/network"
+	shim "simpleconman/runtime"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+	"google.golang.org/grpc"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+// shutdownTimeout is how long the in-flight calls can take on shutdown
+const shutdownTimeout = 10 * time.Second
+
+var (
+	listen   string
+	logLevel string
+
+	pauseCommand string
+	cniBinDirs   string
+
+	cfg cri.Config
+)
+
+func parseFlags() {
+	flag.StringVar(&listen, "listen", "/run/zcm/zcm.sock", "path to unix socket to serve CRI")
+	flag.StringVar(&logLevel, "log-level", "info", "log level")
+	flag.StringVar(&cfg.RootDir, "root", "/var/lib/zcm", "path to dir to store containers and sandboxes")
+	flag.StringVar(&cfg.RootfsDir, "rootfs", "/var/lib/zcm-rootfs", "path to rootfs dir copied into every container")
+	flag.StringVar(&cfg.RunDir, "run-dir", "/run/zcm", "path to dir to store runtime files")
+	flag.StringVar(&cfg.LogDir, "log-dir", "/var/log/zcm", "path to dir to store container logs")
+	flag.StringVar(&cfg.ShimPath, "shim", "zcm-shim", "path to zcm-shim binary")
+	flag.StringVar(&cfg.RuncPath, "runc", "runc", "path to runc binary")
+	flag.StringVar(&cfg.RuncRoot, "runc-root", "/run/zcm/runc", "path to runc state dir")
+	flag.DurationVar(&cfg.Timeout, "timeout", 10*time.Second, "timeout of runc and shim calls")
+	flag.IntVar(&cfg.LogMaxLineSize, "log-max-line-size", shim.DefaultMaxLineSize, "max size of container log line, longer line is split")
+	flag.StringVar(&cfg.LogSync, "log-sync", string(shim.SyncNone), "when container log is synced to disk, none, line or periodic")
+	flag.Int64Var(&cfg.LogMaxSize, "log-max-size", 0, "size in bytes container log is rotated over, 0 to leave it to kubelet")
+	flag.IntVar(&cfg.LogMaxFiles, "log-max-files", 5, "number of rotated container log files to keep")
+	flag.StringVar(&cfg.CgroupDriver, "cgroup-driver", "cgroupfs", "cgroup driver, cgroupfs or systemd")
+	flag.StringVar(&cfg.SeccompProfileRoot, "seccomp-profile-root", "/var/lib/kubelet/seccomp", "path to dir of localhost seccomp profiles")
+	flag.StringVar(&pauseCommand, "pause-command", "/pause", "command of pause container separated by space")
+	flag.StringVar(&cfg.CNIConfDir, "cni-conf-dir", network.DefaultConfDir, "path to dir of CNI configs, empty to disable network")
+	flag.StringVar(&cniBinDirs, "cni-bin-dir", network.DefaultBinDir, "paths to dirs of CNI plugins separated by colon")
+	flag.StringVar(&cfg.StreamAddr, "stream-addr", cri.DefaultStreamAddr, "address of streaming server for exec, attach and port-forward")
+	flag.Parse()
+
+	cfg.PauseCommand = strings.Fields(pauseCommand)
+	cfg.CNIBinDirs = filepath.SplitList(cniBinDirs)
+}
+
+func main() {
+	parseFlags()
+	if err := run(); err != nil {
+		logrus.WithError(err).Fatal("zcm exited")
+	}
+}
+
+func run() error {
+	level, err := logrus.ParseLevel(logLevel)
+	if err != nil {
+		return err
+	}
+	logrus.SetLevel(level)
+
+	service, err := cri.NewRuntimeService(cfg)
+	if err != nil {
+		return err
+	}
+
+	l, err := listenUnix(listen)
+	if err != nil {
+		return err
+	}
+	server := grpc.NewServer()
+	runtimeapi.RegisterRuntimeServiceServer(server, service)
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, unix.SIGINT, unix.SIGTERM)
+	errChan := make(chan error, 1)
+	go func() {
+		logrus.WithField("socket", listen).Info("serving CRI on socket")
+		errChan <- server.Serve(l)
+	}()
+
+	select {
+	case err := <-errChan:
+		return err
+	case sig := <-sigChan:
+		logrus.Infof("received %s, shutting down", sig)
+	}
+	shutdown(server)
+	return nil
+}
+
+// listenUnix listens on the socket. Socket left by the previous run is
+// removed.
+func listenUnix(socket string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(socket), 0700); err != nil {
+		return nil, errors.Wrap(err, "cannot create socket dir")
+	}
+	if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "cannot remove stale socket")
+	}
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot listen on socket")
+	}
+	if err := os.Chmod(socket, 0600); err != nil {
+		l.Close()
+		return nil, errors.Wrap(err, "cannot change mode of socket")
+	}
+	return l, nil
+}
+
+// shutdown waits for the in-flight calls to finish, and stops the server
+// forcibly once shutdownTimeout has passed.
+func shutdown(server *grpc.Server) {
+	done := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(shutdownTimeout):
+		logrus.Warn("graceful shutdown timed out, stop forcibly")
+		server.Stop()
+	}
+}
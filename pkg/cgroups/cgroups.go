@@ -0,0 +1,162 @@
+package cgroups
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+const mountpoint = "/sys/fs/cgroup"
+
+type Cgroup interface {
+	// OOMKilled reports whether any process in the cgroup was killed by
+	// the OOM killer.
+	OOMKilled() (bool, error)
+	Stats() (*Stats, error)
+}
+
+type Stats struct {
+	// CPUUsage is cumulative CPU time consumed in nanoseconds
+	CPUUsage uint64
+
+	MemoryUsage uint64
+	// MemoryWorkingSet is the memory usage except inactive file cache, which
+	// can be reclaimed under memory pressure.
+	MemoryWorkingSet uint64
+	MemoryRSS        uint64
+	PageFaults       uint64
+	MajorPageFaults  uint64
+}
+
+func workingSet(usage, inactiveFile uint64) uint64 {
+	if inactiveFile > usage {
+		return 0
+	}
+	return usage - inactiveFile
+}
+
+// Load returns the cgroup at path relative to the hierarchy root.
+func Load(path string) Cgroup {
+	return LoadPaths(path, nil)
+}
+
+// LoadPaths returns the cgroup at path relative to the hierarchy root, except
+// the controllers in paths on cgroup v1, whose hierarchies have the cgroup at
+// paths of their own.
+func LoadPaths(path string, paths map[string]string) Cgroup {
+	if IsUnified() {
+		return &unifiedCgroup{dir: filepath.Join(mountpoint, path)}
+	}
+	return &legacyCgroup{root: mountpoint, path: path, paths: paths}
+}
+
+// IsUnified reports whether the host runs the cgroup v2 unified hierarchy.
+func IsUnified() bool {
+	var st unix.Statfs_t
+	if err := unix.Statfs(mountpoint, &st); err != nil {
+		return false
+	}
+	return st.Type == unix.CGROUP2_SUPER_MAGIC
+}
+
+// PidPath returns the cgroup path of the process relative to the hierarchy
+// root. On cgroup v1 the path of the memory controller is returned, with the
+// paths of every controller, which can differ by hierarchy.
+func PidPath(pid int) (string, map[string]string, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return "", nil, errors.Wrap(err, "cannot open cgroup file of process")
+	}
+	defer f.Close()
+
+	paths, err := parseCgroupFile(f)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "cannot read cgroup file of process")
+	}
+	if IsUnified() {
+		if path, ok := paths[""]; ok {
+			return path, nil, nil
+		}
+	} else if path, ok := paths["memory"]; ok {
+		return path, paths, nil
+	}
+	return "", nil, errors.Errorf("cannot find cgroup of process [%d]", pid)
+}
+
+// parseCgroupFile reads /proc/<pid>/cgroup for the paths by controller. The
+// path on the unified hierarchy is by the empty controller.
+func parseCgroupFile(r io.Reader) (map[string]string, error) {
+	paths := make(map[string]string)
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		// hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(sc.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			paths[controller] = parts[2]
+		}
+	}
+	return paths, sc.Err()
+}
+
+func readUint(file string) (uint64, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+}
+
+// readKeyValues reads every value of flat keyed file such as memory.stat.
+func readKeyValues(file string) (map[string]uint64, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	result := make(map[string]uint64)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		v, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "malformed line in [%s]", file)
+		}
+		result[fields[0]] = v
+	}
+	return result, sc.Err()
+}
+
+// readKeyValue reads the value of key from flat keyed file such as
+// memory.stat or memory.events. Missing key is read as zero.
+func readKeyValue(file, key string) (uint64, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) != 2 || fields[0] != key {
+			continue
+		}
+		return strconv.ParseUint(fields[1], 10, 64)
+	}
+	return 0, sc.Err()
+}
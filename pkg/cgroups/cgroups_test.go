@@ -0,0 +1,198 @@
+package cgroups
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeFiles writes the files by path relative to dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestParseCgroupFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]string
+	}{
+		{"unified", "0::/zcm/c1\n", map[string]string{"": "/zcm/c1"}},
+		{"legacy", "12:memory:/zcm/c1\n" +
+			"4:cpu,cpuacct:/system.slice/c1\n" +
+			"1:name=systemd:/system.slice/zcm-c1.scope\n" +
+			"0::/system.slice/zcm-c1.scope\n",
+			map[string]string{
+				"memory":       "/zcm/c1",
+				"cpu":          "/system.slice/c1",
+				"cpuacct":      "/system.slice/c1",
+				"name=systemd": "/system.slice/zcm-c1.scope",
+				"":             "/system.slice/zcm-c1.scope",
+			}},
+		{"malformed line skipped", "malformed\n0::/zcm/c1\n", map[string]string{"": "/zcm/c1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCgroupFile(strings.NewReader(tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseCgroupFile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLegacyCgroup(t *testing.T) {
+	tests := []struct {
+		name          string
+		paths         map[string]string
+		files         map[string]string
+		wantStats     *Stats
+		wantOOMKilled bool
+		wantErr       bool
+	}{
+		{
+			name: "same path",
+			files: map[string]string{
+				"cpuacct/zcm/c1/cpuacct.usage":        "3000\n",
+				"memory/zcm/c1/memory.usage_in_bytes": "4096\n",
+				"memory/zcm/c1/memory.stat": "total_inactive_file 1024\ntotal_rss 2048\n" +
+					"total_pgfault 10\ntotal_pgmajfault 1\n",
+				"memory/zcm/c1/memory.oom_control": "oom_kill_disable 0\nunder_oom 0\noom_kill 1\n",
+			},
+			wantStats: &Stats{
+				CPUUsage:         3000,
+				MemoryUsage:      4096,
+				MemoryWorkingSet: 3072,
+				MemoryRSS:        2048,
+				PageFaults:       10,
+				MajorPageFaults:  1,
+			},
+			wantOOMKilled: true,
+		},
+		{
+			name:  "path by controller",
+			paths: map[string]string{"cpuacct": "/cpu/c1", "memory": "/memory/c1"},
+			files: map[string]string{
+				"cpuacct/cpu/c1/cpuacct.usage":           "3000\n",
+				"memory/memory/c1/memory.usage_in_bytes": "4096\n",
+				"memory/memory/c1/memory.stat":           "total_inactive_file 1024\ntotal_rss 2048\n",
+				"memory/memory/c1/memory.oom_control":    "oom_kill 0\n",
+			},
+			wantStats: &Stats{
+				CPUUsage:         3000,
+				MemoryUsage:      4096,
+				MemoryWorkingSet: 3072,
+				MemoryRSS:        2048,
+			},
+		},
+		{
+			name: "cgroup removed",
+			// the removed cgroup has no stats, and is not OOM killed
+			files:   map[string]string{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeFiles(t, root, tt.files)
+			c := &legacyCgroup{root: root, path: "/zcm/c1", paths: tt.paths}
+
+			stats, err := c.Stats()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Stats() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(stats, tt.wantStats) {
+				t.Errorf("Stats() = %+v, want %+v", stats, tt.wantStats)
+			}
+			oomKilled, err := c.OOMKilled()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if oomKilled != tt.wantOOMKilled {
+				t.Errorf("OOMKilled() = %v, want %v", oomKilled, tt.wantOOMKilled)
+			}
+		})
+	}
+}
+
+func TestUnifiedCgroup(t *testing.T) {
+	tests := []struct {
+		name          string
+		files         map[string]string
+		wantStats     *Stats
+		wantOOMKilled bool
+		wantErr       bool
+	}{
+		{
+			name: "oom killed",
+			files: map[string]string{
+				"cpu.stat":       "usage_usec 3\nuser_usec 2\nsystem_usec 1\n",
+				"memory.current": "4096\n",
+				"memory.stat": "anon 2048\ninactive_file 1024\n" +
+					"pgfault 10\npgmajfault 1\n",
+				"memory.events": "low 0\nhigh 0\nmax 1\noom 1\noom_kill 1\n",
+			},
+			wantStats: &Stats{
+				CPUUsage:         3000,
+				MemoryUsage:      4096,
+				MemoryWorkingSet: 3072,
+				MemoryRSS:        2048,
+				PageFaults:       10,
+				MajorPageFaults:  1,
+			},
+			wantOOMKilled: true,
+		},
+		{
+			name: "inactive file over usage",
+			files: map[string]string{
+				"cpu.stat":       "usage_usec 3\n",
+				"memory.current": "1024\n",
+				"memory.stat":    "inactive_file 4096\n",
+				"memory.events":  "oom 0\noom_kill 0\n",
+			},
+			wantStats: &Stats{CPUUsage: 3000, MemoryUsage: 1024},
+		},
+		{
+			name:    "cgroup removed",
+			files:   map[string]string{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+			c := &unifiedCgroup{dir: dir}
+
+			stats, err := c.Stats()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Stats() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(stats, tt.wantStats) {
+				t.Errorf("Stats() = %+v, want %+v", stats, tt.wantStats)
+			}
+			oomKilled, err := c.OOMKilled()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if oomKilled != tt.wantOOMKilled {
+				t.Errorf("OOMKilled() = %v, want %v", oomKilled, tt.wantOOMKilled)
+			}
+		})
+	}
+}
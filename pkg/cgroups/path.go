@@ -0,0 +1,102 @@
+package cgroups
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Driver is how the cgroups of the containers are managed.
+type Driver string
+
+const (
+	// Cgroupfs driver writes cgroupfs directly. The cgroup path is a path
+	// relative to the hierarchy root.
+	Cgroupfs Driver = "cgroupfs"
+	// Systemd driver asks systemd to create the cgroup as a transient
+	// scope. The cgroup path is in the form of "slice:prefix:name".
+	Systemd Driver = "systemd"
+)
+
+const (
+	defaultParent      = "/zcm"
+	defaultSystemSlice = "system.slice"
+	scopePrefix        = "zcm"
+)
+
+func ParseDriver(value string) (Driver, error) {
+	switch Driver(value) {
+	case "", Cgroupfs:
+		return Cgroupfs, nil
+	case Systemd:
+		return Systemd, nil
+	}
+	return "", errors.Errorf("unknown cgroup driver [%s]", value)
+}
+
+// ContainerPath returns the cgroups path of the OCI runtime spec for the
+// container under the parent cgroup, which is given by the pod sandbox.
+func ContainerPath(driver Driver, parent string, id string) (string, error) {
+	switch driver {
+	case Systemd:
+		if parent == "" {
+			parent = defaultSystemSlice
+		}
+		if !strings.HasSuffix(parent, ".slice") {
+			return "", errors.Errorf("cgroup parent [%s] is not a systemd slice", parent)
+		}
+		return parent + ":" + scopePrefix + ":" + id, nil
+	case Cgroupfs:
+		if parent == "" {
+			parent = defaultParent
+		}
+		if strings.HasSuffix(parent, ".slice") {
+			return "", errors.Errorf("cgroup parent [%s] is a systemd slice, but cgroupfs driver is used", parent)
+		}
+		return filepath.Join("/", parent, id), nil
+	}
+	return "", errors.Errorf("unknown cgroup driver [%s]", driver)
+}
+
+// HierarchyPath returns the cgroup relative to the hierarchy root, which the
+// OCI runtime creates for the cgroups path of the OCI runtime spec.
+func HierarchyPath(cgroupsPath string) (string, error) {
+	parts := strings.Split(cgroupsPath, ":")
+	switch len(parts) {
+	case 1:
+		return filepath.Join("/", cgroupsPath), nil
+	case 3:
+		// systemd slice:prefix:name is the scope prefix-name.scope in the
+		// slice
+		slice, err := expandSlice(parts[0])
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(slice, parts[1]+"-"+parts[2]+".scope"), nil
+	}
+	return "", errors.Errorf("malformed cgroups path [%s]", cgroupsPath)
+}
+
+// expandSlice returns the cgroup of the systemd slice, which is nested in
+// the slices of its dash separated prefixes, e.g. a-b.slice is
+// /a.slice/a-b.slice.
+func expandSlice(slice string) (string, error) {
+	name := strings.TrimSuffix(slice, ".slice")
+	if name == slice || strings.Contains(name, "/") {
+		return "", errors.Errorf("malformed systemd slice [%s]", slice)
+	}
+	if name == "-" {
+		return "/", nil
+	}
+	path, prefix := "/", ""
+	for _, part := range strings.Split(name, "-") {
+		if part == "" {
+			return "", errors.Errorf("malformed systemd slice [%s]", slice)
+		}
+		prefix += part
+		path = filepath.Join(path, prefix+".slice")
+		prefix += "-"
+	}
+	return path, nil
+}
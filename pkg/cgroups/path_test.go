@@ -0,0 +1,88 @@
+package cgroups
+
+import "testing"
+
+func TestParseDriver(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Driver
+		wantErr bool
+	}{
+		{"", Cgroupfs, false},
+		{"cgroupfs", Cgroupfs, false},
+		{"systemd", Systemd, false},
+		{"Systemd", "", true},
+		{"unknown", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseDriver(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseDriver(%q) err = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseDriver(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestContainerPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		driver  Driver
+		parent  string
+		want    string
+		wantErr bool
+	}{
+		{"cgroupfs default parent", Cgroupfs, "", "/zcm/c1", false},
+		{"cgroupfs parent", Cgroupfs, "/kubepods/burstable/pod1", "/kubepods/burstable/pod1/c1", false},
+		{"cgroupfs relative parent", Cgroupfs, "kubepods/pod1", "/kubepods/pod1/c1", false},
+		{"cgroupfs parent is cleaned", Cgroupfs, "/kubepods//pod1/", "/kubepods/pod1/c1", false},
+		{"cgroupfs with slice", Cgroupfs, "kubepods.slice", "", true},
+		{"systemd default slice", Systemd, "", "system.slice:zcm:c1", false},
+		{"systemd slice", Systemd, "kubepods-burstable-pod1.slice", "kubepods-burstable-pod1.slice:zcm:c1", false},
+		{"systemd with path", Systemd, "/kubepods/pod1", "", true},
+		{"unknown driver", "unknown", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ContainerPath(tt.driver, tt.parent, "c1")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ContainerPath() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHierarchyPath(t *testing.T) {
+	tests := []struct {
+		name        string
+		cgroupsPath string
+		want        string
+		wantErr     bool
+	}{
+		{"cgroupfs", "/kubepods/pod1/c1", "/kubepods/pod1/c1", false},
+		{"cgroupfs relative", "zcm/c1", "/zcm/c1", false},
+		{"systemd", "system.slice:zcm:c1", "/system.slice/zcm-c1.scope", false},
+		{"systemd nested slice", "kubepods-burstable-pod1.slice:zcm:c1",
+			"/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1.slice/zcm-c1.scope", false},
+		{"systemd root slice", "-.slice:zcm:c1", "/zcm-c1.scope", false},
+		{"systemd without slice suffix", "kubepods:zcm:c1", "", true},
+		{"systemd empty slice part", "kubepods--pod1.slice:zcm:c1", "", true},
+		{"malformed", "a:b", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := HierarchyPath(tt.cgroupsPath)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("HierarchyPath() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package cgroups
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// legacyCgroup is a cgroup on v1 hierarchies, one per controller. The
+// controller is at path unless paths has its own.
+type legacyCgroup struct {
+	root  string
+	path  string
+	paths map[string]string
+}
+
+func (c *legacyCgroup) dir(controller string) string {
+	if path, ok := c.paths[controller]; ok {
+		return filepath.Join(c.root, controller, path)
+	}
+	return filepath.Join(c.root, controller, c.path)
+}
+
+func (c *legacyCgroup) OOMKilled() (bool, error) {
+	n, err := readKeyValue(filepath.Join(c.dir("memory"), "memory.oom_control"), "oom_kill")
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return n > 0, err
+}
+
+func (c *legacyCgroup) Stats() (*Stats, error) {
+	cpuUsage, err := readUint(filepath.Join(c.dir("cpuacct"), "cpuacct.usage"))
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read cpu usage")
+	}
+	memoryUsage, err := readUint(filepath.Join(c.dir("memory"), "memory.usage_in_bytes"))
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read memory usage")
+	}
+	memoryStat, err := readKeyValues(filepath.Join(c.dir("memory"), "memory.stat"))
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read memory stat")
+	}
+	return &Stats{
+		CPUUsage:         cpuUsage,
+		MemoryUsage:      memoryUsage,
+		MemoryWorkingSet: workingSet(memoryUsage, memoryStat["total_inactive_file"]),
+		MemoryRSS:        memoryStat["total_rss"],
+		PageFaults:       memoryStat["total_pgfault"],
+		MajorPageFaults:  memoryStat["total_pgmajfault"],
+	}, nil
+}
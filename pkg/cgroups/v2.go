@@ -0,0 +1,45 @@
+package cgroups
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// unifiedCgroup is a cgroup on the v2 unified hierarchy.
+type unifiedCgroup struct {
+	dir string
+}
+
+func (c *unifiedCgroup) OOMKilled() (bool, error) {
+	n, err := readKeyValue(filepath.Join(c.dir, "memory.events"), "oom_kill")
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return n > 0, err
+}
+
+func (c *unifiedCgroup) Stats() (*Stats, error) {
+	cpuStat, err := readKeyValues(filepath.Join(c.dir, "cpu.stat"))
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read cpu stat")
+	}
+	memoryUsage, err := readUint(filepath.Join(c.dir, "memory.current"))
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read memory usage")
+	}
+	memoryStat, err := readKeyValues(filepath.Join(c.dir, "memory.stat"))
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read memory stat")
+	}
+	return &Stats{
+		// cpu.stat reports usage in microseconds
+		CPUUsage:         cpuStat["usage_usec"] * 1000,
+		MemoryUsage:      memoryUsage,
+		MemoryWorkingSet: workingSet(memoryUsage, memoryStat["inactive_file"]),
+		MemoryRSS:        memoryStat["anon"],
+		PageFaults:       memoryStat["pgfault"],
+		MajorPageFaults:  memoryStat["pgmajfault"],
+	}, nil
+}
@@ -1,10 +1,14 @@
 package container
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
 	"simpleconman/pkg/fsutil"
+	"strconv"
 	"strings"
 	"time"
 
@@ -34,13 +38,27 @@ func (s Status) String() string {
 	return statusValue[s]
 }
 
+func (s Status) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Status) UnmarshalText(b []byte) error {
+	for i, v := range statusValue {
+		if v == string(b) {
+			*s = Status(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown status: %s", string(b))
+}
+
 type Id string
 
 func (id Id) String() string {
 	return string(id)
 }
 
-func genId() Id {
+func GenId() Id {
 	return Id(strings.ReplaceAll(uuid.NewString(), "-", ""))
 }
 
@@ -55,15 +73,15 @@ type Handle struct {
 	logFile    string
 	attachFile string
 	exitFile   string
+	metadata   Metadata
 	getter     Getter
 }
 
 type BaseDirFn func(id Id) string
 type BaseFileFn func(id Id) string
 
-func NewHandle(getter Getter, fn BaseDirFn,
+func NewHandle(getter Getter, id Id, fn BaseDirFn,
 	logFileFn, attachFileFn, exitFileFn BaseFileFn) (*Handle, error) {
-	id := genId()
 	baseDir := fn(id)
 
 	ok, err := fsutil.Exists(baseDir)
@@ -91,6 +109,19 @@ func NewHandle(getter Getter, fn BaseDirFn,
 	}, nil
 }
 
+// RestoreHandle returns the handle of the container created before. Log file
+// is replaced with the one recorded in the metadata by LoadMetadata().
+func RestoreHandle(id Id, fn BaseDirFn,
+	logFileFn, attachFileFn, exitFileFn BaseFileFn) *Handle {
+	return &Handle{
+		id:         id,
+		baseDir:    fn(id),
+		logFile:    logFileFn(id),
+		attachFile: attachFileFn(id),
+		exitFile:   exitFileFn(id),
+	}
+}
+
 func (h *Handle) Id() Id {
 	return h.id
 }
@@ -115,6 +146,27 @@ func (h *Handle) StateFile() string {
 	return path.Join(h.BaseDir(), "state.json")
 }
 
+func (h *Handle) ShimPidFile() string {
+	return path.Join(h.BundleDir(), "shim.pid")
+}
+
+func (h *Handle) ContainerPidFile() string {
+	return path.Join(h.BundleDir(), "container.pid")
+}
+
+// ShimPid reads pid of the shim which manages the container.
+func (h *Handle) ShimPid() (int, error) {
+	b, err := ioutil.ReadFile(h.ShimPidFile())
+	if err != nil {
+		return 0, errors.Wrap(err, "cannot read shim pid file")
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return 0, errors.Wrapf(err, "malformed shim pid file [%s]", string(b))
+	}
+	return pid, nil
+}
+
 func (h *Handle) LogFile() string {
 	return h.logFile
 }
@@ -127,46 +179,172 @@ func (h *Handle) ExitFile() string {
 	return h.exitFile
 }
 
-func (h *Handle) Bundle(spec []byte, rootfs string) error {
+// CopyRootfs creates the bundle dir with a copy of the rootfs.
+func (h *Handle) CopyRootfs(rootfs string) error {
 	if err := os.MkdirAll(h.BundleDir(), 0700); err != nil {
 		return errors.Wrap(err, "cannot create bundle dir")
 	}
 	if err := fsutil.CopyDir(rootfs, h.RootfsDir()); err != nil {
 		return errors.Wrap(err, "cannot copy rootfs dir")
 	}
+	return nil
+}
+
+// Bundle writes the OCI runtime spec into the bundle dir which CopyRootfs has
+// created.
+func (h *Handle) Bundle(spec []byte) error {
 	if err := ioutil.WriteFile(h.RuntimeSpecFile(), spec, 0644); err != nil {
 		return errors.Wrap(err, "cannot write OCI runtime spec file")
 	}
 	return nil
 }
 
-func (h *Handle) writeStatus(status Status) error {
-	statefile := h.StateFile()
-	// create tmp file for atmoic update
-	tmpfile := statefile + ".writing"
+// Remove removes every file of the container: the base dir which holds the
+// bundle and the state, the log file, the attach socket and the exit file.
+// Files which are already removed are ignored.
+func (h *Handle) Remove() error {
+	if err := os.RemoveAll(h.BaseDir()); err != nil {
+		return errors.Wrap(err, "cannot remove container dir")
+	}
+	for _, file := range []string{h.LogFile(), h.AttachFile(), h.ExitFile()} {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "cannot remove file [%s]", file)
+		}
+	}
+	return nil
+}
 
-	if err := ioutil.WriteFile(tmpfile, []byte(status.String()), 0600); err != nil {
-		return errors.Wrap(err, "cannot write status to tmp file")
+// State is what the manager records about the container lifecycle in
+// StateFile(). The OCI runtime knows nothing about exit codes and timestamps
+// once the container is gone, so they are kept here.
+type State struct {
+	Status     Status    `json:"status"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	ExitCode   int32     `json:"exitCode"`
+	// CgroupPath is the cgroup of the container relative to the hierarchy
+	// root. It is recorded on start to find the cgroup even after exit.
+	CgroupPath string `json:"cgroupPath,omitempty"`
+	// CgroupPaths are the cgroups by controller on cgroup v1, whose
+	// hierarchies may have the container at paths other than CgroupPath.
+	CgroupPaths map[string]string `json:"cgroupPaths,omitempty"`
+}
+
+// State returns the recorded state. Container which has no state file yet is
+// in Initial status.
+func (h *Handle) State() (*State, error) {
+	b, err := ioutil.ReadFile(h.StateFile())
+	if os.IsNotExist(err) {
+		return &State{Status: Initial}, nil
 	}
-	return os.Rename(tmpfile, statefile)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read state file")
+	}
+	// the state file of the older versions has only the status name
+	if len(b) > 0 && b[0] != '{' {
+		state := &State{}
+		if err := state.Status.UnmarshalText(bytes.TrimSpace(b)); err != nil {
+			return nil, errors.Wrap(err, "cannot decode state file")
+		}
+		return state, nil
+	}
+	state := &State{}
+	if err := json.Unmarshal(b, state); err != nil {
+		return nil, errors.Wrap(err, "cannot decode state file")
+	}
+	return state, nil
+}
+
+func (h *Handle) writeState(state *State) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return errors.Wrap(err, "cannot encode state")
+	}
+	if err := fsutil.WriteFileAtomic(h.StateFile(), b, 0600); err != nil {
+		return errors.Wrap(err, "cannot write state")
+	}
+	return nil
+}
+
+func (h *Handle) updateState(fn func(state *State)) error {
+	state, err := h.State()
+	if err != nil {
+		return err
+	}
+	fn(state)
+	return h.writeState(state)
 }
 
 func (h *Handle) Created() error {
-	return h.writeStatus(Created)
+	return h.updateState(func(state *State) {
+		state.Status = Created
+	})
 }
 
 func (h *Handle) Started() error {
-	return h.writeStatus(Running)
+	return h.updateState(func(state *State) {
+		state.Status = Running
+		state.StartedAt = time.Now()
+	})
+}
+
+func (h *Handle) SetCgroupPath(cgroupPath string, cgroupPaths map[string]string) error {
+	return h.updateState(func(state *State) {
+		state.CgroupPath = cgroupPath
+		state.CgroupPaths = cgroupPaths
+	})
+}
+
+// UnknownExitCode is the exit code of the container which exited without
+// the exit file, e.g. its shim was killed.
+const UnknownExitCode = 255
+
+func (h *Handle) Stopped(exitCode int32, finishedAt time.Time) error {
+	return h.updateState(func(state *State) {
+		state.Status = Stopped
+		state.ExitCode = exitCode
+		state.FinishedAt = finishedAt
+	})
+}
+
+// ExitStatus reads the exit file written by the shim when the container
+// process is gone. The file holds the decimal exit code, and its modification
+// time is taken as the time the container finished.
+func (h *Handle) ExitStatus() (int32, time.Time, error) {
+	b, err := ioutil.ReadFile(h.ExitFile())
+	if err != nil {
+		return 0, time.Time{}, errors.Wrap(err, "cannot read exit file")
+	}
+	code, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 32)
+	if err != nil {
+		return 0, time.Time{}, errors.Wrapf(err, "malformed exit file [%s]", string(b))
+	}
+	info, err := os.Stat(h.ExitFile())
+	if err != nil {
+		return 0, time.Time{}, errors.Wrap(err, "cannot stat exit file")
+	}
+	return int32(code), info.ModTime(), nil
 }
 
 type Instance struct {
-	Id        Id
-	Pid       uint32
-	CreatedAt time.Time
-	StartedAt time.Time
-	Status    Status
+	Id         Id
+	Pid        uint32
+	CreatedAt  time.Time
+	StartedAt  time.Time
+	FinishedAt time.Time
+	ExitCode   int32
+	Status     Status
+	Metadata   Metadata
 }
 
 func (i *Instance) CanStart() bool {
 	return i.Status == Created
 }
+
+func (i *Instance) CanStop() bool {
+	return i.Status == Running
+}
+
+func (i *Instance) CanUpdate() bool {
+	return i.Status == Created || i.Status == Running
+}
@@ -0,0 +1,60 @@
+package container
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestHandleState(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		wantStatus Status
+		wantCode   int32
+		wantErr    bool
+	}{
+		{"json", `{"status":"stopped","exitCode":137}`, Stopped, 137, false},
+		{"legacy created", "created", Created, 0, false},
+		{"legacy running", "running", Running, 0, false},
+		{"legacy with newline", "running\n", Running, 0, false},
+		{"legacy unknown status", "paused", 0, 0, true},
+		{"malformed json", `{"status":`, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handle := testDirs(t.TempDir()).newHandle(t, "c1")
+			if err := os.WriteFile(handle.StateFile(), []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			state, err := handle.State()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("State() error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if state.Status != tt.wantStatus || state.ExitCode != tt.wantCode {
+				t.Errorf("state = %v with exit code %d, want %v with %d",
+					state.Status, state.ExitCode, tt.wantStatus, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestHandleStateMigratesLegacyFormat(t *testing.T) {
+	handle := testDirs(t.TempDir()).newHandle(t, "c1")
+	if err := os.WriteFile(handle.StateFile(), []byte("running"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := handle.Stopped(1, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	state, err := handle.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Status != Stopped || state.ExitCode != 1 {
+		t.Errorf("state = %v with exit code %d, want stopped with 1", state.Status, state.ExitCode)
+	}
+}
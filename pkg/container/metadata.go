@@ -0,0 +1,91 @@
+package container
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path"
+	"simpleconman/pkg/fsutil"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pkg/errors"
+)
+
+// metadataVersion is bumped whenever Metadata changes incompatibly, so the
+// record written by older manager is not misread.
+const metadataVersion = 1
+
+// Metadata is what the container is created with. It is kept in
+// MetadataFile() to list, inspect and recover the container later. Image is
+// the reference kubelet resolved the image to, and UserSpecifiedImage is the
+// image in the pod spec. Resources are the ones of the OCI runtime spec after
+// the last update of the resources.
+type Metadata struct {
+	Name               string                `json:"name"`
+	Attempt            uint32                `json:"attempt"`
+	PodSandboxId       string                `json:"podSandboxId"`
+	Image              string                `json:"image"`
+	UserSpecifiedImage string                `json:"userSpecifiedImage,omitempty"`
+	Labels             map[string]string     `json:"labels,omitempty"`
+	Annotations        map[string]string     `json:"annotations,omitempty"`
+	Mounts             []Mount               `json:"mounts,omitempty"`
+	LogPath            string                `json:"logPath"`
+	Resources          *specs.LinuxResources `json:"resources,omitempty"`
+}
+
+type Mount struct {
+	ContainerPath  string `json:"containerPath"`
+	HostPath       string `json:"hostPath"`
+	Readonly       bool   `json:"readonly,omitempty"`
+	SelinuxRelabel bool   `json:"selinuxRelabel,omitempty"`
+	// Propagation is one of rprivate, rslave and rshared
+	Propagation string `json:"propagation,omitempty"`
+}
+
+type metadataRecord struct {
+	Version  int      `json:"version"`
+	Metadata Metadata `json:"metadata"`
+}
+
+func (h *Handle) MetadataFile() string {
+	return path.Join(h.BaseDir(), "metadata.json")
+}
+
+func (h *Handle) Metadata() Metadata {
+	return h.metadata
+}
+
+// SetMetadata records the metadata in MetadataFile().
+func (h *Handle) SetMetadata(metadata Metadata) error {
+	b, err := json.Marshal(&metadataRecord{
+		Version:  metadataVersion,
+		Metadata: metadata,
+	})
+	if err != nil {
+		return errors.Wrap(err, "cannot encode metadata")
+	}
+	if err := fsutil.WriteFileAtomic(h.MetadataFile(), b, 0600); err != nil {
+		return errors.Wrap(err, "cannot write metadata")
+	}
+	h.metadata = metadata
+	return nil
+}
+
+// LoadMetadata reads the metadata recorded in MetadataFile().
+func (h *Handle) LoadMetadata() error {
+	b, err := ioutil.ReadFile(h.MetadataFile())
+	if err != nil {
+		return errors.Wrap(err, "cannot read metadata file")
+	}
+	record := &metadataRecord{}
+	if err := json.Unmarshal(b, record); err != nil {
+		return errors.Wrap(err, "cannot decode metadata file")
+	}
+	if record.Version != metadataVersion {
+		return errors.Errorf("unsupported metadata version [%d]", record.Version)
+	}
+	h.metadata = record.Metadata
+	if record.Metadata.LogPath != "" {
+		h.logFile = record.Metadata.LogPath
+	}
+	return nil
+}
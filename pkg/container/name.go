@@ -0,0 +1,20 @@
+package container
+
+import (
+	"fmt"
+	"simpleconman/pkg/store"
+)
+
+// FullName is the name of the container unique in the node. Kubelet creates
+// container with the same name and attempt in a pod sandbox only once.
+func (m Metadata) FullName() string {
+	return fmt.Sprintf("%s_%s_%d", m.Name, m.PodSandboxId, m.Attempt)
+}
+
+// NameIndex reserves names for containers so that no two containers share a
+// name.
+type NameIndex = store.NameIndex[Id]
+
+func NewNameIndex() *NameIndex {
+	return store.NewNameIndex[Id]("container")
+}
@@ -0,0 +1,46 @@
+package container
+
+import "testing"
+
+func TestFullName(t *testing.T) {
+	m := Metadata{Name: "app", PodSandboxId: "pod1", Attempt: 2}
+	if got, want := m.FullName(), "app_pod1_2"; got != want {
+		t.Errorf("FullName() = %s, want %s", got, want)
+	}
+}
+
+func TestNameIndex(t *testing.T) {
+	names := NewNameIndex()
+	steps := []struct {
+		op      string
+		name    string
+		id      Id
+		wantErr bool
+	}{
+		{"reserve", "app", "c1", false},
+		// reserving again for the same container is not an error
+		{"reserve", "app", "c1", false},
+		{"reserve", "app", "c2", true},
+		{"reserve", "db", "c2", false},
+		// release by other container does nothing
+		{"release", "app", "c2", false},
+		{"reserve", "app", "c3", true},
+		{"release", "app", "c1", false},
+		{"reserve", "app", "c3", false},
+		// releasing twice is not an error
+		{"release", "db", "c2", false},
+		{"release", "db", "c2", false},
+		{"reserve", "db", "c1", false},
+	}
+	for i, step := range steps {
+		switch step.op {
+		case "reserve":
+			err := names.Reserve(step.name, step.id)
+			if (err != nil) != step.wantErr {
+				t.Fatalf("step %d: Reserve(%s, %s) = %v, want error %v", i, step.name, step.id, err, step.wantErr)
+			}
+		case "release":
+			names.Release(step.name, step.id)
+		}
+	}
+}
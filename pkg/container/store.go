@@ -3,86 +3,88 @@ package container
 import (
 	"errors"
 	"fmt"
-	"sync"
+	"simpleconman/pkg/store"
 )
 
-type Iterator interface {
-	HasNext() bool
-	Next() *Handle
-}
-
-type defaultIter struct {
-	curr    int
-	handles []*Handle
-}
+type Iterator = store.Iterator[*Handle]
 
-func newDefaultIter(handles []*Handle) *defaultIter {
-	return &defaultIter{
-		curr:    0,
-		handles: handles,
-	}
-}
-
-func (i *defaultIter) HasNext() bool {
-	return i.curr < len(i.handles)-1
-}
-
-func (i *defaultIter) Next() *Handle {
-	if i.curr == len(i.handles)-1 {
-		return nil
-	}
-	result := i.handles[i.curr]
-	i.curr += 1
-	return result
-}
+var ErrNotFound = errors.New("container not found")
 
 type ReadOnlyStore interface {
 	Get(id Id) (*Handle, error)
+	Iter() Iterator
 }
 
 type Store interface {
 	ReadOnlyStore
 	Put(*Handle) error
-	Iter() Iterator
+	Delete(id Id) error
 }
 
-type InMemStore struct {
-	lock    *sync.RWMutex
-	handles map[Id]*Handle
-}
+type InMemStore = store.InMemStore[Id, *Handle]
 
 func NewInMemStore() *InMemStore {
-	return &InMemStore{
-		lock:    &sync.RWMutex{},
-		handles: make(map[Id]*Handle),
-	}
+	return store.NewInMemStore[Id, *Handle](ErrNotFound)
 }
 
-func (s *InMemStore) Put(handle *Handle) error {
-	s.lock.Lock()
-	defer s.lock.Unlock()
+// Inspector tells the container state known by the OCI runtime.
+type Inspector interface {
+	Container(handle *Handle) (*Instance, error)
+}
 
-	if handle.id == "" {
-		return errors.New("cannot put handle because id is not defined")
-	}
-	s.handles[handle.id] = handle
-	return nil
+// PersistentStore is a store which is rebuilt from the container dirs left by
+// the previous run, so containers survive restarts of the manager.
+type PersistentStore struct {
+	*InMemStore
+
+	// orphans are containers which cannot be restored and should be cleaned
+	// up: half-created ones and ones unknown to the OCI runtime.
+	orphans []*Handle
 }
-func (s *InMemStore) Get(id Id) (*Handle, error) {
-	s.lock.RLock()
-	defer s.lock.RUnlock()
 
-	handle, ok := s.handles[id]
-	if !ok {
-		return nil, fmt.Errorf("cannot find handle. id [%s]", id)
+// NewPersistentStore scans dir which contains a base dir per container and
+// restores each container from its state and metadata.
+func NewPersistentStore(dir string, inspector Inspector, fn BaseDirFn,
+	logFileFn, attachFileFn, exitFileFn BaseFileFn) (*PersistentStore, error) {
+	s := &PersistentStore{
+		InMemStore: NewInMemStore(),
+	}
+	orphans, err := s.Restore(dir, "container", func(id Id) *Handle {
+		return RestoreHandle(id, fn, logFileFn, attachFileFn, exitFileFn)
+	}, func(handle *Handle) error {
+		return restore(handle, inspector)
+	})
+	if err != nil {
+		return nil, err
 	}
-	return handle, nil
+	s.orphans = orphans
+	return s, nil
 }
 
-func (s *InMemStore) Iter() Iterator {
-	items := make([]*Handle, len(s.handles))
-	for _, h := range s.handles {
-		items = append(items, h)
+func restore(handle *Handle, inspector Inspector) error {
+	if err := handle.LoadMetadata(); err != nil {
+		return err
+	}
+	state, err := handle.State()
+	if err != nil {
+		return err
 	}
-	return newDefaultIter(items)
+	// CreateContainer did not complete
+	if state.Status == Initial {
+		return errors.New("container is half-created")
+	}
+	cont, err := inspector.Container(handle)
+	if err != nil {
+		return fmt.Errorf("container is unknown to OCI runtime: %w", err)
+	}
+	// container exited while nobody was watching
+	if cont.Status == Stopped && state.Status != Stopped {
+		return handle.Stopped(cont.ExitCode, cont.FinishedAt)
+	}
+	return nil
+}
+
+// Orphans returns containers which could not be restored.
+func (s *PersistentStore) Orphans() []*Handle {
+	return s.orphans
 }
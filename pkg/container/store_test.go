@@ -0,0 +1,168 @@
+package container
+
+import (
+	"errors"
+	"os"
+	"path"
+	"sort"
+	"testing"
+	"time"
+)
+
+type fakeInspector map[Id]*Instance
+
+func (i fakeInspector) Container(handle *Handle) (*Instance, error) {
+	cont, ok := i[handle.Id()]
+	if !ok {
+		return nil, errors.New("container does not exist")
+	}
+	return cont, nil
+}
+
+type testDirs string
+
+func (d testDirs) baseDir(id Id) string {
+	return path.Join(string(d), "containers", id.String())
+}
+
+func (d testDirs) file(name string) BaseFileFn {
+	return func(id Id) string {
+		return path.Join(string(d), name, id.String())
+	}
+}
+
+func (d testDirs) newHandle(t *testing.T, id Id) *Handle {
+	t.Helper()
+	handle, err := NewHandle(nil, id, d.baseDir, d.file("logs"), d.file("attach"), d.file("exits"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return handle
+}
+
+func (d testDirs) restore(t *testing.T, inspector Inspector) *PersistentStore {
+	t.Helper()
+	store, err := NewPersistentStore(path.Join(string(d), "containers"), inspector,
+		d.baseDir, d.file("logs"), d.file("attach"), d.file("exits"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestPersistentStoreRestore(t *testing.T) {
+	dirs := testDirs(t.TempDir())
+	finishedAt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	inspector := fakeInspector{
+		"running": {Status: Running},
+		"exited":  {Status: Stopped, ExitCode: 3, FinishedAt: finishedAt},
+		"stopped": {Status: Stopped, ExitCode: 1},
+	}
+	tests := []struct {
+		id     Id
+		setup  func(h *Handle) error
+		orphan bool
+	}{
+		{"running", func(h *Handle) error { return h.Started() }, false},
+		{"exited", func(h *Handle) error { return h.Started() }, false},
+		{"stopped", func(h *Handle) error { return h.Stopped(1, finishedAt) }, false},
+		{"half-created", func(h *Handle) error { return nil }, true},
+		{"unknown", func(h *Handle) error { return h.Created() }, true},
+	}
+	for _, tt := range tests {
+		handle := dirs.newHandle(t, tt.id)
+		if err := handle.SetMetadata(Metadata{Name: tt.id.String(), LogPath: "/var/log/" + tt.id.String()}); err != nil {
+			t.Fatal(err)
+		}
+		if err := tt.setup(handle); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// metadata is not written yet
+	dirs.newHandle(t, "no-metadata")
+	// not a container dir
+	if err := os.WriteFile(path.Join(string(dirs), "containers", "file"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	store := dirs.restore(t, inspector)
+
+	var orphans []string
+	for _, h := range store.Orphans() {
+		orphans = append(orphans, h.Id().String())
+	}
+	sort.Strings(orphans)
+	wantOrphans := []string{"half-created", "no-metadata", "unknown"}
+	if len(orphans) != len(wantOrphans) {
+		t.Fatalf("orphans = %v, want %v", orphans, wantOrphans)
+	}
+	for i := range orphans {
+		if orphans[i] != wantOrphans[i] {
+			t.Fatalf("orphans = %v, want %v", orphans, wantOrphans)
+		}
+	}
+
+	for _, tt := range tests {
+		handle, err := store.Get(tt.id)
+		if tt.orphan {
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("orphan [%s] is restored", tt.id)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("container [%s] is not restored: %v", tt.id, err)
+			continue
+		}
+		if name := handle.Metadata().Name; name != tt.id.String() {
+			t.Errorf("name of [%s] = %s", tt.id, name)
+		}
+		if log := handle.LogFile(); log != "/var/log/"+tt.id.String() {
+			t.Errorf("log file of [%s] = %s, want the one in metadata", tt.id, log)
+		}
+	}
+
+	// exit while nobody was watching is recorded
+	handle, _ := store.Get("exited")
+	state, err := handle.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Status != Stopped || state.ExitCode != 3 || !state.FinishedAt.Equal(finishedAt) {
+		t.Errorf("state of exited container = %+v", state)
+	}
+}
+
+func TestPersistentStoreWithoutDir(t *testing.T) {
+	store, err := NewPersistentStore(path.Join(t.TempDir(), "none"), fakeInspector{},
+		nil, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.Iter().HasNext() || len(store.Orphans()) != 0 {
+		t.Error("store of missing dir is not empty")
+	}
+}
+
+func TestHandleRemove(t *testing.T) {
+	dirs := testDirs(t.TempDir())
+	handle := dirs.newHandle(t, "c1")
+	for _, file := range []string{handle.LogFile(), handle.ExitFile()} {
+		if err := os.MkdirAll(path.Dir(file), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if err := handle.Remove(); err != nil {
+			t.Fatalf("remove #%d: %v", i, err)
+		}
+	}
+	for _, file := range []string{handle.BaseDir(), handle.LogFile(), handle.ExitFile()} {
+		if _, err := os.Stat(file); !os.IsNotExist(err) {
+			t.Errorf("[%s] is left", file)
+		}
+	}
+}
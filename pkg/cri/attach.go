@@ -0,0 +1,79 @@
+package cri
+
+import (
+	"context"
+	"io"
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// The attach socket of the shim is a seqpacket socket. Each packet from the
+// shim starts with the byte of the pipe the output is of. What the client
+// writes is the stdin of the container as is.
+const (
+	attachPipeStdout = 2
+	attachPipeStderr = 3
+
+	// attachBufSize is the max size of the packet, the pipe byte included
+	attachBufSize = 8192 + 1
+)
+
+// attach connects the streams to the attach socket until the container
+// closes its output or ctx is done.
+func attach(ctx context.Context, socket string, stdin io.Reader, stdout, stderr io.Writer) error {
+	conn, err := net.DialUnix("unixpacket", nil, &net.UnixAddr{Name: socket, Net: "unixpacket"})
+	if err != nil {
+		return errors.Wrap(err, "cannot connect to attach socket")
+	}
+	defer conn.Close()
+
+	if stdin != nil {
+		go func() {
+			io.Copy(conn, stdin)
+			// the shim closes the stdin of the container if it is stdin once
+			conn.CloseWrite()
+		}()
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- copyAttachOutput(conn, stdout, stderr)
+	}()
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// copyAttachOutput demultiplexes the output of the attach socket. Output of
+// the stream which is not connected is dropped.
+func copyAttachOutput(conn *net.UnixConn, stdout, stderr io.Writer) error {
+	buf := make([]byte, attachBufSize)
+	for {
+		n, err := conn.Read(buf)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "cannot read attach socket")
+		}
+		if n == 0 {
+			continue
+		}
+		var w io.Writer
+		switch buf[0] {
+		case attachPipeStdout:
+			w = stdout
+		case attachPipeStderr:
+			w = stderr
+		}
+		if w == nil {
+			continue
+		}
+		if _, err := w.Write(buf[1:n]); err != nil {
+			return err
+		}
+	}
+}
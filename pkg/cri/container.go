@@ -2,8 +2,17 @@ package cri
 
 import (
 	"fmt"
+	"simpleconman/pkg/cgroups"
 	"simpleconman/pkg/container"
+	"simpleconman/pkg/oci"
+	"simpleconman/pkg/sandbox"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/opencontainers/selinux/go-selinux/label"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
 	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
 )
 
@@ -20,3 +29,304 @@ func Status(s container.Status) runtimeapi.ContainerState {
 	}
 	panic(fmt.Sprintf("unknown state: %s", s.String()))
 }
+
+const (
+	reasonCompleted = "Completed"
+	reasonError     = "Error"
+	reasonOOMKilled = "OOMKilled"
+)
+
+// exitReason returns brief CamelCase string explains why the container is in
+// its current state, and the human readable message of it. Only exited
+// containers have the reason.
+func exitReason(cont *container.Instance, handle *container.Handle) (string, string, error) {
+	if cont.Status != container.Stopped {
+		return "", "", nil
+	}
+	state, err := handle.State()
+	if err != nil {
+		return "", "", err
+	}
+	if state.CgroupPath != "" {
+		oomKilled, err := cgroups.LoadPaths(state.CgroupPath, state.CgroupPaths).OOMKilled()
+		if err != nil {
+			return "", "", err
+		}
+		if oomKilled {
+			return reasonOOMKilled, fmt.Sprintf("container was killed by the OOM killer, exit code %d",
+				cont.ExitCode), nil
+		}
+	}
+	if cont.ExitCode == 0 {
+		return reasonCompleted, "container exited with code 0", nil
+	}
+	return reasonError, exitMessage(cont.ExitCode), nil
+}
+
+// exitMessage tells the exit code. Exit code over 128 is the one of the
+// process killed by the signal of the code - 128.
+func exitMessage(code int32) string {
+	if code > 128 {
+		if name := unix.SignalName(syscall.Signal(code - 128)); name != "" {
+			return fmt.Sprintf("container was killed by %s, exit code %d", name, code)
+		}
+	}
+	return fmt.Sprintf("container exited with code %d", code)
+}
+
+// containerStats reads the cgroup of the running container for CPU and memory
+// usage, and the rootfs of the container for writable layer usage, which is
+// cached in diskUsage.
+func containerStats(cont *container.Instance, handle *container.Handle, diskUsage *diskUsageCache) (*runtimeapi.ContainerStats, error) {
+	now := time.Now().UnixNano()
+	stats := &runtimeapi.ContainerStats{
+		Attributes: &runtimeapi.ContainerAttributes{
+			Id: handle.Id().String(),
+		},
+		Cpu: &runtimeapi.CpuUsage{
+			Timestamp: now,
+		},
+		Memory: &runtimeapi.MemoryUsage{
+			Timestamp: now,
+		},
+	}
+
+	state, err := handle.State()
+	if err != nil {
+		return nil, err
+	}
+	if cont.Status == container.Running && state.CgroupPath != "" {
+		cgroupStats, err := cgroups.LoadPaths(state.CgroupPath, state.CgroupPaths).Stats()
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot read cgroup stats")
+		}
+		stats.Cpu.UsageCoreNanoSeconds = &runtimeapi.UInt64Value{Value: cgroupStats.CPUUsage}
+		stats.Memory.UsageBytes = &runtimeapi.UInt64Value{Value: cgroupStats.MemoryUsage}
+		stats.Memory.WorkingSetBytes = &runtimeapi.UInt64Value{Value: cgroupStats.MemoryWorkingSet}
+		stats.Memory.RssBytes = &runtimeapi.UInt64Value{Value: cgroupStats.MemoryRSS}
+		stats.Memory.PageFaults = &runtimeapi.UInt64Value{Value: cgroupStats.PageFaults}
+		stats.Memory.MajorPageFaults = &runtimeapi.UInt64Value{Value: cgroupStats.MajorPageFaults}
+	}
+
+	usedBytes, inodesUsed, err := diskUsage.get(handle.RootfsDir())
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read writable layer usage")
+	}
+	stats.WritableLayer = &runtimeapi.FilesystemUsage{
+		Timestamp:  now,
+		FsId:       &runtimeapi.FilesystemIdentifier{Mountpoint: handle.RootfsDir()},
+		UsedBytes:  &runtimeapi.UInt64Value{Value: usedBytes},
+		InodesUsed: &runtimeapi.UInt64Value{Value: inodesUsed},
+	}
+	return stats, nil
+}
+
+var propagations = map[runtimeapi.MountPropagation]string{
+	runtimeapi.MountPropagation_PROPAGATION_PRIVATE:           "rprivate",
+	runtimeapi.MountPropagation_PROPAGATION_HOST_TO_CONTAINER: "rslave",
+	runtimeapi.MountPropagation_PROPAGATION_BIDIRECTIONAL:     "rshared",
+}
+
+func toMounts(mounts []*runtimeapi.Mount) []container.Mount {
+	result := make([]container.Mount, 0, len(mounts))
+	for _, m := range mounts {
+		result = append(result, container.Mount{
+			ContainerPath:  m.GetContainerPath(),
+			HostPath:       m.GetHostPath(),
+			Readonly:       m.GetReadonly(),
+			SelinuxRelabel: m.GetSelinuxRelabel(),
+			Propagation:    propagations[m.GetPropagation()],
+		})
+	}
+	return result
+}
+
+func fromMounts(mounts []container.Mount) []*runtimeapi.Mount {
+	result := make([]*runtimeapi.Mount, 0, len(mounts))
+	for _, m := range mounts {
+		mount := &runtimeapi.Mount{
+			ContainerPath:  m.ContainerPath,
+			HostPath:       m.HostPath,
+			Readonly:       m.Readonly,
+			SelinuxRelabel: m.SelinuxRelabel,
+		}
+		for k, v := range propagations {
+			if v == m.Propagation {
+				mount.Propagation = k
+			}
+		}
+		result = append(result, mount)
+	}
+	return result
+}
+
+func (s *runtimeService) specOptions(req *runtimeapi.CreateContainerRequest,
+	handle *container.Handle, image *oci.ImageConfig,
+	sb *sandbox.Handle, sbState *sandbox.State) (oci.SpecOptions, error) {
+	config := req.GetConfig()
+	securityContext := config.GetLinux().GetSecurityContext()
+
+	envs := make([]string, 0, len(config.GetEnvs()))
+	for _, kv := range config.GetEnvs() {
+		envs = append(envs, kv.GetKey()+"="+kv.GetValue())
+	}
+	user := oci.User{
+		Username:           securityContext.GetRunAsUsername(),
+		SupplementalGroups: securityContext.GetSupplementalGroups(),
+	}
+	if securityContext.GetRunAsUser() != nil {
+		uid := securityContext.GetRunAsUser().GetValue()
+		user.Uid = &uid
+	}
+	if securityContext.GetRunAsGroup() != nil {
+		gid := securityContext.GetRunAsGroup().GetValue()
+		user.Gid = &gid
+	}
+	processLabel, mountLabel, err := selinuxLabels(securityContext.GetSelinuxOptions())
+	if err != nil {
+		return oci.SpecOptions{}, err
+	}
+	seccomp, err := securityProfile(securityContext.GetSeccomp(),
+		securityContext.GetSeccompProfilePath())
+	if err != nil {
+		return oci.SpecOptions{}, errors.Wrap(err, "invalid seccomp profile")
+	}
+	apparmor, err := securityProfile(securityContext.GetApparmor(),
+		securityContext.GetApparmorProfile())
+	if err != nil {
+		return oci.SpecOptions{}, errors.Wrap(err, "invalid AppArmor profile")
+	}
+	cgroupsPath, err := cgroups.ContainerPath(s.cgroupDriver,
+		sb.Metadata().CgroupParent, handle.Id().String())
+	if err != nil {
+		return oci.SpecOptions{}, err
+	}
+	namespaces, err := s.containerNamespaces(securityContext.GetNamespaceOptions(), sbState)
+	if err != nil {
+		return oci.SpecOptions{}, err
+	}
+	return oci.SpecOptions{
+		Command:      config.GetCommand(),
+		Args:         config.GetArgs(),
+		Envs:         envs,
+		WorkingDir:   config.GetWorkingDir(),
+		User:         user,
+		Hostname:     sb.Metadata().Hostname,
+		Terminal:     config.GetTty(),
+		RootPath:     handle.RootfsDir(),
+		RootReadonly: securityContext.GetReadonlyRootfs(),
+		Image:        image,
+		Mounts:       handle.Metadata().Mounts,
+		Pod:          sb.PodMounts(),
+		ProcessLabel: processLabel,
+		MountLabel:   mountLabel,
+
+		Privileged:       securityContext.GetPrivileged(),
+		NoNewPrivileges:  securityContext.GetNoNewPrivs(),
+		AddCapabilities:  securityContext.GetCapabilities().GetAddCapabilities(),
+		DropCapabilities: securityContext.GetCapabilities().GetDropCapabilities(),
+		MaskedPaths:      securityContext.GetMaskedPaths(),
+		ReadonlyPaths:    securityContext.GetReadonlyPaths(),
+
+		Seccomp:            seccomp,
+		Apparmor:           apparmor,
+		SeccompProfileRoot: s.seccompProfileRoot,
+
+		CgroupsPath: cgroupsPath,
+		Resources:   toResources(config.GetLinux().GetResources()),
+		OOMScoreAdj: config.GetLinux().GetResources().GetOomScoreAdj(),
+
+		Namespaces: namespaces,
+	}, nil
+}
+
+// toResources converts the resources of CRI. Nil means no limit.
+func toResources(r *runtimeapi.LinuxContainerResources) *oci.Resources {
+	if r == nil {
+		return nil
+	}
+	hugepageLimits := make([]oci.HugepageLimit, 0, len(r.GetHugepageLimits()))
+	for _, l := range r.GetHugepageLimits() {
+		hugepageLimits = append(hugepageLimits, oci.HugepageLimit{
+			PageSize: l.GetPageSize(),
+			Limit:    l.GetLimit(),
+		})
+	}
+	return &oci.Resources{
+		CPUPeriod:       r.GetCpuPeriod(),
+		CPUQuota:        r.GetCpuQuota(),
+		CPUShares:       r.GetCpuShares(),
+		CpusetCpus:      r.GetCpusetCpus(),
+		CpusetMems:      r.GetCpusetMems(),
+		MemoryLimit:     r.GetMemoryLimitInBytes(),
+		MemorySwapLimit: r.GetMemorySwapLimitInBytes(),
+		HugepageLimits:  hugepageLimits,
+		Unified:         r.GetUnified(),
+	}
+}
+
+// securityProfile converts the seccomp or AppArmor profile of CRI. If the
+// profile is not set, the deprecated one in the forms of "runtime/default",
+// "docker/default", "unconfined" and "localhost/<ref>" is used. Neither being
+// set means unconfined.
+func securityProfile(profile *runtimeapi.SecurityProfile, deprecated string) (oci.SecurityProfile, error) {
+	if profile != nil {
+		switch profile.GetProfileType() {
+		case runtimeapi.SecurityProfile_RuntimeDefault:
+			return oci.SecurityProfile{Type: oci.RuntimeDefault}, nil
+		case runtimeapi.SecurityProfile_Unconfined:
+			return oci.SecurityProfile{Type: oci.Unconfined}, nil
+		case runtimeapi.SecurityProfile_Localhost:
+			return oci.SecurityProfile{
+				Type:         oci.Localhost,
+				LocalhostRef: profile.GetLocalhostRef(),
+			}, nil
+		}
+		return oci.SecurityProfile{}, fmt.Errorf("unknown profile type [%s]", profile.GetProfileType())
+	}
+	switch {
+	case deprecated == "" || deprecated == "unconfined":
+		return oci.SecurityProfile{Type: oci.Unconfined}, nil
+	case deprecated == "runtime/default" || deprecated == "docker/default":
+		return oci.SecurityProfile{Type: oci.RuntimeDefault}, nil
+	case strings.HasPrefix(deprecated, "localhost/"):
+		return oci.SecurityProfile{
+			Type:         oci.Localhost,
+			LocalhostRef: strings.TrimPrefix(deprecated, "localhost/"),
+		}, nil
+	}
+	return oci.SecurityProfile{}, fmt.Errorf("unknown profile [%s]", deprecated)
+}
+
+// selinuxLabels returns the process and mount labels if the options are
+// given. Both are empty on hosts where SELinux is disabled.
+func selinuxLabels(opts *runtimeapi.SELinuxOption) (string, string, error) {
+	if opts == nil {
+		return "", "", nil
+	}
+	var labels []string
+	for k, v := range map[string]string{
+		"user":  opts.GetUser(),
+		"role":  opts.GetRole(),
+		"type":  opts.GetType(),
+		"level": opts.GetLevel(),
+	} {
+		if v != "" {
+			labels = append(labels, k+":"+v)
+		}
+	}
+	processLabel, mountLabel, err := label.InitLabels(labels)
+	if err != nil {
+		return "", "", errors.Wrap(err, "cannot init SELinux labels")
+	}
+	return processLabel, mountLabel, nil
+}
+
+// unixNano returns t in nanoseconds as CRI expects. Zero time is returned
+// as 0.
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
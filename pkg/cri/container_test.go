@@ -0,0 +1,53 @@
+package cri
+
+import (
+	"testing"
+
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+func TestExitMessage(t *testing.T) {
+	tests := []struct {
+		code int32
+		want string
+	}{
+		{1, "container exited with code 1"},
+		{128, "container exited with code 128"},
+		{137, "container was killed by SIGKILL, exit code 137"},
+		{143, "container was killed by SIGTERM, exit code 143"},
+		{255, "container exited with code 255"},
+	}
+	for _, tt := range tests {
+		if got := exitMessage(tt.code); got != tt.want {
+			t.Errorf("exitMessage(%d) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestToResources(t *testing.T) {
+	if r := toResources(nil); r != nil {
+		t.Errorf("toResources(nil) = %+v", r)
+	}
+	r := toResources(&runtimeapi.LinuxContainerResources{
+		CpuPeriod:              100000,
+		CpuQuota:               50000,
+		CpuShares:              512,
+		CpusetCpus:             "0-1",
+		MemoryLimitInBytes:     1 << 20,
+		MemorySwapLimitInBytes: 2 << 20,
+		HugepageLimits:         []*runtimeapi.HugepageLimit{{PageSize: "2MB", Limit: 4 << 20}},
+		Unified:                map[string]string{"memory.high": "max"},
+	})
+	if r.CPUPeriod != 100000 || r.CPUQuota != 50000 || r.CPUShares != 512 || r.CpusetCpus != "0-1" {
+		t.Errorf("cpu of resources = %+v", r)
+	}
+	if r.MemoryLimit != 1<<20 || r.MemorySwapLimit != 2<<20 {
+		t.Errorf("memory of resources = %+v", r)
+	}
+	if len(r.HugepageLimits) != 1 || r.HugepageLimits[0].PageSize != "2MB" || r.HugepageLimits[0].Limit != 4<<20 {
+		t.Errorf("hugepage limits = %+v", r.HugepageLimits)
+	}
+	if r.Unified["memory.high"] != "max" {
+		t.Errorf("unified = %v", r.Unified)
+	}
+}
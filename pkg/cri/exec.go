@@ -0,0 +1,77 @@
+package cri
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"simpleconman/pkg/container"
+	"simpleconman/pkg/oci"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+// maxExecSyncOutput limits each of stdout and stderr of ExecSync. Output
+// over the limit is dropped.
+const maxExecSyncOutput = 16 * 1024 * 1024
+
+// limitedBuffer is a buffer which drops what is written over its limit.
+type limitedBuffer struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if remain := b.limit - b.buf.Len(); remain < len(p) {
+		if remain > 0 {
+			b.buf.Write(p[:remain])
+		}
+		// pretend the whole is written not to fail the process
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+// ExecSync runs a command in the running container, and returns its output
+// and exit code. The command is killed if it does not exit in the timeout.
+func (s *runtimeService) ExecSync(ctx context.Context, r *runtimeapi.ExecSyncRequest) (*runtimeapi.ExecSyncResponse, error) {
+	cont, handle, err := s.containerGetter.Get(container.Id(r.GetContainerId()))
+	if err != nil {
+		return nil, err
+	}
+	if cont.Status != container.Running {
+		return nil, fmt.Errorf("cannot exec in container. container status [%s]", cont.Status.String())
+	}
+	process, err := oci.ExecProcess(handle.RuntimeSpecFile(), r.GetCmd(), false)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.GetTimeout() > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(r.GetTimeout())*time.Second)
+		defer cancel()
+	}
+	stdout := &limitedBuffer{limit: maxExecSyncOutput}
+	stderr := &limitedBuffer{limit: maxExecSyncOutput}
+	exitCode, err := s.runtime.Exec(ctx, handle, process, oci.Stdio{
+		Stdout: stdout,
+		Stderr: stderr,
+	})
+	if errors.Is(err, context.DeadlineExceeded) {
+		// kubelet tells probe timeout by the code
+		return nil, status.Errorf(codes.DeadlineExceeded,
+			"command %v timed out after %ds", r.GetCmd(), r.GetTimeout())
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot exec in container")
+	}
+	return &runtimeapi.ExecSyncResponse{
+		Stdout:   stdout.buf.Bytes(),
+		Stderr:   stderr.buf.Bytes(),
+		ExitCode: int32(exitCode),
+	}, nil
+}
@@ -0,0 +1,91 @@
+package cri
+
+import (
+	"simpleconman/pkg/container"
+	"simpleconman/pkg/sandbox"
+	"strings"
+
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+// containerFilter selects containers the way CRI filters do. Empty criteria
+// match every container.
+type containerFilter struct {
+	// id matches the container id or its prefix
+	id            string
+	state         *runtimeapi.ContainerStateValue
+	podSandboxId  string
+	labelSelector map[string]string
+}
+
+func newContainerFilter(f *runtimeapi.ContainerFilter) *containerFilter {
+	return &containerFilter{
+		id:            f.GetId(),
+		state:         f.GetState(),
+		podSandboxId:  f.GetPodSandboxId(),
+		labelSelector: f.GetLabelSelector(),
+	}
+}
+
+func newContainerStatsFilter(f *runtimeapi.ContainerStatsFilter) *containerFilter {
+	return &containerFilter{
+		id:            f.GetId(),
+		podSandboxId:  f.GetPodSandboxId(),
+		labelSelector: f.GetLabelSelector(),
+	}
+}
+
+// matchHandle matches the criteria known without asking the OCI runtime.
+func (f *containerFilter) matchHandle(handle *container.Handle) bool {
+	if f.id != "" && !strings.HasPrefix(handle.Id().String(), f.id) {
+		return false
+	}
+	metadata := handle.Metadata()
+	if f.podSandboxId != "" && f.podSandboxId != metadata.PodSandboxId {
+		return false
+	}
+	for k, v := range f.labelSelector {
+		if label, ok := metadata.Labels[k]; !ok || label != v {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *containerFilter) matchState(cont *container.Instance) bool {
+	return f.state == nil || f.state.GetState() == Status(cont.Status)
+}
+
+// sandboxFilter selects sandboxes the way CRI filters do. Empty criteria
+// match every sandbox.
+type sandboxFilter struct {
+	// id matches the sandbox id or its prefix
+	id            string
+	state         *runtimeapi.PodSandboxStateValue
+	labelSelector map[string]string
+}
+
+func newSandboxFilter(f *runtimeapi.PodSandboxFilter) *sandboxFilter {
+	return &sandboxFilter{
+		id:            f.GetId(),
+		state:         f.GetState(),
+		labelSelector: f.GetLabelSelector(),
+	}
+}
+
+func (f *sandboxFilter) matchHandle(handle *sandbox.Handle) bool {
+	if f.id != "" && !strings.HasPrefix(handle.Id().String(), f.id) {
+		return false
+	}
+	labels := handle.Metadata().Labels
+	for k, v := range f.labelSelector {
+		if label, ok := labels[k]; !ok || label != v {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *sandboxFilter) matchStatus(status sandbox.Status) bool {
+	return f.state == nil || f.state.GetState() == SandboxStatus(status)
+}
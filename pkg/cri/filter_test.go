@@ -0,0 +1,183 @@
+package cri
+
+import (
+	"path"
+	"simpleconman/pkg/container"
+	"simpleconman/pkg/sandbox"
+	"testing"
+
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+func newTestContainer(t *testing.T, id string, metadata container.Metadata) *container.Handle {
+	t.Helper()
+	dir := t.TempDir()
+	file := func(name string) container.BaseFileFn {
+		return func(id container.Id) string {
+			return path.Join(dir, name, id.String())
+		}
+	}
+	handle, err := container.NewHandle(nil, container.Id(id), func(id container.Id) string {
+		return path.Join(dir, "containers", id.String())
+	}, file("logs"), file("attach"), file("exits"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := handle.SetMetadata(metadata); err != nil {
+		t.Fatal(err)
+	}
+	return handle
+}
+
+func TestContainerFilterMatchHandle(t *testing.T) {
+	handle := newTestContainer(t, "abcdef", container.Metadata{
+		Name:         "app",
+		PodSandboxId: "pod1",
+		Labels:       map[string]string{"app": "web", "tier": "front"},
+	})
+	tests := []struct {
+		name   string
+		filter *runtimeapi.ContainerFilter
+		want   bool
+	}{
+		{"nil filter", nil, true},
+		{"empty filter", &runtimeapi.ContainerFilter{}, true},
+		{"full id", &runtimeapi.ContainerFilter{Id: "abcdef"}, true},
+		{"id prefix", &runtimeapi.ContainerFilter{Id: "abc"}, true},
+		{"other id", &runtimeapi.ContainerFilter{Id: "bcd"}, false},
+		{"sandbox", &runtimeapi.ContainerFilter{PodSandboxId: "pod1"}, true},
+		{"other sandbox", &runtimeapi.ContainerFilter{PodSandboxId: "pod2"}, false},
+		{"label", &runtimeapi.ContainerFilter{
+			LabelSelector: map[string]string{"app": "web"},
+		}, true},
+		{"all labels", &runtimeapi.ContainerFilter{
+			LabelSelector: map[string]string{"app": "web", "tier": "front"},
+		}, true},
+		{"other label value", &runtimeapi.ContainerFilter{
+			LabelSelector: map[string]string{"app": "db"},
+		}, false},
+		{"missing label", &runtimeapi.ContainerFilter{
+			LabelSelector: map[string]string{"env": "prod"},
+		}, false},
+		{"all criteria", &runtimeapi.ContainerFilter{
+			Id:            "ab",
+			PodSandboxId:  "pod1",
+			LabelSelector: map[string]string{"tier": "front"},
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newContainerFilter(tt.filter).matchHandle(handle); got != tt.want {
+				t.Errorf("matchHandle() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContainerFilterMatchState(t *testing.T) {
+	state := func(s runtimeapi.ContainerState) *runtimeapi.ContainerFilter {
+		return &runtimeapi.ContainerFilter{State: &runtimeapi.ContainerStateValue{State: s}}
+	}
+	tests := []struct {
+		name   string
+		filter *runtimeapi.ContainerFilter
+		status container.Status
+		want   bool
+	}{
+		{"no state", &runtimeapi.ContainerFilter{}, container.Stopped, true},
+		{"created", state(runtimeapi.ContainerState_CONTAINER_CREATED), container.Created, true},
+		{"initial is created", state(runtimeapi.ContainerState_CONTAINER_CREATED), container.Initial, true},
+		{"running", state(runtimeapi.ContainerState_CONTAINER_RUNNING), container.Running, true},
+		{"not running", state(runtimeapi.ContainerState_CONTAINER_RUNNING), container.Stopped, false},
+		{"exited", state(runtimeapi.ContainerState_CONTAINER_EXITED), container.Stopped, true},
+		{"unknown", state(runtimeapi.ContainerState_CONTAINER_UNKNOWN), container.Unknown, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cont := &container.Instance{Status: tt.status}
+			if got := newContainerFilter(tt.filter).matchState(cont); got != tt.want {
+				t.Errorf("matchState() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContainerStatsFilter(t *testing.T) {
+	handle := newTestContainer(t, "abcdef", container.Metadata{
+		PodSandboxId: "pod1",
+		Labels:       map[string]string{"app": "web"},
+	})
+	tests := []struct {
+		name   string
+		filter *runtimeapi.ContainerStatsFilter
+		want   bool
+	}{
+		{"nil filter", nil, true},
+		{"id prefix", &runtimeapi.ContainerStatsFilter{Id: "abcd"}, true},
+		{"other sandbox", &runtimeapi.ContainerStatsFilter{PodSandboxId: "pod2"}, false},
+		{"other label value", &runtimeapi.ContainerStatsFilter{
+			LabelSelector: map[string]string{"app": "db"},
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newContainerStatsFilter(tt.filter).matchHandle(handle); got != tt.want {
+				t.Errorf("matchHandle() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSandboxFilter(t *testing.T) {
+	dir := t.TempDir()
+	file := func(id container.Id) string {
+		return path.Join(dir, "files", id.String())
+	}
+	handle, err := sandbox.NewHandle("abcdef", func(id sandbox.Id) string {
+		return path.Join(dir, "sandboxes", id.String())
+	}, file, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := handle.SetMetadata(sandbox.Metadata{
+		Labels: map[string]string{"app": "web"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	state := func(s runtimeapi.PodSandboxState) *runtimeapi.PodSandboxStateValue {
+		return &runtimeapi.PodSandboxStateValue{State: s}
+	}
+	tests := []struct {
+		name   string
+		filter *runtimeapi.PodSandboxFilter
+		status sandbox.Status
+		want   bool
+	}{
+		{"nil filter", nil, sandbox.NotReady, true},
+		{"id prefix", &runtimeapi.PodSandboxFilter{Id: "abc"}, sandbox.Ready, true},
+		{"other id", &runtimeapi.PodSandboxFilter{Id: "xyz"}, sandbox.Ready, false},
+		{"label", &runtimeapi.PodSandboxFilter{
+			LabelSelector: map[string]string{"app": "web"},
+		}, sandbox.Ready, true},
+		{"missing label", &runtimeapi.PodSandboxFilter{
+			LabelSelector: map[string]string{"env": "prod"},
+		}, sandbox.Ready, false},
+		{"ready", &runtimeapi.PodSandboxFilter{
+			State: state(runtimeapi.PodSandboxState_SANDBOX_READY),
+		}, sandbox.Ready, true},
+		{"not ready", &runtimeapi.PodSandboxFilter{
+			State: state(runtimeapi.PodSandboxState_SANDBOX_READY),
+		}, sandbox.NotReady, false},
+		{"initial is not ready", &runtimeapi.PodSandboxFilter{
+			State: state(runtimeapi.PodSandboxState_SANDBOX_NOTREADY),
+		}, sandbox.Initial, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newSandboxFilter(tt.filter)
+			if got := f.matchHandle(handle) && f.matchStatus(tt.status); got != tt.want {
+				t.Errorf("match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
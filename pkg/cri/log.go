@@ -0,0 +1,28 @@
+package cri
+
+import (
+	"context"
+	shim "simpleconman/runtime"
+
+	"github.com/pkg/errors"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+// ReopenContainerLog asks the shim of the running container to reopen the
+// log file, which kubelet has rotated.
+func (s *runtimeService) ReopenContainerLog(ctx context.Context,
+	r *runtimeapi.ReopenContainerLogRequest) (*runtimeapi.ReopenContainerLogResponse, error) {
+	handle, err := s.runningContainer(r.GetContainerId())
+	if err != nil {
+		return nil, err
+	}
+	client, err := shim.Dial(ctx, s.runDir, handle.Id().String())
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	if err := client.ReopenLog(ctx); err != nil {
+		return nil, errors.Wrap(err, "cannot reopen container log")
+	}
+	return &runtimeapi.ReopenContainerLogResponse{}, nil
+}
@@ -2,57 +2,169 @@ package cri
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"os"
 	"path"
+	"simpleconman/pkg/cgroups"
 	"simpleconman/pkg/container"
+	"simpleconman/pkg/network"
 	"simpleconman/pkg/oci"
+	"simpleconman/pkg/sandbox"
+	shim "simpleconman/runtime"
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
 	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+	"k8s.io/kubelet/pkg/cri/streaming"
 )
 
 type runtimeService struct {
+	// RPCs which are not supported yet answer Unimplemented
+	runtimeapi.UnimplementedRuntimeServiceServer
+
+	// config is what the service is created with. It is reported as is.
+	config Config
+
 	runtime         oci.Runtime
 	containerGetter container.Getter
 
 	rootDir   string
+	rootfsDir string
 	logDir    string
 	exitDir   string
 	attachDir string
+	// runDir is where the shims serve the RPC sockets
+	runDir string
 
 	timeout time.Duration
 
+	// seccompProfileRoot is the dir of the localhost seccomp profiles
+	seccompProfileRoot string
+	// cgroupDriver must be the same as the one of kubelet and runc
+	cgroupDriver cgroups.Driver
+
 	store container.Store
+	names *container.NameIndex
+
+	sandboxes    sandbox.Store
+	sandboxNames *sandbox.NameIndex
+	// pauseCommand is run by the pause container of the sandboxes. It is
+	// defaultPauseCommand if empty.
+	pauseCommand []string
+	// network sets up the network of the sandboxes. It is optional, and
+	// the sandbox has the network namespace of its own without it.
+	network *network.Manager
+
+	// images gives the image config defaults to the containers. It is
+	// optional.
+	images ImageConfigGetter
+	// diskUsage caches the writable layer usage of the containers
+	diskUsage *diskUsageCache
+
+	// stream serves the streams of Exec, Attach and PortForward
+	stream streaming.Server
+
+	// rolledBack is called with the rollback of every failed creation, so
+	// tests see the undone steps
+	rolledBack func(r *rollback)
 }
 
-// CreateContainer creates a new container in specified PodSandbox.
-// FIXME: currently this method is not atomic
+type ImageConfigGetter interface {
+	ImageConfig(image string) (*oci.ImageConfig, error)
+}
+
+// CreateContainer creates a new container in specified PodSandbox. Every
+// completed step is undone in reverse order if any of later steps fails, so
+// failed creation leaves nothing behind.
 func (s *runtimeService) CreateContainer(ctx context.Context,
-	req *runtimeapi.CreateContainerRequest) (*runtimeapi.CreateContainerResponse, error) {
+	req *runtimeapi.CreateContainerRequest) (_ *runtimeapi.CreateContainerResponse, retErr error) {
+	sb, sbState, err := s.readySandbox(sandbox.Id(req.GetPodSandboxId()))
+	if err != nil {
+		return nil, err
+	}
+	logFile := func(id container.Id) string {
+		// kubelet expects logs at the path it asks for
+		logDir := sb.Metadata().LogDirectory
+		logPath := req.GetConfig().GetLogPath()
+		if logDir != "" && logPath != "" {
+			return path.Join(logDir, logPath)
+		}
+		return s.logFile(id)
+	}
+	metadata := container.Metadata{
+		Name:               req.GetConfig().GetMetadata().GetName(),
+		Attempt:            req.GetConfig().GetMetadata().GetAttempt(),
+		PodSandboxId:       req.GetPodSandboxId(),
+		Image:              req.GetConfig().GetImage().GetImage(),
+		UserSpecifiedImage: req.GetConfig().GetImage().GetUserSpecifiedImage(),
+		Labels:             req.GetConfig().GetLabels(),
+		Annotations:        req.GetConfig().GetAnnotations(),
+		Mounts:             toMounts(req.GetConfig().GetMounts()),
+	}
+	id := container.GenId()
+	undo := &rollback{target: fmt.Sprintf("container [%s]", id)}
+	defer func() {
+		if retErr != nil {
+			s.rollBack(undo)
+		}
+	}()
+	if err := s.names.Reserve(metadata.FullName(), id); err != nil {
+		return nil, err
+	}
+	undo.add("release name", func() error {
+		s.names.Release(metadata.FullName(), id)
+		return nil
+	})
+
 	handle, err := container.NewHandle(
 		s.containerGetter,
+		id,
 		s.containerDir,
-		s.logFile,
+		logFile,
 		s.attachFile,
 		s.exitFile,
 	)
 	if err != nil {
 		return nil, err
 	}
-	spec, err := oci.NewSpec(oci.SpecOptions{
-		Command:      req.GetConfig().GetCommand(),
-		Args:         req.GetConfig().GetArgs(),
-		RootPath:     handle.RootfsDir(),
-		RootReadonly: req.GetConfig().GetLinux().GetSecurityContext().GetReadonlyRootfs(),
-	})
+	undo.add("remove files", handle.Remove)
+
+	metadata.LogPath = handle.LogFile()
+	if err := handle.SetMetadata(metadata); err != nil {
+		return nil, err
+	}
+	if err := handle.CopyRootfs(s.rootfsDir); err != nil {
+		return nil, err
+	}
+	var image *oci.ImageConfig
+	if s.images != nil {
+		image, err = s.images.ImageConfig(metadata.Image)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot get image config")
+		}
+	}
+	opts, err := s.specOptions(req, handle, image, sb, sbState)
+	if err != nil {
+		return nil, err
+	}
+	spec, err := oci.NewSpec(opts)
 	if err != nil {
 		return nil, err
 	}
-	if err := handle.Bundle(spec, s.rootDir); err != nil {
+	if err := handle.Bundle(spec); err != nil {
 		return nil, err
 	}
 
+	// shim and runc container may be left even if the creation fails halfway
+	undo.add("kill shim", func() error {
+		return oci.KillShim(s.runDir, handle)
+	})
+	undo.add("delete container", func() error {
+		return s.runtime.DeleteContainer(handle)
+	})
 	_, err = s.runtime.CreateContainer(handle, req.GetConfig().GetStdin(),
 		req.GetConfig().GetStdinOnce(), s.timeout)
 	if err != nil {
@@ -69,6 +181,98 @@ func (s *runtimeService) CreateContainer(ctx context.Context,
 	}, nil
 }
 
+// restore rebuilds the sandbox and container stores from their dirs, and
+// cleans up the ones which cannot be restored.
+func (s *runtimeService) restore() error {
+	if err := s.restoreSandboxes(); err != nil {
+		return err
+	}
+	store, err := container.NewPersistentStore(
+		s.containersDir(),
+		s.runtime,
+		s.containerDir,
+		s.logFile,
+		s.attachFile,
+		s.exitFile,
+	)
+	if err != nil {
+		return err
+	}
+	names := container.NewNameIndex()
+	iter := store.Iter()
+	for iter.HasNext() {
+		handle := iter.Next()
+		if err := names.Reserve(handle.Metadata().FullName(), handle.Id()); err != nil {
+			return err
+		}
+	}
+	for _, handle := range store.Orphans() {
+		logrus.Infof("clean up orphan container [%s]", handle.Id())
+		if err := oci.KillShim(s.runDir, handle); err != nil {
+			logrus.WithError(err).Warnf("cannot kill shim of orphan container [%s]", handle.Id())
+		}
+		if err := s.runtime.DeleteContainer(handle); err != nil {
+			logrus.WithError(err).Warnf("cannot delete orphan container [%s]", handle.Id())
+		}
+		if err := handle.Remove(); err != nil {
+			logrus.WithError(err).Warnf("cannot remove orphan container [%s]", handle.Id())
+		}
+	}
+	s.store = store
+	s.names = names
+	return nil
+}
+
+func (s *runtimeService) restoreSandboxes() error {
+	store, err := sandbox.NewPersistentStore(
+		s.sandboxesDir(),
+		s.runtime,
+		s.sandboxDir,
+		s.attachFile,
+		s.exitFile,
+	)
+	if err != nil {
+		return err
+	}
+	names := sandbox.NewNameIndex()
+	iter := store.Iter()
+	for iter.HasNext() {
+		handle := iter.Next()
+		if err := names.Reserve(handle.Metadata().FullName(), handle.Id()); err != nil {
+			return err
+		}
+	}
+	// broken network is only reported, kubelet finds it by the pod probes
+	for iter := store.Iter(); s.network != nil && iter.HasNext(); {
+		handle := iter.Next()
+		state, err := handle.State()
+		if err != nil || state.NetNSPath == "" || state.Status != sandbox.Ready {
+			continue
+		}
+		if err := s.network.Check(context.Background(), podInfo(handle), state.NetNSPath); err != nil {
+			logrus.WithError(err).Warnf("network of sandbox [%s] is broken", handle.Id())
+		}
+	}
+	for _, handle := range store.Orphans() {
+		logrus.Infof("clean up orphan sandbox [%s]", handle.Id())
+		if err := s.teardownNetwork(context.Background(), handle); err != nil {
+			logrus.WithError(err).Warnf("cannot tear down network of orphan sandbox [%s]", handle.Id())
+		}
+		if err := oci.KillShim(s.runDir, handle.Pause()); err != nil {
+			logrus.WithError(err).Warnf("cannot kill shim of orphan sandbox [%s]", handle.Id())
+		}
+		if err := s.runtime.DeleteContainer(handle.Pause()); err != nil {
+			logrus.WithError(err).Warnf("cannot delete pause container of orphan sandbox [%s]", handle.Id())
+		}
+		if err := handle.Remove(); err != nil {
+			logrus.WithError(err).Warnf("cannot remove orphan sandbox [%s]", handle.Id())
+		}
+	}
+	s.sandboxes = store
+	s.sandboxNames = names
+	return nil
+}
+
 func (s *runtimeService) containerDir(id container.Id) string {
 	return path.Join(s.containersDir(), id.String())
 }
@@ -116,7 +320,16 @@ func (s *runtimeService) StartContainer(ctx context.Context,
 		if err != nil {
 			return nil, err
 		}
-		if cont.Status == container.Running {
+		// the container which has already exited has started as well
+		if cont.Status == container.Running || cont.Status == container.Stopped {
+			cgroupPath, cgroupPaths, err := containerCgroupPath(handle, cont)
+			if err != nil {
+				logrus.WithError(err).Warnf("cannot get cgroup of container [%s], it has no stats", id)
+				break
+			}
+			if err := handle.SetCgroupPath(cgroupPath, cgroupPaths); err != nil {
+				return nil, err
+			}
 			break
 		}
 		if cont.Status != container.Created {
@@ -129,37 +342,196 @@ func (s *runtimeService) StartContainer(ctx context.Context,
 	return &runtimeapi.StartContainerResponse{}, nil
 }
 
+// containerCgroupPath returns the cgroup of the started container, and the
+// cgroups by controller on cgroup v1. The cgroup of the container whose
+// process has already exited is resolved from the OCI runtime spec, which
+// puts it at the same path in every hierarchy.
+func containerCgroupPath(handle *container.Handle, cont *container.Instance) (string, map[string]string, error) {
+	if cont.Pid != 0 {
+		cgroupPath, cgroupPaths, err := cgroups.PidPath(int(cont.Pid))
+		if err == nil {
+			return cgroupPath, cgroupPaths, nil
+		}
+		logrus.WithError(err).Debugf("cannot get cgroup of container [%s] from its process", handle.Id())
+	}
+	cgroupsPath, err := oci.CgroupsPath(handle.RuntimeSpecFile())
+	if err != nil {
+		return "", nil, err
+	}
+	cgroupPath, err := cgroups.HierarchyPath(cgroupsPath)
+	return cgroupPath, nil, err
+}
+
 // StopContainer stops a running container with a grace period (i.e., timeout).
 func (s *runtimeService) StopContainer(ctx context.Context, r *runtimeapi.StopContainerRequest) (*runtimeapi.StopContainerResponse, error) {
-	return nil, nil
+	cont, handle, err := s.containerGetter.Get(container.Id(r.ContainerId))
+	if err != nil {
+		return nil, err
+	}
+	if err := s.stopContainer(ctx, cont, handle, r.Timeout); err != nil {
+		return nil, err
+	}
+	return &runtimeapi.StopContainerResponse{}, nil
 }
 
-// RemoveContainer removes the container.
+// stopContainer sends the stop signal to the container, and SIGKILL if it
+// does not stop in timeout seconds.
+func (s *runtimeService) stopContainer(ctx context.Context, cont *container.Instance,
+	handle *container.Handle, timeout int64) error {
+	id := handle.Id()
+	// stopping already stopped container must not be an error
+	if !cont.CanStop() {
+		switch cont.Status {
+		case container.Stopped:
+			return s.recordExit(handle)
+		case container.Unknown:
+			return errors.Errorf("container [%s] is in unknown state, its shim is not running", id)
+		}
+		return nil
+	}
+
+	if timeout > 0 {
+		signal, err := oci.StopSignal(handle.RuntimeSpecFile())
+		if err != nil {
+			return err
+		}
+		if err := s.runtime.Kill(handle, signal, false); err != nil {
+			logrus.WithError(err).Warnf("cannot send %s to container [%s]", unix.SignalName(signal), id)
+		}
+		err = s.waitExit(ctx, handle, time.Duration(timeout)*time.Second)
+		if err == nil {
+			return s.recordExit(handle)
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		logrus.WithError(err).Infof("container [%s] did not stop in grace period, escalate to SIGKILL", id)
+	}
+
+	if err := s.runtime.Kill(handle, unix.SIGKILL, true); err != nil {
+		logrus.WithError(err).Warnf("cannot send SIGKILL to container [%s]", id)
+	}
+	if err := s.waitExit(ctx, handle, s.timeout); err != nil {
+		return errors.Wrap(err, "container is not stopped after SIGKILL")
+	}
+	return s.recordExit(handle)
+}
+
+// waitExit waits until the shim has written the exit file of the container.
+func (s *runtimeService) waitExit(ctx context.Context, handle *container.Handle, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	client, err := shim.Dial(ctx, s.runDir, handle.Id().String())
+	if err != nil {
+		return errors.Wrapf(err, "shim of container [%s] is not running", handle.Id())
+	}
+	defer client.Close()
+	if _, err := client.Wait(ctx); err != nil {
+		return errors.Wrap(err, "cannot wait for container exit")
+	}
+	return nil
+}
+
+// recordExit moves the container to stopped status with the exit code written
+// by the shim.
+func (s *runtimeService) recordExit(handle *container.Handle) error {
+	state, err := handle.State()
+	if err != nil {
+		return err
+	}
+	if state.Status == container.Stopped {
+		return nil
+	}
+	exitCode, finishedAt, err := handle.ExitStatus()
+	if os.IsNotExist(errors.Cause(err)) {
+		// the shim is gone without writing the exit file
+		logrus.Warnf("container [%s] exited without exit file", handle.Id())
+		return handle.Stopped(container.UnknownExitCode, time.Now())
+	}
+	if err != nil {
+		return err
+	}
+	return handle.Stopped(exitCode, finishedAt)
+}
+
+// RemoveContainer removes the container. If the container is running,
+// the container must be forcibly removed.
 func (s *runtimeService) RemoveContainer(ctx context.Context, r *runtimeapi.RemoveContainerRequest) (*runtimeapi.RemoveContainerResponse, error) {
-	return nil, nil
+	id := container.Id(r.ContainerId)
+	handle, err := s.store.Get(id)
+	// removing already removed container must not be an error
+	if errors.Is(err, container.ErrNotFound) {
+		return &runtimeapi.RemoveContainerResponse{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the container in unknown state, whose shim is gone, and the container
+	// whose state cannot be read are not stopped gracefully. Deleting them
+	// from runc kills whatever is still running.
+	cont, err := s.runtime.Container(handle)
+	if err != nil {
+		logrus.WithError(err).Warnf("cannot get state of container [%s], delete it forcibly", id)
+	} else if cont.CanStop() {
+		if _, err := s.StopContainer(ctx, &runtimeapi.StopContainerRequest{
+			ContainerId: r.ContainerId,
+		}); err != nil {
+			return nil, errors.Wrap(err, "cannot stop container before removal")
+		}
+	}
+
+	if err := s.runtime.DeleteContainer(handle); err != nil {
+		return nil, errors.Wrap(err, "cannot delete container from runtime")
+	}
+	if err := handle.Remove(); err != nil {
+		return nil, err
+	}
+	s.diskUsage.forget(handle.RootfsDir())
+	if err := s.store.Delete(id); err != nil {
+		return nil, err
+	}
+	s.names.Release(handle.Metadata().FullName(), id)
+	return &runtimeapi.RemoveContainerResponse{}, nil
 }
 
 // ListContainers lists all containers by filters.
 func (s *runtimeService) ListContainers(ctx context.Context, r *runtimeapi.ListContainersRequest) (*runtimeapi.ListContainersResponse, error) {
+	filter := newContainerFilter(r.GetFilter())
 	iter := s.store.Iter()
 	result := []*runtimeapi.Container{}
 	for iter.HasNext() {
 		handle := iter.Next()
+		if !filter.matchHandle(handle) {
+			continue
+		}
 		cont, err := s.runtime.Container(handle)
 		if err != nil {
-			return nil, err
+			// one broken container must not hide the others
+			logrus.WithError(err).Warnf("cannot get state of container [%s]", handle.Id())
+			cont = &container.Instance{
+				Id:       handle.Id(),
+				Status:   container.Unknown,
+				Metadata: handle.Metadata(),
+			}
+		}
+		if !filter.matchState(cont) {
+			continue
 		}
 		result = append(result, &runtimeapi.Container{
 			Id:           handle.Id().String(),
-			PodSandboxId: "",
-			Image: &runtimeapi.ImageSpec{
-				Image:       "",
-				Annotations: nil,
+			PodSandboxId: cont.Metadata.PodSandboxId,
+			Metadata: &runtimeapi.ContainerMetadata{
+				Name:    cont.Metadata.Name,
+				Attempt: cont.Metadata.Attempt,
 			},
-			ImageRef:    "",
-			CreatedAt:   cont.CreatedAt.UTC().Unix(),
-			Labels:      nil,
-			Annotations: nil,
+			Image:       imageSpec(cont.Metadata),
+			ImageRef:    cont.Metadata.Image,
+			State:       Status(cont.Status),
+			CreatedAt:   unixNano(cont.CreatedAt),
+			Labels:      cont.Metadata.Labels,
+			Annotations: cont.Metadata.Annotations,
 		})
 	}
 	return &runtimeapi.ListContainersResponse{
@@ -167,27 +539,158 @@ func (s *runtimeService) ListContainers(ctx context.Context, r *runtimeapi.ListC
 	}, nil
 }
 
-// ContainerStatus returns the status of the container.
+// imageSpec returns the image of the container as kubelet asked for it.
+func imageSpec(metadata container.Metadata) *runtimeapi.ImageSpec {
+	return &runtimeapi.ImageSpec{
+		Image:              metadata.Image,
+		UserSpecifiedImage: metadata.UserSpecifiedImage,
+	}
+}
+
+// ContainerStatus returns status of the container. If the container is not
+// present, returns an error.
+func (s *runtimeService) ContainerStatus(ctx context.Context, r *runtimeapi.ContainerStatusRequest) (*runtimeapi.ContainerStatusResponse, error) {
+	cont, handle, err := s.containerGetter.Get(container.Id(r.ContainerId))
+	if err != nil {
+		return nil, err
+	}
+	reason, message, err := exitReason(cont, handle)
+	if err != nil {
+		return nil, err
+	}
+	status := &runtimeapi.ContainerStatus{
+		Id: handle.Id().String(),
+		Metadata: &runtimeapi.ContainerMetadata{
+			Name:    cont.Metadata.Name,
+			Attempt: cont.Metadata.Attempt,
+		},
+		State:       Status(cont.Status),
+		CreatedAt:   unixNano(cont.CreatedAt),
+		StartedAt:   unixNano(cont.StartedAt),
+		FinishedAt:  unixNano(cont.FinishedAt),
+		ExitCode:    cont.ExitCode,
+		Image:       imageSpec(cont.Metadata),
+		ImageRef:    cont.Metadata.Image,
+		Reason:      reason,
+		Message:     message,
+		Labels:      cont.Metadata.Labels,
+		Annotations: cont.Metadata.Annotations,
+		Mounts:      fromMounts(cont.Metadata.Mounts),
+		LogPath:     cont.Metadata.LogPath,
+	}
+	resp := &runtimeapi.ContainerStatusResponse{Status: status}
+	if !r.Verbose {
+		return resp, nil
+	}
+	info, err := s.verboseInfo(handle)
+	if err != nil {
+		return nil, err
+	}
+	resp.Info = info
+	return resp, nil
+}
+
+func (s *runtimeService) verboseInfo(handle *container.Handle) (map[string]string, error) {
+	state, err := s.runtime.RuntimeState(handle)
+	if err != nil {
+		return nil, err
+	}
+	shimPid, err := handle.ShimPid()
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(struct {
+		RuntimeState json.RawMessage `json:"runtimeState"`
+		ShimPid      int             `json:"shimPid"`
+	}{
+		RuntimeState: state,
+		ShimPid:      shimPid,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"info": string(b)}, nil
+}
+
+// UpdateContainerResources changes the resource limits of the created or
+// running container. The new limits are kept in the runtime spec as well, so
+// they are not lost on restart.
+func (s *runtimeService) UpdateContainerResources(ctx context.Context,
+	r *runtimeapi.UpdateContainerResourcesRequest) (*runtimeapi.UpdateContainerResourcesResponse, error) {
+	cont, handle, err := s.containerGetter.Get(container.Id(r.GetContainerId()))
+	if err != nil {
+		return nil, err
+	}
+	if !cont.CanUpdate() {
+		return nil, fmt.Errorf("cannot update resources of container. container status [%s]",
+			cont.Status.String())
+	}
+	if r.GetLinux() == nil {
+		return &runtimeapi.UpdateContainerResourcesResponse{}, nil
+	}
+	resources, err := toResources(r.GetLinux()).LinuxResources()
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid resources")
+	}
+	if err := s.runtime.UpdateContainer(handle, resources); err != nil {
+		return nil, errors.Wrap(err, "cannot update resources of container")
+	}
+	updated, err := oci.UpdateResources(handle.RuntimeSpecFile(), resources)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot persist resources of container")
+	}
+	metadata := handle.Metadata()
+	metadata.Resources = updated
+	if err := handle.SetMetadata(metadata); err != nil {
+		return nil, errors.Wrap(err, "cannot persist resources of container")
+	}
+	return &runtimeapi.UpdateContainerResourcesResponse{}, nil
+}
+
+// ContainerStats returns stats of the container. If the container does not
+// exist, the call returns an error.
 func (s *runtimeService) ContainerStats(ctx context.Context, r *runtimeapi.ContainerStatsRequest) (*runtimeapi.ContainerStatsResponse, error) {
 	handle, err := s.store.Get(container.Id(r.ContainerId))
 	if err != nil {
 		return nil, err
 	}
-	_, err = s.runtime.Container(handle)
+	cont, err := s.runtime.Container(handle)
 	if err != nil {
 		return nil, err
 	}
-	return &runtimeapi.ContainerStatsResponse{
-		Stats: &runtimeapi.ContainerStats{
-			Attributes: &runtimeapi.ContainerAttributes{
-				Id: handle.Id().String(),
-			},
-			Cpu: &runtimeapi.CpuUsage{
-				Timestamp: time.Now().UTC().Unix(),
-			},
-			Memory: &runtimeapi.MemoryUsage{
-				Timestamp: time.Now().UTC().Unix(),
-			},
-		},
+	stats, err := containerStats(cont, handle, s.diskUsage)
+	if err != nil {
+		return nil, err
+	}
+	return &runtimeapi.ContainerStatsResponse{Stats: stats}, nil
+}
+
+// ListContainerStats returns stats of all running containers.
+func (s *runtimeService) ListContainerStats(ctx context.Context, r *runtimeapi.ListContainerStatsRequest) (*runtimeapi.ListContainerStatsResponse, error) {
+	filter := newContainerStatsFilter(r.GetFilter())
+	iter := s.store.Iter()
+	result := []*runtimeapi.ContainerStats{}
+	for iter.HasNext() {
+		handle := iter.Next()
+		if !filter.matchHandle(handle) {
+			continue
+		}
+		cont, err := s.runtime.Container(handle)
+		if err != nil {
+			// container can be removed in the meantime
+			logrus.WithError(err).Warnf("cannot get state of container [%s]", handle.Id())
+			continue
+		}
+		if cont.Status != container.Running {
+			continue
+		}
+		stats, err := containerStats(cont, handle, s.diskUsage)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, stats)
+	}
+	return &runtimeapi.ListContainerStatsResponse{
+		Stats: result,
 	}, nil
 }
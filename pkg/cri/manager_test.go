@@ -0,0 +1,669 @@
+package cri
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/rpc"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"simpleconman/pkg/container"
+	"simpleconman/pkg/oci"
+	shimapi "simpleconman/runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+// fakeRuntime is the OCI runtime which records the calls. Container states
+// are given by containers, and the calls fail with the error in errs by the
+// name of the method.
+type fakeRuntime struct {
+	containers map[container.Id]*container.Instance
+	errs       map[string]error
+	calls      []string
+	// exitOnStart makes the started containers exit at once
+	exitOnStart bool
+	// killed is called with the signal Kill sends if it is set
+	killed func(signal syscall.Signal)
+}
+
+func newFakeRuntime() *fakeRuntime {
+	return &fakeRuntime{
+		containers: map[container.Id]*container.Instance{},
+		errs:       map[string]error{},
+	}
+}
+
+func (r *fakeRuntime) call(method string) error {
+	r.calls = append(r.calls, method)
+	return r.errs[method]
+}
+
+func (r *fakeRuntime) Version() (string, error) {
+	return "1.0.0", r.call("Version")
+}
+
+func (r *fakeRuntime) CreateContainer(handle *container.Handle, stdin bool,
+	stdinOnce bool, timeout time.Duration) (*container.Instance, error) {
+	if err := r.call("CreateContainer"); err != nil {
+		return nil, err
+	}
+	cont := &container.Instance{
+		Id:        handle.Id(),
+		Pid:       1,
+		CreatedAt: time.Now(),
+		Status:    container.Created,
+		Metadata:  handle.Metadata(),
+	}
+	r.containers[handle.Id()] = cont
+	return cont, nil
+}
+
+func (r *fakeRuntime) StartContainer(handle *container.Handle) error {
+	if err := r.call("StartContainer"); err != nil {
+		return err
+	}
+	if cont, ok := r.containers[handle.Id()]; ok {
+		cont.Status = container.Running
+		if r.exitOnStart {
+			cont.Status = container.Stopped
+			cont.Pid = 0
+		}
+	}
+	return nil
+}
+
+func (r *fakeRuntime) Container(handle *container.Handle) (*container.Instance, error) {
+	if err := r.call("Container"); err != nil {
+		return nil, err
+	}
+	cont, ok := r.containers[handle.Id()]
+	if !ok {
+		return nil, errors.New("container does not exist")
+	}
+	return cont, nil
+}
+
+func (r *fakeRuntime) RuntimeState(handle *container.Handle) ([]byte, error) {
+	return []byte("{}"), r.call("RuntimeState")
+}
+
+func (r *fakeRuntime) Kill(handle *container.Handle, signal syscall.Signal, all bool) error {
+	if err := r.call("Kill"); err != nil {
+		return err
+	}
+	if r.killed != nil {
+		r.killed(signal)
+	}
+	return nil
+}
+
+func (r *fakeRuntime) DeleteContainer(handle *container.Handle) error {
+	if err := r.call("DeleteContainer"); err != nil {
+		return err
+	}
+	delete(r.containers, handle.Id())
+	return nil
+}
+
+func (r *fakeRuntime) UpdateContainer(handle *container.Handle, resources *specs.LinuxResources) error {
+	return r.call("UpdateContainer")
+}
+
+func (r *fakeRuntime) Exec(ctx context.Context, handle *container.Handle,
+	process *specs.Process, stdio oci.Stdio) (int, error) {
+	return 0, r.call("Exec")
+}
+
+// fakeRuntimeGetter gets the containers of the store in the states of the
+// fake runtime.
+type fakeRuntimeGetter struct {
+	store   container.ReadOnlyStore
+	runtime *fakeRuntime
+}
+
+func (g *fakeRuntimeGetter) Get(id container.Id) (*container.Instance, *container.Handle, error) {
+	handle, err := g.store.Get(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	cont, err := g.runtime.Container(handle)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cont, handle, nil
+}
+
+func (g *fakeRuntimeGetter) List() ([]*container.Instance, error) {
+	return nil, errors.New("not implemented")
+}
+
+func TestListContainersReportsBrokenContainerUnknown(t *testing.T) {
+	runtime := newFakeRuntime()
+	store := container.NewInMemStore()
+	s := &runtimeService{runtime: runtime, store: store}
+	for _, id := range []string{"running", "broken"} {
+		handle := newTestContainer(t, id, container.Metadata{Name: id})
+		if err := store.Put(handle); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runtime.containers["running"] = &container.Instance{Id: "running", Status: container.Running}
+
+	resp, err := s.ListContainers(context.Background(), &runtimeapi.ListContainersRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	states := map[string]runtimeapi.ContainerState{}
+	for _, c := range resp.Containers {
+		states[c.Id] = c.State
+	}
+	want := map[string]runtimeapi.ContainerState{
+		"running": runtimeapi.ContainerState_CONTAINER_RUNNING,
+		"broken":  runtimeapi.ContainerState_CONTAINER_UNKNOWN,
+	}
+	if len(states) != len(want) {
+		t.Fatalf("containers = %v, want %v", states, want)
+	}
+	for id, state := range want {
+		if states[id] != state {
+			t.Errorf("state of [%s] = %s, want %s", id, states[id], state)
+		}
+	}
+}
+
+func TestRestoreKillsShimOfOrphanContainer(t *testing.T) {
+	s, runtime, _, _ := newCreateTestService(t)
+	// shim is started, but the creation has not completed
+	handle, err := container.NewHandle(nil, "orphan", s.containerDir, s.logFile, s.attachFile, s.exitFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := handle.SetMetadata(container.Metadata{Name: "orphan"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(handle.BundleDir(), 0700); err != nil {
+		t.Fatal(err)
+	}
+	shim := exec.Command("sleep", "60")
+	if err := shim.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer shim.Process.Kill()
+	if err := os.WriteFile(handle.ShimPidFile(), []byte(strconv.Itoa(shim.Process.Pid)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// the socket of the killed shim is left in the run dir
+	addr, err := shimapi.ShimAddr(context.Background(), s.runDir, handle.Id().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket := shimapi.SocketPath(addr)
+	if err := os.MkdirAll(filepath.Dir(socket), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(socket, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.restore(); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- shim.Wait()
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("shim of orphan container is not killed")
+	}
+	if _, err := os.Stat(handle.BaseDir()); !os.IsNotExist(err) {
+		t.Error("orphan container dir is left")
+	}
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Error("shim socket of orphan container is left")
+	}
+	if calls := strings.Join(runtime.calls, ","); !strings.Contains(calls, "DeleteContainer") {
+		t.Errorf("orphan container is not deleted from runtime, calls [%s]", calls)
+	}
+}
+
+func TestStopContainerWithoutShim(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   container.Status
+		wantErr  bool
+		wantCode int32
+	}{
+		{"stopped without exit file", container.Stopped, false, container.UnknownExitCode},
+		{"unknown", container.Unknown, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runtime := newFakeRuntime()
+			s := &runtimeService{runtime: runtime, runDir: t.TempDir()}
+			handle := newTestContainer(t, "c1", container.Metadata{Name: "c1"})
+			if err := handle.Started(); err != nil {
+				t.Fatal(err)
+			}
+			cont := &container.Instance{Id: "c1", Status: tt.status}
+
+			err := s.stopContainer(context.Background(), cont, handle, 10)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("stopContainer() error = %v, want error %v", err, tt.wantErr)
+			}
+			if len(runtime.calls) != 0 {
+				t.Errorf("calls = %v, want none", runtime.calls)
+			}
+			if tt.wantErr {
+				return
+			}
+			state, err := handle.State()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if state.Status != container.Stopped || state.ExitCode != tt.wantCode {
+				t.Errorf("state = %v with exit code %d, want %v with %d",
+					state.Status, state.ExitCode, container.Stopped, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestRemoveContainerWithoutShim(t *testing.T) {
+	runtime := newFakeRuntime()
+	store := container.NewInMemStore()
+	s := &runtimeService{
+		runtime:   runtime,
+		store:     store,
+		names:     container.NewNameIndex(),
+		diskUsage: newDiskUsageCache(diskUsageTTL),
+	}
+	handle := newTestContainer(t, "c1", container.Metadata{Name: "c1"})
+	if err := store.Put(handle); err != nil {
+		t.Fatal(err)
+	}
+	runtime.containers["c1"] = &container.Instance{Id: "c1", Status: container.Unknown}
+
+	if _, err := s.RemoveContainer(context.Background(), &runtimeapi.RemoveContainerRequest{ContainerId: "c1"}); err != nil {
+		t.Fatal(err)
+	}
+	if calls := strings.Join(runtime.calls, ","); calls != "Container,DeleteContainer" {
+		t.Errorf("calls = [%s], want [Container,DeleteContainer]", calls)
+	}
+	if _, err := store.Get("c1"); !errors.Is(err, container.ErrNotFound) {
+		t.Errorf("container is left in store, err = %v", err)
+	}
+}
+
+func TestStartContainerRecordsCgroupPath(t *testing.T) {
+	// the container exits at once, so its cgroup is taken from the spec
+	tests := []struct {
+		name string
+		spec string
+		want string
+	}{
+		{"cgroupfs", `{"linux":{"cgroupsPath":"/zcm/c1"}}`, "/zcm/c1"},
+		{"systemd", `{"linux":{"cgroupsPath":"system.slice:zcm:c1"}}`, "/system.slice/zcm-c1.scope"},
+		{"no cgroups path", `{}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runtime := newFakeRuntime()
+			runtime.exitOnStart = true
+			store := container.NewInMemStore()
+			s := &runtimeService{
+				runtime:         runtime,
+				store:           store,
+				containerGetter: &fakeRuntimeGetter{store: store, runtime: runtime},
+			}
+			handle := newTestContainer(t, "c1", container.Metadata{Name: "c1"})
+			if err := store.Put(handle); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.MkdirAll(handle.BundleDir(), 0700); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(handle.RuntimeSpecFile(), []byte(tt.spec), 0600); err != nil {
+				t.Fatal(err)
+			}
+			runtime.containers["c1"] = &container.Instance{Id: "c1", Status: container.Created}
+
+			if _, err := s.StartContainer(context.Background(), &runtimeapi.StartContainerRequest{ContainerId: "c1"}); err != nil {
+				t.Fatal(err)
+			}
+			state, err := handle.State()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if state.CgroupPath != tt.want {
+				t.Errorf("cgroup path = %q, want %q", state.CgroupPath, tt.want)
+			}
+		})
+	}
+}
+
+func TestContainerStatusImage(t *testing.T) {
+	runtime := newFakeRuntime()
+	store := container.NewInMemStore()
+	s := &runtimeService{
+		runtime:         runtime,
+		store:           store,
+		containerGetter: &fakeRuntimeGetter{store: store, runtime: runtime},
+	}
+	metadata := container.Metadata{
+		Name:               "c1",
+		Image:              "sha256:0123",
+		UserSpecifiedImage: "busybox:latest",
+	}
+	handle := newTestContainer(t, "c1", metadata)
+	if err := store.Put(handle); err != nil {
+		t.Fatal(err)
+	}
+	runtime.containers["c1"] = &container.Instance{Id: "c1", Status: container.Running, Metadata: metadata}
+
+	resp, err := s.ContainerStatus(context.Background(), &runtimeapi.ContainerStatusRequest{ContainerId: "c1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := resp.Status
+	if status.ImageRef != "sha256:0123" {
+		t.Errorf("image ref = %q, want %q", status.ImageRef, "sha256:0123")
+	}
+	if status.Image.Image != "sha256:0123" || status.Image.UserSpecifiedImage != "busybox:latest" {
+		t.Errorf("image = %v, want sha256:0123 specified as busybox:latest", status.Image)
+	}
+}
+
+func TestUpdateContainerResources(t *testing.T) {
+	memory := &runtimeapi.LinuxContainerResources{MemoryLimitInBytes: 2 << 20}
+	tests := []struct {
+		name      string
+		status    container.Status
+		resources *runtimeapi.LinuxContainerResources
+		updateErr error
+		wantErr   bool
+		wantCalls string
+		// wantLimit is the memory limit of the spec, which is 1MiB before
+		// the update
+		wantLimit int64
+		persisted bool
+	}{
+		{"running", container.Running, memory, nil, false, "Container,UpdateContainer", 2 << 20, true},
+		{"created", container.Created, memory, nil, false, "Container,UpdateContainer", 2 << 20, true},
+		{"no resources", container.Running, nil, nil, false, "Container", 1 << 20, false},
+		{"invalid", container.Running, &runtimeapi.LinuxContainerResources{CpuPeriod: -1}, nil, true, "Container", 1 << 20, false},
+		{"stopped", container.Stopped, memory, nil, true, "Container", 1 << 20, false},
+		{"runc update fails", container.Running, memory, errors.New("injected"), true, "Container,UpdateContainer", 1 << 20, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runtime := newFakeRuntime()
+			store := container.NewInMemStore()
+			s := &runtimeService{
+				runtime:         runtime,
+				store:           store,
+				containerGetter: &fakeRuntimeGetter{store: store, runtime: runtime},
+			}
+			handle := newTestContainer(t, "c1", container.Metadata{Name: "c1"})
+			if err := store.Put(handle); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.MkdirAll(handle.BundleDir(), 0700); err != nil {
+				t.Fatal(err)
+			}
+			spec := `{"process":{"args":["/bin/sh"]},"linux":{"resources":{"memory":{"limit":1048576}}}}`
+			if err := os.WriteFile(handle.RuntimeSpecFile(), []byte(spec), 0600); err != nil {
+				t.Fatal(err)
+			}
+			runtime.containers["c1"] = &container.Instance{Id: "c1", Status: tt.status}
+			if tt.updateErr != nil {
+				runtime.errs["UpdateContainer"] = tt.updateErr
+			}
+
+			_, err := s.UpdateContainerResources(context.Background(), &runtimeapi.UpdateContainerResourcesRequest{
+				ContainerId: "c1",
+				Linux:       tt.resources,
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UpdateContainerResources() error = %v, want error %v", err, tt.wantErr)
+			}
+			if calls := strings.Join(runtime.calls, ","); calls != tt.wantCalls {
+				t.Errorf("calls = [%s], want [%s]", calls, tt.wantCalls)
+			}
+			if limit := specMemoryLimit(t, handle.RuntimeSpecFile()); limit != tt.wantLimit {
+				t.Errorf("memory limit of spec = %d, want %d", limit, tt.wantLimit)
+			}
+
+			// the metadata records the resources only after an update
+			b, err := os.ReadFile(handle.MetadataFile())
+			if err != nil {
+				t.Fatal(err)
+			}
+			record := struct {
+				Metadata container.Metadata `json:"metadata"`
+			}{}
+			if err := json.Unmarshal(b, &record); err != nil {
+				t.Fatal(err)
+			}
+			resources := record.Metadata.Resources
+			if !tt.persisted {
+				if resources != nil {
+					t.Errorf("resources of metadata = %+v, want none", resources)
+				}
+				return
+			}
+			if resources == nil || resources.Memory == nil || *resources.Memory.Limit != tt.wantLimit {
+				t.Errorf("resources of metadata = %+v, want memory limit %d", resources, tt.wantLimit)
+			}
+		})
+	}
+}
+
+func specMemoryLimit(t *testing.T, specFile string) int64 {
+	t.Helper()
+	b, err := os.ReadFile(specFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := &specs.Spec{}
+	if err := json.Unmarshal(b, spec); err != nil {
+		t.Fatal(err)
+	}
+	return *spec.Linux.Resources.Memory.Limit
+}
+
+// fakeShim serves Wait of the shim RPC, which returns once exit is closed.
+type fakeShim struct {
+	exit chan struct{}
+}
+
+func (s *fakeShim) Wait(req shimapi.Empty, resp *shimapi.WaitResponse) error {
+	<-s.exit
+	return nil
+}
+
+// serveFakeShim serves the fake shim of the container in the run dir.
+func serveFakeShim(t *testing.T, runDir string, id container.Id, shim *fakeShim) {
+	t.Helper()
+	addr, err := shimapi.ShimAddr(context.Background(), runDir, id.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket := shimapi.SocketPath(addr)
+	if err := os.MkdirAll(filepath.Dir(socket), 0700); err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	server := rpc.NewServer()
+	if err := server.RegisterName(shimapi.ServiceName, shim); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go server.ServeConn(conn)
+		}
+	}()
+}
+
+func TestStopContainer(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout int64
+		// exitOn is the signal the container exits on
+		exitOn      syscall.Signal
+		wantSignals string
+		wantCode    int32
+	}{
+		{"exits on stop signal", 10, syscall.SIGTERM, "terminated", 143},
+		{"escalates to SIGKILL", 1, syscall.SIGKILL, "terminated,killed", 137},
+		{"no grace period", 0, syscall.SIGKILL, "killed", 137},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the socket path must be short
+			runDir, err := os.MkdirTemp("", "zcm-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { os.RemoveAll(runDir) })
+			runtime := newFakeRuntime()
+			s := &runtimeService{runtime: runtime, runDir: runDir, timeout: 5 * time.Second}
+			handle := newTestContainer(t, "c1", container.Metadata{Name: "c1"})
+			if err := os.MkdirAll(handle.BundleDir(), 0700); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(handle.RuntimeSpecFile(), []byte("{}"), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.MkdirAll(filepath.Dir(handle.ExitFile()), 0700); err != nil {
+				t.Fatal(err)
+			}
+			if err := handle.Started(); err != nil {
+				t.Fatal(err)
+			}
+			shim := &fakeShim{exit: make(chan struct{})}
+			serveFakeShim(t, runDir, handle.Id(), shim)
+			signals := []string{}
+			runtime.killed = func(signal syscall.Signal) {
+				signals = append(signals, signal.String())
+				if signal != tt.exitOn {
+					return
+				}
+				code := strconv.Itoa(128 + int(signal))
+				if err := os.WriteFile(handle.ExitFile(), []byte(code), 0600); err != nil {
+					t.Error(err)
+				}
+				close(shim.exit)
+			}
+			cont := &container.Instance{Id: "c1", Status: container.Running}
+
+			if err := s.stopContainer(context.Background(), cont, handle, tt.timeout); err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(signals, ","); got != tt.wantSignals {
+				t.Errorf("signals = [%s], want [%s]", got, tt.wantSignals)
+			}
+			state, err := handle.State()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if state.Status != container.Stopped || state.ExitCode != tt.wantCode {
+				t.Errorf("state = %v with exit code %d, want stopped with %d", state.Status, state.ExitCode, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestRemoveContainer(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      container.Status
+		wantCalls   string
+		wantSignals string
+	}{
+		{"stopped", container.Stopped, "Container,DeleteContainer", ""},
+		{"running is stopped forcibly", container.Running, "Container,Container,Kill,DeleteContainer", "killed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runDir, err := os.MkdirTemp("", "zcm-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { os.RemoveAll(runDir) })
+			runtime := newFakeRuntime()
+			store := container.NewInMemStore()
+			names := container.NewNameIndex()
+			s := &runtimeService{
+				runtime:         runtime,
+				store:           store,
+				names:           names,
+				runDir:          runDir,
+				timeout:         5 * time.Second,
+				containerGetter: &fakeRuntimeGetter{store: store, runtime: runtime},
+				diskUsage:       newDiskUsageCache(diskUsageTTL),
+			}
+			handle := newTestContainer(t, "c1", container.Metadata{Name: "c1"})
+			if err := store.Put(handle); err != nil {
+				t.Fatal(err)
+			}
+			if err := names.Reserve(handle.Metadata().FullName(), "c1"); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.MkdirAll(filepath.Dir(handle.ExitFile()), 0700); err != nil {
+				t.Fatal(err)
+			}
+			runtime.containers["c1"] = &container.Instance{Id: "c1", Status: tt.status}
+			shim := &fakeShim{exit: make(chan struct{})}
+			serveFakeShim(t, runDir, handle.Id(), shim)
+			signals := []string{}
+			runtime.killed = func(signal syscall.Signal) {
+				signals = append(signals, signal.String())
+				if err := os.WriteFile(handle.ExitFile(), []byte("137"), 0600); err != nil {
+					t.Error(err)
+				}
+				close(shim.exit)
+			}
+
+			// removing the removed container is not an error
+			for i := 0; i < 2; i++ {
+				if _, err := s.RemoveContainer(context.Background(), &runtimeapi.RemoveContainerRequest{ContainerId: "c1"}); err != nil {
+					t.Fatalf("remove #%d: %v", i, err)
+				}
+			}
+			if calls := strings.Join(runtime.calls, ","); calls != tt.wantCalls {
+				t.Errorf("calls = [%s], want [%s]", calls, tt.wantCalls)
+			}
+			if got := strings.Join(signals, ","); got != tt.wantSignals {
+				t.Errorf("signals = [%s], want [%s]", got, tt.wantSignals)
+			}
+			if _, err := store.Get("c1"); !errors.Is(err, container.ErrNotFound) {
+				t.Errorf("container is left in store, err = %v", err)
+			}
+			if _, err := os.Stat(handle.BaseDir()); !os.IsNotExist(err) {
+				t.Error("container dir is left")
+			}
+			if err := names.Reserve(handle.Metadata().FullName(), "next"); err != nil {
+				t.Errorf("name is not released: %v", err)
+			}
+		})
+	}
+}
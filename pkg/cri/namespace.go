@@ -0,0 +1,109 @@
+package cri
+
+import (
+	"simpleconman/pkg/container"
+	"simpleconman/pkg/oci"
+	"simpleconman/pkg/sandbox"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pkg/errors"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+var namespaceModes = map[runtimeapi.NamespaceMode]sandbox.NamespaceMode{
+	runtimeapi.NamespaceMode_POD:       sandbox.PodNamespace,
+	runtimeapi.NamespaceMode_CONTAINER: sandbox.ContainerNamespace,
+	runtimeapi.NamespaceMode_NODE:      sandbox.NodeNamespace,
+	runtimeapi.NamespaceMode_TARGET:    sandbox.TargetNamespace,
+}
+
+func toNamespaceOptions(opts *runtimeapi.NamespaceOption) (sandbox.NamespaceOptions, error) {
+	result := sandbox.NamespaceOptions{
+		Network: namespaceModes[opts.GetNetwork()],
+		Pid:     namespaceModes[opts.GetPid()],
+		Ipc:     namespaceModes[opts.GetIpc()],
+	}
+	if result.Network == sandbox.TargetNamespace || result.Ipc == sandbox.TargetNamespace {
+		return sandbox.NamespaceOptions{}, errors.New("only PID namespace can target a container")
+	}
+	return result, nil
+}
+
+func fromNamespaceOptions(opts sandbox.NamespaceOptions) *runtimeapi.NamespaceOption {
+	result := &runtimeapi.NamespaceOption{}
+	for k, v := range namespaceModes {
+		if v == opts.Network {
+			result.Network = k
+		}
+		if v == opts.Pid {
+			result.Pid = k
+		}
+		if v == opts.Ipc {
+			result.Ipc = k
+		}
+	}
+	return result
+}
+
+// pauseNamespaces are the namespaces of the pause container. It creates the
+// ones shared by the containers of the sandbox, unless they are of the host.
+// Network namespace set up by the network manager is joined.
+func pauseNamespaces(opts sandbox.NamespaceOptions, netnsPath string) []oci.Namespace {
+	result := []oci.Namespace{}
+	if opts.Network == sandbox.NodeNamespace {
+		result = append(result,
+			oci.Namespace{Type: specs.NetworkNamespace, Host: true},
+			oci.Namespace{Type: specs.UTSNamespace, Host: true})
+	} else if netnsPath != "" {
+		result = append(result, oci.Namespace{Type: specs.NetworkNamespace, Path: netnsPath})
+	}
+	if opts.Ipc == sandbox.NodeNamespace {
+		result = append(result, oci.Namespace{Type: specs.IPCNamespace, Host: true})
+	}
+	if opts.Pid == sandbox.NodeNamespace {
+		result = append(result, oci.Namespace{Type: specs.PIDNamespace, Host: true})
+	}
+	return result
+}
+
+// containerNamespaces are the namespaces the container joins. Network, IPC
+// and UTS namespaces are of the sandbox or of the host. PID namespace is of
+// the sandbox, the container itself, the host or the target container.
+func (s *runtimeService) containerNamespaces(opts *runtimeapi.NamespaceOption,
+	sbState *sandbox.State) ([]oci.Namespace, error) {
+	modes, err := toNamespaceOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	sandboxNamespace := func(t specs.LinuxNamespaceType, ns string, mode sandbox.NamespaceMode) oci.Namespace {
+		if mode == sandbox.NodeNamespace {
+			return oci.Namespace{Type: t, Host: true}
+		}
+		return oci.Namespace{Type: t, Path: sbState.NamespacePath(ns)}
+	}
+	result := []oci.Namespace{
+		sandboxNamespace(specs.NetworkNamespace, "net", modes.Network),
+		sandboxNamespace(specs.UTSNamespace, "uts", modes.Network),
+		sandboxNamespace(specs.IPCNamespace, "ipc", modes.Ipc),
+	}
+
+	switch modes.Pid {
+	case sandbox.PodNamespace:
+		result = append(result, sandboxNamespace(specs.PIDNamespace, "pid", modes.Pid))
+	case sandbox.NodeNamespace:
+		result = append(result, oci.Namespace{Type: specs.PIDNamespace, Host: true})
+	case sandbox.TargetNamespace:
+		cont, _, err := s.containerGetter.Get(container.Id(opts.GetTargetId()))
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot get target container [%s]", opts.GetTargetId())
+		}
+		if cont.Status != container.Running {
+			return nil, errors.Errorf("target container [%s] is not running", opts.GetTargetId())
+		}
+		result = append(result, oci.Namespace{
+			Type: specs.PIDNamespace,
+			Path: oci.NamespacePath(int(cont.Pid), "pid"),
+		})
+	}
+	return result, nil
+}
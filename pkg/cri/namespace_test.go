@@ -0,0 +1,137 @@
+package cri
+
+import (
+	"simpleconman/pkg/container"
+	"simpleconman/pkg/oci"
+	"simpleconman/pkg/sandbox"
+	"strings"
+	"testing"
+
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+// formatNamespaces formats the namespaces as "<type>=<path or host>".
+func formatNamespaces(namespaces []oci.Namespace) string {
+	result := []string{}
+	for _, ns := range namespaces {
+		where := ns.Path
+		if ns.Host {
+			where = "host"
+		}
+		result = append(result, string(ns.Type)+"="+where)
+	}
+	return strings.Join(result, ",")
+}
+
+func TestToNamespaceOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    *runtimeapi.NamespaceOption
+		want    sandbox.NamespaceOptions
+		wantErr bool
+	}{
+		{"default", nil, sandbox.NamespaceOptions{}, false},
+		{"node", &runtimeapi.NamespaceOption{
+			Network: runtimeapi.NamespaceMode_NODE,
+			Pid:     runtimeapi.NamespaceMode_NODE,
+			Ipc:     runtimeapi.NamespaceMode_NODE,
+		}, sandbox.NamespaceOptions{
+			Network: sandbox.NodeNamespace,
+			Pid:     sandbox.NodeNamespace,
+			Ipc:     sandbox.NodeNamespace,
+		}, false},
+		{"pid target", &runtimeapi.NamespaceOption{Pid: runtimeapi.NamespaceMode_TARGET},
+			sandbox.NamespaceOptions{Pid: sandbox.TargetNamespace}, false},
+		{"network target", &runtimeapi.NamespaceOption{Network: runtimeapi.NamespaceMode_TARGET},
+			sandbox.NamespaceOptions{}, true},
+		{"ipc target", &runtimeapi.NamespaceOption{Ipc: runtimeapi.NamespaceMode_TARGET},
+			sandbox.NamespaceOptions{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toNamespaceOptions(tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("toNamespaceOptions() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPauseNamespaces(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      sandbox.NamespaceOptions
+		netnsPath string
+		want      string
+	}{
+		{"pod", sandbox.NamespaceOptions{}, "", ""},
+		{"pod with netns", sandbox.NamespaceOptions{}, "/run/zcm/netns/pod1", "network=/run/zcm/netns/pod1"},
+		{"node network", sandbox.NamespaceOptions{Network: sandbox.NodeNamespace}, "/run/zcm/netns/pod1", "network=host,uts=host"},
+		{"node ipc and pid", sandbox.NamespaceOptions{Ipc: sandbox.NodeNamespace, Pid: sandbox.NodeNamespace}, "",
+			"ipc=host,pid=host"},
+		{"container pid", sandbox.NamespaceOptions{Pid: sandbox.ContainerNamespace}, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatNamespaces(pauseNamespaces(tt.opts, tt.netnsPath)); got != tt.want {
+				t.Errorf("pauseNamespaces() = [%s], want [%s]", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContainerNamespaces(t *testing.T) {
+	const pod = "network=/proc/10/ns/net,uts=/proc/10/ns/uts,ipc=/proc/10/ns/ipc"
+	tests := []struct {
+		name    string
+		opts    *runtimeapi.NamespaceOption
+		target  *container.Instance
+		want    string
+		wantErr bool
+	}{
+		{"pod", nil, nil, pod + ",pid=/proc/10/ns/pid", false},
+		{"container pid", &runtimeapi.NamespaceOption{Pid: runtimeapi.NamespaceMode_CONTAINER}, nil, pod, false},
+		{"node", &runtimeapi.NamespaceOption{
+			Network: runtimeapi.NamespaceMode_NODE,
+			Pid:     runtimeapi.NamespaceMode_NODE,
+			Ipc:     runtimeapi.NamespaceMode_NODE,
+		}, nil, "network=host,uts=host,ipc=host,pid=host", false},
+		{"target", &runtimeapi.NamespaceOption{Pid: runtimeapi.NamespaceMode_TARGET, TargetId: "target"},
+			&container.Instance{Id: "target", Pid: 20, Status: container.Running}, pod + ",pid=/proc/20/ns/pid", false},
+		{"target not running", &runtimeapi.NamespaceOption{Pid: runtimeapi.NamespaceMode_TARGET, TargetId: "target"},
+			&container.Instance{Id: "target", Status: container.Stopped}, "", true},
+		{"target missing", &runtimeapi.NamespaceOption{Pid: runtimeapi.NamespaceMode_TARGET, TargetId: "target"},
+			nil, "", true},
+		{"network target", &runtimeapi.NamespaceOption{Network: runtimeapi.NamespaceMode_TARGET, TargetId: "target"},
+			&container.Instance{Id: "target", Pid: 20, Status: container.Running}, "", true},
+		{"ipc target", &runtimeapi.NamespaceOption{Ipc: runtimeapi.NamespaceMode_TARGET, TargetId: "target"},
+			&container.Instance{Id: "target", Pid: 20, Status: container.Running}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runtime := newFakeRuntime()
+			store := container.NewInMemStore()
+			s := &runtimeService{
+				runtime:         runtime,
+				containerGetter: &fakeRuntimeGetter{store: store, runtime: runtime},
+			}
+			if tt.target != nil {
+				if err := store.Put(newTestContainer(t, "target", container.Metadata{Name: "target"})); err != nil {
+					t.Fatal(err)
+				}
+				runtime.containers["target"] = tt.target
+			}
+
+			namespaces, err := s.containerNamespaces(tt.opts, &sandbox.State{Pid: 10})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := formatNamespaces(namespaces); got != tt.want {
+				t.Errorf("containerNamespaces() = [%s], want [%s]", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package cri
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// rollback records how to undo each completed step of a creation, so the
+// steps are undone in reverse order if a later step fails.
+type rollback struct {
+	// target is what is created such as "container [<id>]"
+	target string
+	steps  []rollbackStep
+	// undone are the names of the steps run undid, in the order undone
+	undone []string
+}
+
+type rollbackStep struct {
+	name string
+	undo func() error
+}
+
+// add records the step which undo undoes.
+func (r *rollback) add(name string, undo func() error) {
+	r.steps = append(r.steps, rollbackStep{name: name, undo: undo})
+}
+
+// run undoes the steps from the last one. The step which cannot be undone is
+// only logged, so the steps before it are still undone.
+func (r *rollback) run() {
+	for i := len(r.steps) - 1; i >= 0; i-- {
+		step := r.steps[i]
+		logrus.Debugf("rollback: %s of %s", step.name, r.target)
+		if err := step.undo(); err != nil {
+			logrus.WithError(err).Warnf("rollback: cannot %s of %s", step.name, r.target)
+		}
+		r.undone = append(r.undone, step.name)
+	}
+}
+
+// rollBack undoes the steps of the failed creation, and passes the rollback
+// to the rolledBack hook of the service if it is set.
+func (s *runtimeService) rollBack(r *rollback) {
+	r.run()
+	if s.rolledBack != nil {
+		s.rolledBack(r)
+	}
+}
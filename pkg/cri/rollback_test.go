@@ -0,0 +1,330 @@
+package cri
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"simpleconman/pkg/cgroups"
+	"simpleconman/pkg/container"
+	"simpleconman/pkg/oci"
+	"simpleconman/pkg/sandbox"
+	"strings"
+	"testing"
+
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+func TestRollbackRunsInReverseOrder(t *testing.T) {
+	var undone []string
+	r := &rollback{target: "test"}
+	for _, name := range []string{"first", "second", "third"} {
+		name := name
+		r.add(name, func() error {
+			undone = append(undone, name)
+			if name == "second" {
+				return errors.New("cannot undo")
+			}
+			return nil
+		})
+	}
+	r.run()
+	want := []string{"third", "second", "first"}
+	if strings.Join(undone, ",") != strings.Join(want, ",") {
+		t.Errorf("undone = %v, want %v", undone, want)
+	}
+	if strings.Join(r.undone, ",") != strings.Join(want, ",") {
+		t.Errorf("recorded undone steps = %v, want %v", r.undone, want)
+	}
+}
+
+// failingStore fails Put with err.
+type failingStore struct {
+	*container.InMemStore
+	err error
+}
+
+func (s *failingStore) Put(handle *container.Handle) error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.InMemStore.Put(handle)
+}
+
+type fakeImages struct {
+	err error
+}
+
+func (i *fakeImages) ImageConfig(image string) (*oci.ImageConfig, error) {
+	return &oci.ImageConfig{}, i.err
+}
+
+// newCreateTestService returns the service with a ready sandbox "pod1" whose
+// pause container is running.
+func newCreateTestService(t *testing.T) (*runtimeService, *fakeRuntime, *failingStore, *fakeImages) {
+	t.Helper()
+	dir := t.TempDir()
+	runtime := newFakeRuntime()
+	store := &failingStore{InMemStore: container.NewInMemStore()}
+	images := &fakeImages{}
+	s := &runtimeService{
+		runtime:      runtime,
+		rootDir:      path.Join(dir, "root"),
+		rootfsDir:    path.Join(dir, "rootfs"),
+		logDir:       path.Join(dir, "logs"),
+		exitDir:      path.Join(dir, "exits"),
+		attachDir:    path.Join(dir, "attach"),
+		runDir:       path.Join(dir, "run"),
+		cgroupDriver: cgroups.Cgroupfs,
+		store:        store,
+		names:        container.NewNameIndex(),
+		sandboxes:    sandbox.NewInMemStore(),
+		images:       images,
+		diskUsage:    newDiskUsageCache(diskUsageTTL),
+	}
+	if err := os.MkdirAll(path.Join(s.rootfsDir, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	sb, err := sandbox.NewHandle("pod1", s.sandboxDir, s.attachFile, s.exitFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sb.SetMetadata(sandbox.Metadata{Name: "pod"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sb.Ready(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.sandboxes.Put(sb); err != nil {
+		t.Fatal(err)
+	}
+	runtime.containers[sb.PauseId()] = &container.Instance{Status: container.Running}
+	return s, runtime, store, images
+}
+
+func createRequest() *runtimeapi.CreateContainerRequest {
+	return &runtimeapi.CreateContainerRequest{
+		PodSandboxId: "pod1",
+		Config: &runtimeapi.ContainerConfig{
+			Metadata: &runtimeapi.ContainerMetadata{Name: "app"},
+			Command:  []string{"/bin/sh"},
+		},
+	}
+}
+
+// recordRollback makes the service record the undone steps of its rollbacks
+// in steps.
+func recordRollback(s *runtimeService, steps *[]string) {
+	s.rolledBack = func(r *rollback) {
+		*steps = append(*steps, r.undone...)
+	}
+}
+
+func TestCreateContainerRollback(t *testing.T) {
+	var (
+		errInjected = errors.New("injected")
+		filesSteps  = []string{"remove files", "release name"}
+		allSteps    = []string{"delete container", "kill shim", "remove files", "release name"}
+	)
+	tests := []struct {
+		name   string
+		inject func(s *runtimeService, runtime *fakeRuntime, store *failingStore,
+			images *fakeImages, req *runtimeapi.CreateContainerRequest)
+		steps []string
+	}{
+		{
+			name: "name reserved",
+			inject: func(s *runtimeService, _ *fakeRuntime, _ *failingStore, _ *fakeImages, _ *runtimeapi.CreateContainerRequest) {
+				s.names.Reserve("app_pod1_0", "other")
+			},
+			steps: []string{},
+		},
+		{
+			name: "copy rootfs",
+			inject: func(s *runtimeService, _ *fakeRuntime, _ *failingStore, _ *fakeImages, _ *runtimeapi.CreateContainerRequest) {
+				os.RemoveAll(s.rootfsDir)
+			},
+			steps: filesSteps,
+		},
+		{
+			name: "image config",
+			inject: func(_ *runtimeService, _ *fakeRuntime, _ *failingStore, images *fakeImages, _ *runtimeapi.CreateContainerRequest) {
+				images.err = errInjected
+			},
+			steps: filesSteps,
+		},
+		{
+			name: "spec options",
+			inject: func(_ *runtimeService, _ *fakeRuntime, _ *failingStore, _ *fakeImages, req *runtimeapi.CreateContainerRequest) {
+				req.Config.Linux = &runtimeapi.LinuxContainerConfig{
+					SecurityContext: &runtimeapi.LinuxContainerSecurityContext{
+						SeccompProfilePath: "invalid",
+					},
+				}
+			},
+			steps: filesSteps,
+		},
+		{
+			name: "spec",
+			inject: func(_ *runtimeService, _ *fakeRuntime, _ *failingStore, _ *fakeImages, req *runtimeapi.CreateContainerRequest) {
+				req.Config.Envs = []*runtimeapi.KeyValue{{Key: "", Value: "invalid"}}
+			},
+			steps: filesSteps,
+		},
+		{
+			name: "runtime create",
+			inject: func(_ *runtimeService, runtime *fakeRuntime, _ *failingStore, _ *fakeImages, _ *runtimeapi.CreateContainerRequest) {
+				runtime.errs["CreateContainer"] = errInjected
+			},
+			steps: allSteps,
+		},
+		{
+			name: "store",
+			inject: func(_ *runtimeService, _ *fakeRuntime, store *failingStore, _ *fakeImages, _ *runtimeapi.CreateContainerRequest) {
+				store.err = errInjected
+			},
+			steps: allSteps,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, runtime, store, images := newCreateTestService(t)
+			req := createRequest()
+			tt.inject(s, runtime, store, images, req)
+
+			steps := []string{}
+			recordRollback(s, &steps)
+			_, err := s.CreateContainer(context.Background(), req)
+			if err == nil {
+				t.Fatal("CreateContainer succeeded")
+			}
+			t.Log(err)
+
+			if strings.Join(steps, ",") != strings.Join(tt.steps, ",") {
+				t.Errorf("rollback steps = %v, want %v", steps, tt.steps)
+			}
+			entries, err := os.ReadDir(s.containersDir())
+			if err != nil && !os.IsNotExist(err) {
+				t.Fatal(err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("container dir is left: %v", entries)
+			}
+			if len(runtime.containers) != 1 {
+				t.Errorf("runtime container is left: %v", runtime.containers)
+			}
+			if store.Iter().HasNext() {
+				t.Error("container is left in store")
+			}
+			if tt.name != "name reserved" {
+				if err := s.names.Reserve("app_pod1_0", "next"); err != nil {
+					t.Errorf("name is not released: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateContainer(t *testing.T) {
+	s, runtime, store, _ := newCreateTestService(t)
+	steps := []string{}
+	recordRollback(s, &steps)
+
+	resp, err := s.CreateContainer(context.Background(), createRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != 0 {
+		t.Errorf("rollback steps = %v", steps)
+	}
+	handle, err := store.Get(container.Id(resp.ContainerId))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := handle.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Status != container.Created {
+		t.Errorf("status = %s, want created", state.Status)
+	}
+	if _, err := os.Stat(path.Join(handle.RootfsDir(), "bin")); err != nil {
+		t.Errorf("rootfs is not copied: %v", err)
+	}
+	if _, err := os.Stat(handle.RuntimeSpecFile()); err != nil {
+		t.Errorf("spec is not written: %v", err)
+	}
+	if _, ok := runtime.containers[handle.Id()]; !ok {
+		t.Error("container is not created by runtime")
+	}
+	if err := s.names.Reserve("app_pod1_0", "other"); err == nil {
+		t.Error("name is not reserved")
+	}
+}
+
+func TestRunPodSandboxRollback(t *testing.T) {
+	var (
+		errInjected = errors.New("injected")
+		allSteps    = []string{"delete pause container", "kill shim", "tear down network", "remove files", "release name"}
+	)
+	tests := []struct {
+		name   string
+		inject func(s *runtimeService, runtime *fakeRuntime)
+		steps  []string
+	}{
+		{
+			name: "copy rootfs",
+			inject: func(s *runtimeService, _ *fakeRuntime) {
+				os.RemoveAll(s.rootfsDir)
+			},
+			steps: []string{"tear down network", "remove files", "release name"},
+		},
+		{
+			name: "runtime create",
+			inject: func(_ *runtimeService, runtime *fakeRuntime) {
+				runtime.errs["CreateContainer"] = errInjected
+			},
+			steps: allSteps,
+		},
+		{
+			name: "runtime start",
+			inject: func(_ *runtimeService, runtime *fakeRuntime) {
+				runtime.errs["StartContainer"] = errInjected
+			},
+			steps: allSteps,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, runtime, _, _ := newCreateTestService(t)
+			s.sandboxNames = sandbox.NewNameIndex()
+			tt.inject(s, runtime)
+			steps := []string{}
+			recordRollback(s, &steps)
+
+			req := &runtimeapi.RunPodSandboxRequest{
+				Config: &runtimeapi.PodSandboxConfig{
+					Metadata: &runtimeapi.PodSandboxMetadata{Name: "pod", Uid: "uid", Namespace: "ns"},
+				},
+			}
+			if _, err := s.RunPodSandbox(context.Background(), req); err == nil {
+				t.Fatal("RunPodSandbox succeeded")
+			}
+			if strings.Join(steps, ",") != strings.Join(tt.steps, ",") {
+				t.Errorf("rollback steps = %v, want %v", steps, tt.steps)
+			}
+			entries, err := os.ReadDir(s.sandboxesDir())
+			if err != nil && !os.IsNotExist(err) {
+				t.Fatal(err)
+			}
+			// only the sandbox of the test service is left
+			if len(entries) != 1 {
+				t.Errorf("sandbox dir is left: %v", entries)
+			}
+			if err := s.sandboxNames.Reserve("pod_ns_uid_0", "next"); err != nil {
+				t.Errorf("name is not released: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,485 @@
+package cri
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"simpleconman/pkg/cgroups"
+	"simpleconman/pkg/container"
+	"simpleconman/pkg/network"
+	"simpleconman/pkg/oci"
+	"simpleconman/pkg/sandbox"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+// defaultPauseCommand is run by the pause container of the sandbox. The
+// command must sleep until it is killed.
+var defaultPauseCommand = []string{"/pause"}
+
+// pauseOOMScoreAdj keeps the pause container from the OOM killer as the
+// whole pod goes with it
+const pauseOOMScoreAdj = -998
+
+func SandboxStatus(s sandbox.Status) runtimeapi.PodSandboxState {
+	if s == sandbox.Ready {
+		return runtimeapi.PodSandboxState_SANDBOX_READY
+	}
+	return runtimeapi.PodSandboxState_SANDBOX_NOTREADY
+}
+
+// RunPodSandbox creates and starts a pod-level sandbox. The sandbox is ready
+// once its pause container runs. Every completed step is undone in reverse
+// order if any of later steps fails.
+func (s *runtimeService) RunPodSandbox(ctx context.Context,
+	req *runtimeapi.RunPodSandboxRequest) (_ *runtimeapi.RunPodSandboxResponse, retErr error) {
+	config := req.GetConfig()
+	metadata := sandbox.Metadata{
+		Name:           config.GetMetadata().GetName(),
+		Uid:            config.GetMetadata().GetUid(),
+		Namespace:      config.GetMetadata().GetNamespace(),
+		Attempt:        config.GetMetadata().GetAttempt(),
+		Hostname:       config.GetHostname(),
+		LogDirectory:   config.GetLogDirectory(),
+		CgroupParent:   config.GetLinux().GetCgroupParent(),
+		RuntimeHandler: req.GetRuntimeHandler(),
+		Labels:         config.GetLabels(),
+		Annotations:    config.GetAnnotations(),
+	}
+	namespaces, err := toNamespaceOptions(config.GetLinux().GetSecurityContext().GetNamespaceOptions())
+	if err != nil {
+		return nil, err
+	}
+	metadata.Namespaces = namespaces
+	if dns := config.GetDnsConfig(); dns != nil {
+		metadata.DNS = &sandbox.DNSConfig{
+			Servers:  dns.GetServers(),
+			Searches: dns.GetSearches(),
+			Options:  dns.GetOptions(),
+		}
+	}
+	id := sandbox.GenId()
+	undo := &rollback{target: fmt.Sprintf("sandbox [%s]", id)}
+	defer func() {
+		if retErr != nil {
+			s.rollBack(undo)
+		}
+	}()
+	if err := s.sandboxNames.Reserve(metadata.FullName(), id); err != nil {
+		return nil, err
+	}
+	undo.add("release name", func() error {
+		s.sandboxNames.Release(metadata.FullName(), id)
+		return nil
+	})
+
+	handle, err := sandbox.NewHandle(id, s.sandboxDir, s.attachFile, s.exitFile)
+	if err != nil {
+		return nil, err
+	}
+	undo.add("remove files", handle.Remove)
+	if err := handle.SetMetadata(metadata); err != nil {
+		return nil, err
+	}
+	if err := handle.SetupFiles(); err != nil {
+		return nil, err
+	}
+	netnsPath, err := s.setupNetwork(ctx, handle)
+	if err != nil {
+		return nil, err
+	}
+	undo.add("tear down network", func() error {
+		return s.teardownNetwork(context.Background(), handle)
+	})
+
+	pause := handle.Pause()
+	if err := pause.CopyRootfs(s.rootfsDir); err != nil {
+		return nil, err
+	}
+	opts, err := s.pauseSpecOptions(config, handle, netnsPath)
+	if err != nil {
+		return nil, err
+	}
+	spec, err := oci.NewSpec(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := pause.Bundle(spec); err != nil {
+		return nil, err
+	}
+
+	// shim and runc container may be left even if the creation fails halfway
+	undo.add("kill shim", func() error {
+		return oci.KillShim(s.runDir, pause)
+	})
+	undo.add("delete pause container", func() error {
+		return s.runtime.DeleteContainer(pause)
+	})
+	if _, err := s.runtime.CreateContainer(pause, false, false, s.timeout); err != nil {
+		return nil, err
+	}
+	if err := pause.Created(); err != nil {
+		return nil, err
+	}
+	if err := s.runtime.StartContainer(pause); err != nil {
+		return nil, errors.Wrap(err, "cannot start pause container")
+	}
+	if err := pause.Started(); err != nil {
+		return nil, err
+	}
+	cont, err := s.runtime.Container(pause)
+	if err != nil {
+		return nil, err
+	}
+	if cont.Status != container.Running {
+		return nil, errors.Errorf("pause container is not running. status [%s]", cont.Status)
+	}
+	if err := handle.Ready(int(cont.Pid)); err != nil {
+		return nil, err
+	}
+	if err := s.sandboxes.Put(handle); err != nil {
+		return nil, err
+	}
+	return &runtimeapi.RunPodSandboxResponse{
+		PodSandboxId: handle.Id().String(),
+	}, nil
+}
+
+func (s *runtimeService) pauseSpecOptions(config *runtimeapi.PodSandboxConfig,
+	handle *sandbox.Handle, netnsPath string) (oci.SpecOptions, error) {
+	securityContext := config.GetLinux().GetSecurityContext()
+	seccomp, err := securityProfile(securityContext.GetSeccomp(),
+		securityContext.GetSeccompProfilePath())
+	if err != nil {
+		return oci.SpecOptions{}, errors.Wrap(err, "invalid seccomp profile")
+	}
+	cgroupsPath, err := cgroups.ContainerPath(s.cgroupDriver,
+		config.GetLinux().GetCgroupParent(), handle.Id().String())
+	if err != nil {
+		return oci.SpecOptions{}, err
+	}
+	command := s.pauseCommand
+	if len(command) == 0 {
+		command = defaultPauseCommand
+	}
+	return oci.SpecOptions{
+		Command:      command,
+		Hostname:     config.GetHostname(),
+		RootPath:     handle.Pause().RootfsDir(),
+		RootReadonly: true,
+
+		NoNewPrivileges:    true,
+		MaskedPaths:        oci.DefaultMaskedPaths,
+		ReadonlyPaths:      oci.DefaultReadonlyPaths,
+		Seccomp:            seccomp,
+		SeccompProfileRoot: s.seccompProfileRoot,
+
+		CgroupsPath: cgroupsPath,
+		OOMScoreAdj: pauseOOMScoreAdj,
+		Namespaces:  pauseNamespaces(handle.Metadata().Namespaces, netnsPath),
+	}, nil
+}
+
+func podInfo(handle *sandbox.Handle) network.PodInfo {
+	metadata := handle.Metadata()
+	return network.PodInfo{
+		Id:        handle.Id().String(),
+		Name:      metadata.Name,
+		Namespace: metadata.Namespace,
+		Uid:       metadata.Uid,
+	}
+}
+
+// setupNetwork creates the network namespace of the sandbox with the network
+// manager, and returns its path. Sandbox in the network namespace of the
+// host, or without the network manager, has none.
+func (s *runtimeService) setupNetwork(ctx context.Context, handle *sandbox.Handle) (string, error) {
+	if s.network == nil || handle.Metadata().Namespaces.Network == sandbox.NodeNamespace {
+		return "", nil
+	}
+	netnsPath, ips, err := s.network.Setup(ctx, podInfo(handle))
+	if err != nil {
+		return "", errors.Wrap(err, "cannot set up network of sandbox")
+	}
+	if err := handle.SetNetwork(netnsPath, ips); err != nil {
+		if err := s.network.Teardown(ctx, podInfo(handle), netnsPath); err != nil {
+			logrus.WithError(err).Warnf("rollback: cannot tear down network of sandbox [%s]", handle.Id())
+		}
+		return "", err
+	}
+	return netnsPath, nil
+}
+
+// teardownNetwork tears down the network set up by setupNetwork. Tearing
+// down twice is not an error.
+func (s *runtimeService) teardownNetwork(ctx context.Context, handle *sandbox.Handle) error {
+	state, err := handle.State()
+	if err != nil {
+		return err
+	}
+	if state.NetNSPath == "" || s.network == nil {
+		return nil
+	}
+	if err := s.network.Teardown(ctx, podInfo(handle), state.NetNSPath); err != nil {
+		return errors.Wrap(err, "cannot tear down network of sandbox")
+	}
+	return handle.SetNetwork("", nil)
+}
+
+// sandboxStatus returns the status of the sandbox. Ready sandbox whose pause
+// container has gone is not ready.
+func (s *runtimeService) sandboxStatus(handle *sandbox.Handle) (sandbox.Status, *sandbox.State, error) {
+	state, err := handle.State()
+	if err != nil {
+		return 0, nil, err
+	}
+	if state.Status != sandbox.Ready {
+		return state.Status, state, nil
+	}
+	pause, err := s.runtime.Container(handle.Pause())
+	if err != nil || pause.Status != container.Running {
+		return sandbox.NotReady, state, nil
+	}
+	return sandbox.Ready, state, nil
+}
+
+// readySandbox returns the sandbox which containers can be created in.
+func (s *runtimeService) readySandbox(id sandbox.Id) (*sandbox.Handle, *sandbox.State, error) {
+	handle, err := s.sandboxes.Get(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	status, state, err := s.sandboxStatus(handle)
+	if err != nil {
+		return nil, nil, err
+	}
+	if status != sandbox.Ready {
+		return nil, nil, errors.Errorf("pod sandbox [%s] is not ready", id)
+	}
+	return handle, state, nil
+}
+
+// sandboxContainers returns the containers created in the sandbox.
+func (s *runtimeService) sandboxContainers(id sandbox.Id) []*container.Handle {
+	result := []*container.Handle{}
+	iter := s.store.Iter()
+	for iter.HasNext() {
+		handle := iter.Next()
+		if handle.Metadata().PodSandboxId == id.String() {
+			result = append(result, handle)
+		}
+	}
+	return result
+}
+
+// StopPodSandbox stops any running process that is part of the sandbox. All
+// containers in the sandbox are killed. Stopping the stopped sandbox is not
+// an error.
+func (s *runtimeService) StopPodSandbox(ctx context.Context,
+	r *runtimeapi.StopPodSandboxRequest) (*runtimeapi.StopPodSandboxResponse, error) {
+	handle, err := s.sandboxes.Get(sandbox.Id(r.GetPodSandboxId()))
+	if err != nil {
+		return nil, err
+	}
+	for _, contHandle := range s.sandboxContainers(handle.Id()) {
+		cont, err := s.runtime.Container(contHandle)
+		if err != nil {
+			// the state is unreadable, the removal deletes the container forcibly
+			logrus.WithError(err).Warnf("cannot get state of container [%s]", contHandle.Id())
+			continue
+		}
+		if err := s.stopContainer(ctx, cont, contHandle, 0); err != nil {
+			return nil, errors.Wrapf(err, "cannot stop container [%s] of sandbox", contHandle.Id())
+		}
+	}
+	if err := s.stopPause(ctx, handle); err != nil {
+		return nil, err
+	}
+	if err := s.teardownNetwork(ctx, handle); err != nil {
+		return nil, err
+	}
+	if err := handle.UnmountShm(); err != nil {
+		return nil, err
+	}
+	if err := handle.NotReady(); err != nil {
+		return nil, err
+	}
+	return &runtimeapi.StopPodSandboxResponse{}, nil
+}
+
+func (s *runtimeService) stopPause(ctx context.Context, handle *sandbox.Handle) error {
+	pause, err := s.runtime.Container(handle.Pause())
+	if err != nil {
+		// the state is unreadable, the removal deletes the pause container
+		// forcibly
+		logrus.WithError(err).Warnf("cannot get state of pause container of sandbox [%s]", handle.Id())
+		return nil
+	}
+	return s.stopContainer(ctx, pause, handle.Pause(), 0)
+}
+
+// RemovePodSandbox removes the sandbox with its containers. Running
+// containers are forcibly removed. Removing the removed sandbox is not an
+// error.
+func (s *runtimeService) RemovePodSandbox(ctx context.Context,
+	r *runtimeapi.RemovePodSandboxRequest) (*runtimeapi.RemovePodSandboxResponse, error) {
+	id := sandbox.Id(r.GetPodSandboxId())
+	handle, err := s.sandboxes.Get(id)
+	if errors.Is(err, sandbox.ErrNotFound) {
+		return &runtimeapi.RemovePodSandboxResponse{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, cont := range s.sandboxContainers(id) {
+		if _, err := s.RemoveContainer(ctx, &runtimeapi.RemoveContainerRequest{
+			ContainerId: cont.Id().String(),
+		}); err != nil {
+			return nil, errors.Wrapf(err, "cannot remove container [%s] of sandbox", cont.Id())
+		}
+	}
+	if err := s.stopPause(ctx, handle); err != nil {
+		return nil, err
+	}
+	if err := s.teardownNetwork(ctx, handle); err != nil {
+		return nil, err
+	}
+	if err := s.runtime.DeleteContainer(handle.Pause()); err != nil {
+		return nil, errors.Wrap(err, "cannot delete pause container from runtime")
+	}
+	if err := handle.Remove(); err != nil {
+		return nil, err
+	}
+	if err := s.sandboxes.Delete(id); err != nil {
+		return nil, err
+	}
+	s.sandboxNames.Release(handle.Metadata().FullName(), id)
+	return &runtimeapi.RemovePodSandboxResponse{}, nil
+}
+
+// PodSandboxStatus returns the status of the sandbox. If the sandbox is not
+// present, returns an error.
+func (s *runtimeService) PodSandboxStatus(ctx context.Context,
+	r *runtimeapi.PodSandboxStatusRequest) (*runtimeapi.PodSandboxStatusResponse, error) {
+	handle, err := s.sandboxes.Get(sandbox.Id(r.GetPodSandboxId()))
+	if err != nil {
+		return nil, err
+	}
+	status, state, err := s.sandboxStatus(handle)
+	if err != nil {
+		return nil, err
+	}
+	metadata := handle.Metadata()
+	resp := &runtimeapi.PodSandboxStatusResponse{
+		Status: &runtimeapi.PodSandboxStatus{
+			Id:        handle.Id().String(),
+			Metadata:  sandboxMetadata(metadata),
+			State:     SandboxStatus(status),
+			CreatedAt: unixNano(state.CreatedAt),
+			Network:   networkStatus(state),
+			Linux: &runtimeapi.LinuxPodSandboxStatus{
+				Namespaces: &runtimeapi.Namespace{
+					Options: fromNamespaceOptions(metadata.Namespaces),
+				},
+			},
+			Labels:         metadata.Labels,
+			Annotations:    metadata.Annotations,
+			RuntimeHandler: metadata.RuntimeHandler,
+		},
+	}
+	if !r.GetVerbose() || status != sandbox.Ready {
+		return resp, nil
+	}
+	info, err := s.sandboxVerboseInfo(handle, state)
+	if err != nil {
+		return nil, err
+	}
+	resp.Info = info
+	return resp, nil
+}
+
+func (s *runtimeService) sandboxVerboseInfo(handle *sandbox.Handle, state *sandbox.State) (map[string]string, error) {
+	runtimeState, err := s.runtime.RuntimeState(handle.Pause())
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(struct {
+		RuntimeState json.RawMessage  `json:"runtimeState"`
+		Pid          int              `json:"pid"`
+		Metadata     sandbox.Metadata `json:"metadata"`
+	}{
+		RuntimeState: runtimeState,
+		Pid:          state.Pid,
+		Metadata:     handle.Metadata(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"info": string(b)}, nil
+}
+
+// ListPodSandbox returns a list of sandboxes by filters.
+func (s *runtimeService) ListPodSandbox(ctx context.Context,
+	r *runtimeapi.ListPodSandboxRequest) (*runtimeapi.ListPodSandboxResponse, error) {
+	filter := newSandboxFilter(r.GetFilter())
+	iter := s.sandboxes.Iter()
+	result := []*runtimeapi.PodSandbox{}
+	for iter.HasNext() {
+		handle := iter.Next()
+		if !filter.matchHandle(handle) {
+			continue
+		}
+		status, state, err := s.sandboxStatus(handle)
+		if err != nil {
+			return nil, err
+		}
+		if !filter.matchStatus(status) {
+			continue
+		}
+		metadata := handle.Metadata()
+		result = append(result, &runtimeapi.PodSandbox{
+			Id:             handle.Id().String(),
+			Metadata:       sandboxMetadata(metadata),
+			State:          SandboxStatus(status),
+			CreatedAt:      unixNano(state.CreatedAt),
+			Labels:         metadata.Labels,
+			Annotations:    metadata.Annotations,
+			RuntimeHandler: metadata.RuntimeHandler,
+		})
+	}
+	return &runtimeapi.ListPodSandboxResponse{
+		Items: result,
+	}, nil
+}
+
+func networkStatus(state *sandbox.State) *runtimeapi.PodSandboxNetworkStatus {
+	status := &runtimeapi.PodSandboxNetworkStatus{}
+	if len(state.IPs) == 0 {
+		return status
+	}
+	status.Ip = state.IPs[0]
+	for _, ip := range state.IPs[1:] {
+		status.AdditionalIps = append(status.AdditionalIps, &runtimeapi.PodIP{Ip: ip})
+	}
+	return status
+}
+
+func sandboxMetadata(m sandbox.Metadata) *runtimeapi.PodSandboxMetadata {
+	return &runtimeapi.PodSandboxMetadata{
+		Name:      m.Name,
+		Uid:       m.Uid,
+		Namespace: m.Namespace,
+		Attempt:   m.Attempt,
+	}
+}
+
+func (s *runtimeService) sandboxDir(id sandbox.Id) string {
+	return path.Join(s.sandboxesDir(), id.String())
+}
+
+func (s *runtimeService) sandboxesDir() string {
+	return path.Join(s.rootDir, "sandboxes")
+}
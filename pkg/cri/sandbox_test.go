@@ -0,0 +1,101 @@
+package cri
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"simpleconman/pkg/container"
+	"simpleconman/pkg/sandbox"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+func TestStopRemovePodSandbox(t *testing.T) {
+	s, runtime, store, _ := newCreateTestService(t)
+	s.sandboxNames = sandbox.NewNameIndex()
+	// the socket path must be short
+	runDir, err := os.MkdirTemp("", "zcm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(runDir) })
+	s.runDir = runDir
+	s.timeout = 5 * time.Second
+	sb, err := s.sandboxes.Get("pod1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.sandboxNames.Reserve(sb.Metadata().FullName(), sb.Id()); err != nil {
+		t.Fatal(err)
+	}
+	pause := sb.Pause()
+	for _, file := range []string{pause.BaseDir(), filepath.Dir(pause.ExitFile())} {
+		if err := os.MkdirAll(file, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pause.Started(); err != nil {
+		t.Fatal(err)
+	}
+	shim := &fakeShim{exit: make(chan struct{})}
+	serveFakeShim(t, runDir, pause.Id(), shim)
+	runtime.killed = func(signal syscall.Signal) {
+		if err := os.WriteFile(pause.ExitFile(), []byte("137"), 0600); err != nil {
+			t.Error(err)
+		}
+		runtime.containers[pause.Id()].Status = container.Stopped
+		close(shim.exit)
+	}
+	// the exited container of the sandbox
+	resp, err := s.CreateContainer(context.Background(), createRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cont, err := store.Get(container.Id(resp.ContainerId))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cont.ExitFile(), []byte("0"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	runtime.containers[cont.Id()].Status = container.Stopped
+
+	// stopping and removing twice are not errors
+	for i := 0; i < 2; i++ {
+		if _, err := s.StopPodSandbox(context.Background(), &runtimeapi.StopPodSandboxRequest{PodSandboxId: "pod1"}); err != nil {
+			t.Fatalf("stop #%d: %v", i, err)
+		}
+	}
+	state, err := sb.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Status != sandbox.NotReady {
+		t.Errorf("sandbox status = %v, want not ready", state.Status)
+	}
+	if got := strings.Count(strings.Join(runtime.calls, ","), "Kill"); got != 1 {
+		t.Errorf("pause is killed %d times, want once", got)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := s.RemovePodSandbox(context.Background(), &runtimeapi.RemovePodSandboxRequest{PodSandboxId: "pod1"}); err != nil {
+			t.Fatalf("remove #%d: %v", i, err)
+		}
+	}
+	if _, err := s.sandboxes.Get("pod1"); !errors.Is(err, sandbox.ErrNotFound) {
+		t.Errorf("sandbox is left in store, err = %v", err)
+	}
+	if _, err := store.Get(cont.Id()); !errors.Is(err, container.ErrNotFound) {
+		t.Errorf("container of sandbox is left in store, err = %v", err)
+	}
+	if _, err := os.Stat(sb.BaseDir()); !os.IsNotExist(err) {
+		t.Error("sandbox dir is left")
+	}
+	if err := s.sandboxNames.Reserve(sb.Metadata().FullName(), "next"); err != nil {
+		t.Errorf("sandbox name is not released: %v", err)
+	}
+}
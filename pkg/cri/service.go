@@ -0,0 +1,136 @@
+package cri
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"simpleconman/pkg/cgroups"
+	"simpleconman/pkg/network"
+	"simpleconman/pkg/oci"
+	shim "simpleconman/runtime"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+type Config struct {
+	// RootDir keeps the containers and the sandboxes over restarts
+	RootDir string `json:"rootDir"`
+	// RootfsDir is the rootfs copied into the bundle of every container and
+	// pause container. It must not hold RootDir, which it is copied into.
+	RootfsDir string `json:"rootfsDir"`
+	// RunDir keeps the files which are gone on reboot: exit files, attach
+	// sockets, shim sockets and network namespaces. Managers running at once
+	// need run dirs of their own.
+	RunDir string `json:"runDir"`
+	// LogDir is where the logs of the containers are written unless
+	// kubelet asks for other path
+	LogDir string `json:"logDir"`
+
+	// ShimPath is the path to zcm-shim, which is started for each container
+	ShimPath string `json:"shimPath"`
+	RuncPath string `json:"runcPath"`
+	// RuncRoot is the state dir of runc
+	RuncRoot string `json:"runcRoot"`
+	// Timeout limits how long runc and the shim can take for each call
+	Timeout time.Duration `json:"timeout"`
+	// LogMaxLineSize is the max size of the container log line, longer
+	// line is split. LogSync is when the log is synced to the disk: none,
+	// line or periodic. Zero values are the defaults of the shim.
+	LogMaxLineSize int    `json:"logMaxLineSize"`
+	LogSync        string `json:"logSync"`
+	// LogMaxSize is the size in bytes the shim rotates the container log
+	// over, keeping LogMaxFiles rotated files. The shim does not rotate it
+	// if LogMaxSize is 0, as kubelet does.
+	LogMaxSize  int64 `json:"logMaxSize"`
+	LogMaxFiles int   `json:"logMaxFiles"`
+
+	// CgroupDriver is either cgroupfs or systemd. It must be the same as the
+	// one of kubelet.
+	CgroupDriver       string   `json:"cgroupDriver"`
+	SeccompProfileRoot string   `json:"seccompProfileRoot"`
+	PauseCommand       []string `json:"pauseCommand"`
+
+	// CNIConfDir and CNIBinDirs are for the network of the sandboxes.
+	// Sandboxes have no network but the loopback if CNIConfDir is empty.
+	CNIConfDir string   `json:"cniConfDir"`
+	CNIBinDirs []string `json:"cniBinDirs"`
+
+	// StreamAddr is where the streaming server of Exec, Attach and
+	// PortForward listens on
+	StreamAddr string `json:"streamAddr"`
+}
+
+// NewRuntimeService returns CRI runtime service which restores the sandboxes
+// and the containers of the previous run.
+func NewRuntimeService(cfg Config) (runtimeapi.RuntimeServiceServer, error) {
+	cgroupDriver, err := cgroups.ParseDriver(cfg.CgroupDriver)
+	if err != nil {
+		return nil, err
+	}
+	if isSubdir(cfg.RootDir, cfg.RootfsDir) {
+		return nil, errors.Errorf("root dir [%s] is in rootfs dir [%s]", cfg.RootDir, cfg.RootfsDir)
+	}
+	if _, err := shim.ParseSyncPolicy(cfg.LogSync); err != nil {
+		return nil, err
+	}
+	if cfg.LogMaxSize < 0 || cfg.LogMaxFiles < 0 {
+		return nil, errors.Errorf("invalid log rotation, max size %d and max files %d", cfg.LogMaxSize, cfg.LogMaxFiles)
+	}
+	runtime := oci.NewRuncRuntime(oci.ShimOptions{
+		Path:           cfg.ShimPath,
+		RunDir:         cfg.RunDir,
+		LogMaxLineSize: cfg.LogMaxLineSize,
+		LogSync:        cfg.LogSync,
+		LogMaxSize:     cfg.LogMaxSize,
+		LogMaxFiles:    cfg.LogMaxFiles,
+	}, cfg.RuncPath, cfg.RuncRoot, cgroupDriver == cgroups.Systemd)
+	s := &runtimeService{
+		config:             cfg,
+		runtime:            runtime,
+		rootDir:            cfg.RootDir,
+		rootfsDir:          cfg.RootfsDir,
+		logDir:             cfg.LogDir,
+		exitDir:            path.Join(cfg.RunDir, "exits"),
+		attachDir:          path.Join(cfg.RunDir, "attach"),
+		runDir:             cfg.RunDir,
+		timeout:            cfg.Timeout,
+		seccompProfileRoot: cfg.SeccompProfileRoot,
+		cgroupDriver:       cgroupDriver,
+		pauseCommand:       cfg.PauseCommand,
+		diskUsage:          newDiskUsageCache(diskUsageTTL),
+	}
+	// RuntimeDefault falls back to docker-default if the profile of zcm is
+	// not loaded, so the containers without it can run still
+	if err := oci.LoadDefaultApparmorProfile(); err != nil {
+		logrus.WithError(err).Warn("cannot load default AppArmor profile")
+	}
+	if cfg.CNIConfDir != "" {
+		s.network = network.NewManager(cfg.CNIConfDir, cfg.CNIBinDirs, cfg.RunDir)
+	}
+	for _, dir := range []string{s.rootDir, s.logDir, s.exitDir, s.attachDir} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, errors.Wrapf(err, "cannot create dir [%s]", dir)
+		}
+	}
+	if err := s.restore(); err != nil {
+		return nil, errors.Wrap(err, "cannot restore containers")
+	}
+	if err := s.serveStream(cfg.StreamAddr); err != nil {
+		return nil, err
+	}
+	s.containerGetter = oci.NewRuncContainerGetter(s.store, runtime)
+	return s, nil
+}
+
+// isSubdir reports whether dir is in parent or is parent itself.
+func isSubdir(dir, parent string) bool {
+	rel, err := filepath.Rel(filepath.Clean(parent), filepath.Clean(dir))
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, "../"))
+}
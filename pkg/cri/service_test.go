@@ -0,0 +1,25 @@
+package cri
+
+import "testing"
+
+func TestIsSubdir(t *testing.T) {
+	tests := []struct {
+		dir    string
+		parent string
+		want   bool
+	}{
+		{"/var/lib/zcm", "/var/lib/zcm", true},
+		{"/var/lib/zcm/", "/var/lib/zcm", true},
+		{"/var/lib/zcm/containers", "/var/lib/zcm", true},
+		{"/var/lib/zcm", "/", true},
+		{"/var/lib/zcm", "/var/lib/zcm-rootfs", false},
+		{"/var/lib/zcm-rootfs", "/var/lib/zcm", false},
+		{"/var/lib/zcm/../zcm-rootfs", "/var/lib/zcm", false},
+		{"/var/lib/..zcm", "/var/lib", true},
+	}
+	for _, tt := range tests {
+		if got := isSubdir(tt.dir, tt.parent); got != tt.want {
+			t.Errorf("isSubdir(%q, %q) = %v, want %v", tt.dir, tt.parent, got, tt.want)
+		}
+	}
+}
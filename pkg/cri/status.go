@@ -0,0 +1,96 @@
+package cri
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+const (
+	// kubeletAPIVersion is the version of the API kubelet asks for
+	kubeletAPIVersion = "0.1.0"
+
+	runtimeName = "zcm"
+	// runtimeVersion is the version of zcm
+	runtimeVersion = "0.1.0"
+	// runtimeAPIVersion is the version of CRI zcm serves
+	runtimeAPIVersion = "v1"
+)
+
+const (
+	reasonRuntimeNotReady       = "RuntimeNotReady"
+	reasonNetworkPluginNotReady = "NetworkPluginNotReady"
+)
+
+// Version returns the runtime name, runtime version and runtime API version.
+// The version of runc is reported with the one of zcm.
+func (s *runtimeService) Version(ctx context.Context, r *runtimeapi.VersionRequest) (*runtimeapi.VersionResponse, error) {
+	runcVersion, err := s.runtime.Version()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get runc version")
+	}
+	return &runtimeapi.VersionResponse{
+		Version:           kubeletAPIVersion,
+		RuntimeName:       runtimeName,
+		RuntimeVersion:    fmt.Sprintf("%s (runc %s)", runtimeVersion, runcVersion),
+		RuntimeApiVersion: runtimeAPIVersion,
+	}, nil
+}
+
+// Status returns the status of the runtime. Runtime is ready if runc is
+// reachable and the root dir is writable. Network is ready if there is a
+// network config, or the network is disabled.
+func (s *runtimeService) Status(ctx context.Context, r *runtimeapi.StatusRequest) (*runtimeapi.StatusResponse, error) {
+	runtimeCondition := &runtimeapi.RuntimeCondition{
+		Type:   runtimeapi.RuntimeReady,
+		Status: true,
+	}
+	if err := s.runtimeReady(); err != nil {
+		runtimeCondition.Status = false
+		runtimeCondition.Reason = reasonRuntimeNotReady
+		runtimeCondition.Message = err.Error()
+	}
+	networkCondition := &runtimeapi.RuntimeCondition{
+		Type:   runtimeapi.NetworkReady,
+		Status: true,
+	}
+	if s.network != nil {
+		if err := s.network.Ready(); err != nil {
+			networkCondition.Status = false
+			networkCondition.Reason = reasonNetworkPluginNotReady
+			networkCondition.Message = err.Error()
+		}
+	}
+
+	resp := &runtimeapi.StatusResponse{
+		Status: &runtimeapi.RuntimeStatus{
+			Conditions: []*runtimeapi.RuntimeCondition{runtimeCondition, networkCondition},
+		},
+	}
+	if !r.GetVerbose() {
+		return resp, nil
+	}
+	b, err := json.Marshal(s.config)
+	if err != nil {
+		return nil, err
+	}
+	resp.Info = map[string]string{"config": string(b)}
+	return resp, nil
+}
+
+func (s *runtimeService) runtimeReady() error {
+	if _, err := s.runtime.Version(); err != nil {
+		return errors.Wrap(err, "runc is not reachable")
+	}
+	f, err := ioutil.TempFile(s.rootDir, ".status")
+	if err != nil {
+		return errors.Wrap(err, "root dir is not writable")
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
@@ -0,0 +1,174 @@
+package cri
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"simpleconman/pkg/network"
+	"simpleconman/pkg/oci"
+	"strings"
+	"testing"
+
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+func TestVersion(t *testing.T) {
+	tests := []struct {
+		name        string
+		runtime     func(t *testing.T) oci.Runtime
+		wantVersion string
+		wantErr     bool
+	}{
+		{
+			name: "runc",
+			runtime: func(t *testing.T) oci.Runtime {
+				return newFakeRuntime()
+			},
+			wantVersion: "0.1.0 (runc 1.0.0)",
+		},
+		{
+			name: "runc fails",
+			runtime: func(t *testing.T) oci.Runtime {
+				runtime := newFakeRuntime()
+				runtime.errs["Version"] = errors.New("injected")
+				return runtime
+			},
+			wantErr: true,
+		},
+		{
+			name: "runc missing",
+			runtime: func(t *testing.T) oci.Runtime {
+				return oci.NewRuncRuntime(oci.ShimOptions{}, filepath.Join(t.TempDir(), "runc"), t.TempDir(), false)
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &runtimeService{runtime: tt.runtime(t)}
+			resp, err := s.Version(context.Background(), &runtimeapi.VersionRequest{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Version() error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if resp.RuntimeName != runtimeName || resp.RuntimeApiVersion != runtimeAPIVersion {
+				t.Errorf("runtime = %s %s, want %s %s", resp.RuntimeName, resp.RuntimeApiVersion, runtimeName, runtimeAPIVersion)
+			}
+			if resp.RuntimeVersion != tt.wantVersion {
+				t.Errorf("runtime version = %q, want %q", resp.RuntimeVersion, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestStatus(t *testing.T) {
+	// ready is the condition which is true, or false with the reason
+	type ready struct {
+		status bool
+		reason string
+	}
+	tests := []struct {
+		name        string
+		setup       func(t *testing.T, s *runtimeService, runtime *fakeRuntime)
+		wantRuntime ready
+		wantNetwork ready
+	}{
+		{
+			name:        "ready without network",
+			setup:       func(t *testing.T, s *runtimeService, runtime *fakeRuntime) {},
+			wantRuntime: ready{true, ""},
+			wantNetwork: ready{true, ""},
+		},
+		{
+			name: "ready with network",
+			setup: func(t *testing.T, s *runtimeService, runtime *fakeRuntime) {
+				confDir := t.TempDir()
+				conf := `{"cniVersion":"1.0.0","name":"net","type":"bridge"}`
+				if err := os.WriteFile(filepath.Join(confDir, "10-net.conf"), []byte(conf), 0644); err != nil {
+					t.Fatal(err)
+				}
+				s.network = network.NewManager(confDir, []string{t.TempDir()}, t.TempDir())
+			},
+			wantRuntime: ready{true, ""},
+			wantNetwork: ready{true, ""},
+		},
+		{
+			name: "runc not reachable",
+			setup: func(t *testing.T, s *runtimeService, runtime *fakeRuntime) {
+				runtime.errs["Version"] = errors.New("injected")
+			},
+			wantRuntime: ready{false, reasonRuntimeNotReady},
+			wantNetwork: ready{true, ""},
+		},
+		{
+			name: "root dir unwritable",
+			setup: func(t *testing.T, s *runtimeService, runtime *fakeRuntime) {
+				// even root cannot create a file under a regular file
+				file := filepath.Join(t.TempDir(), "file")
+				if err := os.WriteFile(file, nil, 0600); err != nil {
+					t.Fatal(err)
+				}
+				s.rootDir = filepath.Join(file, "root")
+			},
+			wantRuntime: ready{false, reasonRuntimeNotReady},
+			wantNetwork: ready{true, ""},
+		},
+		{
+			name: "network not ready",
+			setup: func(t *testing.T, s *runtimeService, runtime *fakeRuntime) {
+				s.network = network.NewManager(t.TempDir(), []string{t.TempDir()}, t.TempDir())
+			},
+			wantRuntime: ready{true, ""},
+			wantNetwork: ready{false, reasonNetworkPluginNotReady},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runtime := newFakeRuntime()
+			s := &runtimeService{runtime: runtime, rootDir: t.TempDir()}
+			tt.setup(t, s, runtime)
+
+			resp, err := s.Status(context.Background(), &runtimeapi.StatusRequest{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			conditions := map[string]*runtimeapi.RuntimeCondition{}
+			for _, c := range resp.Status.Conditions {
+				conditions[c.Type] = c
+			}
+			for condType, want := range map[string]ready{
+				runtimeapi.RuntimeReady: tt.wantRuntime,
+				runtimeapi.NetworkReady: tt.wantNetwork,
+			} {
+				c, ok := conditions[condType]
+				if !ok {
+					t.Errorf("no %s condition", condType)
+					continue
+				}
+				if c.Status != want.status || c.Reason != want.reason {
+					t.Errorf("%s = %v (%s), want %v (%s)", condType, c.Status, c.Reason, want.status, want.reason)
+				}
+				if !c.Status && c.Message == "" {
+					t.Errorf("%s has no message", condType)
+				}
+			}
+			if entries, _ := os.ReadDir(s.rootDir); len(entries) != 0 {
+				t.Errorf("files are left in root dir: %v", entries)
+			}
+		})
+	}
+}
+
+func TestStatusVerbose(t *testing.T) {
+	s := &runtimeService{runtime: newFakeRuntime(), rootDir: t.TempDir(), config: Config{RootDir: "/var/lib/zcm"}}
+	resp, err := s.Status(context.Background(), &runtimeapi.StatusRequest{Verbose: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(resp.Info["config"], "/var/lib/zcm") {
+		t.Errorf("config info = %q, want the config", resp.Info["config"])
+	}
+}
@@ -0,0 +1,212 @@
+package cri
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"simpleconman/pkg/container"
+	"simpleconman/pkg/network"
+	"simpleconman/pkg/oci"
+	"simpleconman/pkg/sandbox"
+	shim "simpleconman/runtime"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/tools/remotecommand"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+	"k8s.io/kubelet/pkg/cri/streaming"
+	utilexec "k8s.io/utils/exec"
+)
+
+// DefaultStreamAddr is where the streaming server listens on. Port 0 picks
+// a free port.
+const DefaultStreamAddr = "127.0.0.1:0"
+
+// Exec returns the URL of the streaming server to run the command in the
+// container.
+func (s *runtimeService) Exec(ctx context.Context, r *runtimeapi.ExecRequest) (*runtimeapi.ExecResponse, error) {
+	if _, err := s.runningContainer(r.GetContainerId()); err != nil {
+		return nil, err
+	}
+	return s.stream.GetExec(r)
+}
+
+// Attach returns the URL of the streaming server to attach to the container.
+func (s *runtimeService) Attach(ctx context.Context, r *runtimeapi.AttachRequest) (*runtimeapi.AttachResponse, error) {
+	if _, err := s.runningContainer(r.GetContainerId()); err != nil {
+		return nil, err
+	}
+	return s.stream.GetAttach(r)
+}
+
+// PortForward returns the URL of the streaming server to forward the ports
+// of the sandbox.
+func (s *runtimeService) PortForward(ctx context.Context, r *runtimeapi.PortForwardRequest) (*runtimeapi.PortForwardResponse, error) {
+	if _, _, err := s.readySandbox(sandbox.Id(r.GetPodSandboxId())); err != nil {
+		return nil, err
+	}
+	return s.stream.GetPortForward(r)
+}
+
+func (s *runtimeService) runningContainer(id string) (*container.Handle, error) {
+	cont, handle, err := s.containerGetter.Get(container.Id(id))
+	if err != nil {
+		return nil, err
+	}
+	if cont.Status != container.Running {
+		return nil, fmt.Errorf("container is not running. container status [%s]", cont.Status.String())
+	}
+	return handle, nil
+}
+
+// serveStream creates the streaming server on addr, and serves it in the
+// background. The requests are authorized by the single use tokens of the
+// URLs returned by Exec, Attach and PortForward.
+func (s *runtimeService) serveStream(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errors.Wrap(err, "cannot listen for streaming server")
+	}
+	config := streaming.DefaultConfig
+	config.Addr = l.Addr().String()
+	server, err := streaming.NewServer(config, &streamRuntime{s})
+	if err != nil {
+		l.Close()
+		return errors.Wrap(err, "cannot create streaming server")
+	}
+	s.stream = server
+	go func() {
+		logrus.WithField("addr", config.Addr).Info("serving streams")
+		if err := http.Serve(l, server); err != nil {
+			logrus.WithError(err).Error("streaming server exited")
+		}
+	}()
+	return nil
+}
+
+// streamRuntime runs what the streaming server serves.
+type streamRuntime struct {
+	s *runtimeService
+}
+
+// Exec runs the command in the container until it exits. Non zero exit code
+// is returned as utilexec.ExitError, which the client gets as is.
+func (r *streamRuntime) Exec(ctx context.Context, containerID string, cmd []string,
+	in io.Reader, out, errOut io.WriteCloser, tty bool, resize <-chan remotecommand.TerminalSize) error {
+	handle, err := r.s.runningContainer(containerID)
+	if err != nil {
+		return err
+	}
+	process, err := oci.ExecProcess(handle.RuntimeSpecFile(), cmd, tty)
+	if err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	exitCode, err := r.s.runtime.Exec(ctx, handle, process, oci.Stdio{
+		Stdin:  in,
+		Stdout: out,
+		Stderr: errOut,
+		Resize: terminalSizes(resize, done),
+	})
+	if err != nil {
+		return errors.Wrap(err, "cannot exec in container")
+	}
+	if exitCode != 0 {
+		return utilexec.CodeExitError{
+			Err:  errors.Errorf("command %v exited with %d", cmd, exitCode),
+			Code: exitCode,
+		}
+	}
+	return nil
+}
+
+// Attach connects the streams to the container process through the attach
+// socket of the shim until the process exits or the client goes away.
+func (r *streamRuntime) Attach(ctx context.Context, containerID string,
+	in io.Reader, out, errOut io.WriteCloser, tty bool, resize <-chan remotecommand.TerminalSize) error {
+	handle, err := r.s.runningContainer(containerID)
+	if err != nil {
+		return err
+	}
+	if tty {
+		// the terminal is resized by the shim, which holds its master
+		client, err := shim.Dial(ctx, r.s.runDir, containerID)
+		if err != nil {
+			return errors.Wrapf(err, "cannot connect to shim of container [%s] to resize terminal", containerID)
+		}
+		defer client.Close()
+		done := make(chan struct{})
+		defer close(done)
+		go resizeAttached(ctx, client, containerID, terminalSizes(resize, done))
+	}
+	return attach(ctx, handle.AttachFile(), in, out, errOut)
+}
+
+// resizeAttached resizes the terminal of the container through its shim
+// until the sizes end.
+func resizeAttached(ctx context.Context, client *shim.Client, containerID string, sizes <-chan oci.TerminalSize) {
+	for size := range sizes {
+		if err := client.ResizePty(ctx, size.Width, size.Height); err != nil {
+			logrus.WithError(err).Warnf("cannot resize terminal of container [%s]", containerID)
+		}
+	}
+}
+
+// PortForward connects the stream to the port on localhost in the network
+// namespace of the sandbox.
+func (r *streamRuntime) PortForward(ctx context.Context, podSandboxID string, port int32, stream io.ReadWriteCloser) error {
+	_, state, err := r.s.readySandbox(sandbox.Id(podSandboxID))
+	if err != nil {
+		return err
+	}
+	conn, err := network.Dial(state.NamespacePath("net"), "tcp4", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return errors.Wrapf(err, "cannot connect to port %d of pod sandbox [%s]", port, podSandboxID)
+	}
+	defer conn.Close()
+
+	go func() {
+		io.Copy(conn, stream)
+		// the client has nothing more to send, which the port is told
+		conn.(*net.TCPConn).CloseWrite()
+	}()
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(stream, conn)
+		errCh <- err
+	}()
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// terminalSizes converts the resize events of the stream until done is
+// closed.
+func terminalSizes(resize <-chan remotecommand.TerminalSize, done <-chan struct{}) <-chan oci.TerminalSize {
+	ch := make(chan oci.TerminalSize)
+	go func() {
+		defer close(ch)
+		for {
+			select {
+			case size, ok := <-resize:
+				if !ok {
+					return
+				}
+				select {
+				case ch <- oci.TerminalSize{Width: size.Width, Height: size.Height}:
+				case <-done:
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return ch
+}
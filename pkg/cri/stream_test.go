@@ -0,0 +1,96 @@
+package cri
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"simpleconman/pkg/container"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// fakeGetter returns the container of the handle as running
+type fakeGetter struct {
+	handle *container.Handle
+}
+
+func (g *fakeGetter) Get(id container.Id) (*container.Instance, *container.Handle, error) {
+	return &container.Instance{Id: id, Status: container.Running}, g.handle, nil
+}
+
+func (g *fakeGetter) List() ([]*container.Instance, error) {
+	return nil, nil
+}
+
+// listenAttach serves the attach socket of the container, which sends the
+// output and closes the connection.
+func listenAttach(t *testing.T, handle *container.Handle, output string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(handle.AttachFile()), 0700); err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.ListenUnix("unixpacket", &net.UnixAddr{Name: handle.AttachFile(), Net: "unixpacket"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.AcceptUnix()
+			if err != nil {
+				return
+			}
+			conn.Write(append([]byte{attachPipeStdout}, output...))
+			conn.Close()
+		}
+	}()
+}
+
+type nopCloser struct {
+	*bytes.Buffer
+}
+
+func (nopCloser) Close() error { return nil }
+
+func TestAttach(t *testing.T) {
+	tests := []struct {
+		name    string
+		tty     bool
+		wantErr string
+	}{
+		{"no terminal", false, ""},
+		// the terminal could not be resized without the shim
+		{"terminal without shim", true, "to resize terminal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handle := newTestContainer(t, "attach-test-"+strings.ReplaceAll(tt.name, " ", "-"), container.Metadata{})
+			listenAttach(t, handle, "hello")
+			r := &streamRuntime{&runtimeService{containerGetter: &fakeGetter{handle}}}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			out := nopCloser{&bytes.Buffer{}}
+			resize := make(chan remotecommand.TerminalSize)
+			defer close(resize)
+			err := r.Attach(ctx, handle.Id().String(), nil, out, nopCloser{&bytes.Buffer{}}, tt.tty, resize)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != "hello" {
+				t.Errorf("stdout = %q, want hello", out.String())
+			}
+		})
+	}
+}
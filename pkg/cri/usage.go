@@ -0,0 +1,60 @@
+package cri
+
+import (
+	"simpleconman/pkg/fsutil"
+	"sync"
+	"time"
+)
+
+// diskUsageTTL is how long the writable layer usage is reused. The rootfs is
+// copied into every container, so walking it on every stats call of kubelet
+// costs far more than fresher usage is worth.
+const diskUsageTTL = time.Minute
+
+type diskUsage struct {
+	bytes     uint64
+	inodes    uint64
+	updatedAt time.Time
+}
+
+// diskUsageCache keeps the disk usage of the dirs for ttl.
+type diskUsageCache struct {
+	ttl time.Duration
+
+	mu     sync.Mutex
+	usages map[string]diskUsage
+}
+
+func newDiskUsageCache(ttl time.Duration) *diskUsageCache {
+	return &diskUsageCache{
+		ttl:    ttl,
+		usages: make(map[string]diskUsage),
+	}
+}
+
+// get returns bytes and inodes used by the dir, walking it only if the
+// cached usage is older than ttl.
+func (c *diskUsageCache) get(dir string) (uint64, uint64, error) {
+	c.mu.Lock()
+	usage, ok := c.usages[dir]
+	c.mu.Unlock()
+	if ok && time.Since(usage.updatedAt) < c.ttl {
+		return usage.bytes, usage.inodes, nil
+	}
+
+	bytes, inodes, err := fsutil.DiskUsage(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+	c.mu.Lock()
+	c.usages[dir] = diskUsage{bytes: bytes, inodes: inodes, updatedAt: time.Now()}
+	c.mu.Unlock()
+	return bytes, inodes, nil
+}
+
+// forget drops the usage of the dir, which is removed.
+func (c *diskUsageCache) forget(dir string) {
+	c.mu.Lock()
+	delete(c.usages, dir)
+	c.mu.Unlock()
+}
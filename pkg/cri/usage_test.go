@@ -0,0 +1,48 @@
+package cri
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDiskUsageCache(t *testing.T) {
+	tests := []struct {
+		name       string
+		ttl        time.Duration
+		forget     bool
+		wantInodes uint64
+	}{
+		// the dir and file1 are counted, file2 is written after
+		{"cached", time.Hour, false, 2},
+		{"expired", 0, false, 3},
+		{"forgotten", time.Hour, true, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "file1"), []byte("1"), 0600); err != nil {
+				t.Fatal(err)
+			}
+			c := newDiskUsageCache(tt.ttl)
+			if _, inodes, err := c.get(dir); err != nil || inodes != 2 {
+				t.Fatalf("get() = %d inodes, %v, want 2", inodes, err)
+			}
+
+			if err := os.WriteFile(filepath.Join(dir, "file2"), []byte("2"), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if tt.forget {
+				c.forget(dir)
+			}
+			_, inodes, err := c.get(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if inodes != tt.wantInodes {
+				t.Errorf("get() = %d inodes, want %d", inodes, tt.wantInodes)
+			}
+		})
+	}
+}
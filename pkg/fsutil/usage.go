@@ -0,0 +1,37 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// DiskUsage walks the dir and returns bytes and inodes used by it. Hard
+// links are counted once.
+func DiskUsage(dir string) (bytes uint64, inodes uint64, err error) {
+	seen := make(map[uint64]struct{})
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// files may be removed while walking
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		stat, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			bytes += uint64(info.Size())
+			inodes++
+			return nil
+		}
+		if _, ok := seen[stat.Ino]; ok {
+			return nil
+		}
+		seen[stat.Ino] = struct{}{}
+		// st_blocks is always in 512-byte units
+		bytes += uint64(stat.Blocks) * 512
+		inodes++
+		return nil
+	})
+	return bytes, inodes, err
+}
@@ -0,0 +1,17 @@
+package fsutil
+
+import (
+	"io/ioutil"
+	"os"
+)
+
+// WriteFileAtomic writes b to a tmp file and renames it to file, so readers
+// never see the file half-written.
+func WriteFileAtomic(file string, b []byte, perm os.FileMode) error {
+	tmpfile := file + ".writing"
+
+	if err := ioutil.WriteFile(tmpfile, b, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmpfile, file)
+}
@@ -0,0 +1,89 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// createNetNS creates a network namespace pinned by bind mount at file, so
+// the namespace lives without any process in it.
+func createNetNS(file string) (retErr error) {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return errors.Wrap(err, "cannot create netns dir")
+	}
+	f, err := os.OpenFile(file, os.O_RDONLY|os.O_CREATE|os.O_EXCL, 0444)
+	if err != nil {
+		return errors.Wrap(err, "cannot create netns file")
+	}
+	f.Close()
+	defer func() {
+		if retErr != nil {
+			os.Remove(file)
+		}
+	}()
+
+	errCh := make(chan error, 1)
+	go func() {
+		// the thread is never unlocked, so it exits with the goroutine
+		// instead of running others in the new namespace
+		runtime.LockOSThread()
+		if err := unix.Unshare(unix.CLONE_NEWNET); err != nil {
+			errCh <- errors.Wrap(err, "cannot unshare network namespace")
+			return
+		}
+		src := fmt.Sprintf("/proc/self/task/%d/ns/net", unix.Gettid())
+		if err := unix.Mount(src, file, "none", unix.MS_BIND, ""); err != nil {
+			errCh <- errors.Wrap(err, "cannot bind mount network namespace")
+			return
+		}
+		errCh <- nil
+	}()
+	return <-errCh
+}
+
+// removeNetNS unmounts and removes the namespace file. Removing it twice is
+// not an error.
+func removeNetNS(file string) error {
+	err := unix.Unmount(file, unix.MNT_DETACH)
+	if err != nil && err != unix.EINVAL && err != unix.ENOENT {
+		return errors.Wrap(err, "cannot unmount network namespace")
+	}
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "cannot remove netns file")
+	}
+	return nil
+}
+
+// Dial connects to the address in the network namespace at netnsPath.
+func Dial(netnsPath, network, address string) (net.Conn, error) {
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		// the thread is never unlocked, so it exits with the goroutine
+		// instead of running others in the namespace
+		runtime.LockOSThread()
+		f, err := os.Open(netnsPath)
+		if err != nil {
+			ch <- result{err: errors.Wrap(err, "cannot open network namespace")}
+			return
+		}
+		defer f.Close()
+		if err := unix.Setns(int(f.Fd()), unix.CLONE_NEWNET); err != nil {
+			ch <- result{err: errors.Wrap(err, "cannot enter network namespace")}
+			return
+		}
+		conn, err := net.Dial(network, address)
+		ch <- result{conn: conn, err: err}
+	}()
+	r := <-ch
+	return r.conn, r.err
+}
@@ -0,0 +1,242 @@
+package network
+
+import (
+	"context"
+	"path"
+	"sort"
+
+	"github.com/containernetworking/cni/libcni"
+	"github.com/containernetworking/cni/pkg/invoke"
+	types100 "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultConfDir = "/etc/cni/net.d"
+	DefaultBinDir  = "/opt/cni/bin"
+
+	// ifName is the interface of the pod created by the CNI plugins
+	ifName = "eth0"
+)
+
+// loopback network brings up the loopback interface of the pod
+const (
+	loopbackNetwork = "cni-loopback"
+	loopbackConf    = `{
+	"cniVersion": "0.3.1",
+	"name": "` + loopbackNetwork + `",
+	"plugins": [{"type": "loopback"}]
+}`
+)
+
+// PodInfo is what the CNI plugins are told about the pod.
+type PodInfo struct {
+	// Id is the pod sandbox id
+	Id        string
+	Name      string
+	Namespace string
+	Uid       string
+}
+
+func (p PodInfo) args() [][2]string {
+	return [][2]string{
+		{"IgnoreUnknown", "1"},
+		{"K8S_POD_NAMESPACE", p.Namespace},
+		{"K8S_POD_NAME", p.Name},
+		{"K8S_POD_INFRA_CONTAINER_ID", p.Id},
+		{"K8S_POD_UID", p.Uid},
+	}
+}
+
+// Manager sets up the network of the pod sandboxes with the CNI plugins.
+// The network of the pod is the first network config in the conf dir by
+// name, as kubelet does.
+type Manager struct {
+	cni      *libcni.CNIConfig
+	confDir  string
+	binDirs  []string
+	netnsDir string
+}
+
+// NewManager returns the manager which reads network configs from confDir,
+// and runs plugins in binDirs. Network namespaces are created under runDir.
+func NewManager(confDir string, binDirs []string, runDir string) *Manager {
+	return &Manager{
+		cni:      libcni.NewCNIConfig(binDirs, nil),
+		confDir:  confDir,
+		binDirs:  binDirs,
+		netnsDir: path.Join(runDir, "netns"),
+	}
+}
+
+func (m *Manager) netNSPath(id string) string {
+	return path.Join(m.netnsDir, id)
+}
+
+// networks returns the network config lists the pod is attached to.
+func (m *Manager) networks() ([]*libcni.NetworkConfigList, error) {
+	files, err := libcni.ConfFiles(m.confDir, []string{".conf", ".conflist", ".json"})
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read CNI conf dir")
+	}
+	sort.Strings(files)
+	var network *libcni.NetworkConfigList
+	for _, file := range files {
+		network, err = loadConfList(file)
+		if err != nil {
+			logrus.WithError(err).Warnf("skip invalid CNI config [%s]", file)
+			continue
+		}
+		if len(network.Plugins) == 0 {
+			logrus.Warnf("skip CNI config without plugins [%s]", file)
+			network = nil
+			continue
+		}
+		break
+	}
+	if network == nil {
+		return nil, errors.Errorf("no valid CNI config in [%s]", m.confDir)
+	}
+
+	result := []*libcni.NetworkConfigList{}
+	if _, err := invoke.FindInPath("loopback", m.binDirs); err == nil {
+		loopback, err := libcni.ConfListFromBytes([]byte(loopbackConf))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, loopback)
+	}
+	return append(result, network), nil
+}
+
+func loadConfList(file string) (*libcni.NetworkConfigList, error) {
+	if path.Ext(file) == ".conflist" {
+		return libcni.ConfListFromFile(file)
+	}
+	conf, err := libcni.ConfFromFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return libcni.ConfListFromConf(conf)
+}
+
+func interfaceName(network *libcni.NetworkConfigList) string {
+	if network.Name == loopbackNetwork {
+		return "lo"
+	}
+	return ifName
+}
+
+func (m *Manager) runtimeConf(pod PodInfo, netnsPath string, ifName string) *libcni.RuntimeConf {
+	return &libcni.RuntimeConf{
+		ContainerID: pod.Id,
+		NetNS:       netnsPath,
+		IfName:      ifName,
+		Args:        pod.args(),
+	}
+}
+
+// Ready reports an error if there is no network config the pods can be
+// attached to.
+func (m *Manager) Ready() error {
+	_, err := m.networks()
+	return err
+}
+
+// Setup creates the network namespace of the pod and attaches it to the
+// networks. It returns the path of the namespace and the IPs of the pod. The
+// namespace is removed if it fails.
+func (m *Manager) Setup(ctx context.Context, pod PodInfo) (_ string, _ []string, retErr error) {
+	networks, err := m.networks()
+	if err != nil {
+		return "", nil, err
+	}
+	netnsPath := m.netNSPath(pod.Id)
+	if err := createNetNS(netnsPath); err != nil {
+		return "", nil, err
+	}
+	// the network which fails to be added may be added halfway, so it is
+	// deleted with the added ones
+	var attempted []*libcni.NetworkConfigList
+	defer func() {
+		if retErr != nil {
+			if err := m.delNetworks(context.Background(), attempted, pod, netnsPath); err != nil {
+				logrus.WithError(err).Warnf("rollback: cannot delete sandbox [%s] from networks", pod.Id)
+			}
+			if err := removeNetNS(netnsPath); err != nil {
+				logrus.WithError(err).Warnf("rollback: cannot remove network namespace of sandbox [%s]", pod.Id)
+			}
+		}
+	}()
+
+	ips := []string{}
+	for _, network := range networks {
+		attempted = append(attempted, network)
+		name := interfaceName(network)
+		result, err := m.cni.AddNetworkList(ctx, network, m.runtimeConf(pod, netnsPath, name))
+		if err != nil {
+			return "", nil, errors.Wrapf(err, "cannot add pod to network [%s]", network.Name)
+		}
+		if network.Name == loopbackNetwork {
+			continue
+		}
+		r, err := types100.NewResultFromResult(result)
+		if err != nil {
+			return "", nil, errors.Wrap(err, "cannot convert CNI result")
+		}
+		for _, ip := range r.IPs {
+			ips = append(ips, ip.Address.IP.String())
+		}
+	}
+	return netnsPath, ips, nil
+}
+
+// Teardown detaches the pod from the networks and removes its network
+// namespace. Tearing down twice is not an error.
+func (m *Manager) Teardown(ctx context.Context, pod PodInfo, netnsPath string) error {
+	networks, err := m.networks()
+	if err != nil {
+		// nothing can be deleted without the config, but the namespace
+		logrus.WithError(err).Warnf("cannot delete sandbox [%s] from networks", pod.Id)
+		return removeNetNS(netnsPath)
+	}
+	if err := m.delNetworks(ctx, networks, pod, netnsPath); err != nil {
+		return err
+	}
+	return removeNetNS(netnsPath)
+}
+
+// delNetworks deletes the pod from the networks in reverse order of
+// addition. The network which cannot be deleted does not keep the pod in the
+// others, and the first error is returned.
+func (m *Manager) delNetworks(ctx context.Context, networks []*libcni.NetworkConfigList, pod PodInfo, netnsPath string) error {
+	var firstErr error
+	for i := len(networks) - 1; i >= 0; i-- {
+		rt := m.runtimeConf(pod, netnsPath, interfaceName(networks[i]))
+		if err := m.cni.DelNetworkList(ctx, networks[i], rt); err != nil {
+			err = errors.Wrapf(err, "cannot delete pod from network [%s]", networks[i].Name)
+			if firstErr != nil {
+				logrus.WithError(err).Warnf("cannot delete sandbox [%s] from network", pod.Id)
+				continue
+			}
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Check asks the plugins whether the network of the pod is as it was set up.
+func (m *Manager) Check(ctx context.Context, pod PodInfo, netnsPath string) error {
+	networks, err := m.networks()
+	if err != nil {
+		return err
+	}
+	for _, network := range networks {
+		rt := m.runtimeConf(pod, netnsPath, interfaceName(network))
+		if err := m.cni.CheckNetworkList(ctx, network, rt); err != nil {
+			return errors.Wrapf(err, "network [%s] of pod is broken", network.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package network
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/containernetworking/cni/libcni"
+)
+
+// fakePlugin logs "<command> <network> <interface>" of every call to the log
+// file in its dir. ADD answers the "ip" of the plugin config as the IP of
+// the pod.
+const fakePlugin = `#!/bin/sh
+conf=$(cat)
+field() {
+	printf '%s' "$conf" | grep -o "\"$1\": *\"[^\"]*\"" | head -n 1 | sed 's/.*"\([^"]*\)"$/\1/'
+}
+echo "$CNI_COMMAND $(field name) $CNI_IFNAME" >> "$(dirname "$0")/log"
+if [ "$CNI_COMMAND" = ADD ]; then
+	ip=$(field ip)
+	if [ -n "$ip" ]; then
+		printf '{"cniVersion":"%s","ips":[{"address":"%s/24"}]}' "$(field cniVersion)" "$ip"
+	else
+		printf '{"cniVersion":"%s"}' "$(field cniVersion)"
+	fi
+fi
+`
+
+// newTestManager returns the manager with the network configs by file name,
+// and the fake plugins by name in its bin dir.
+func newTestManager(t *testing.T, confs map[string]string, plugins ...string) (*Manager, string) {
+	t.Helper()
+	dir := t.TempDir()
+	confDir := filepath.Join(dir, "net.d")
+	binDir := filepath.Join(dir, "bin")
+	for _, d := range []string{confDir, binDir} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, conf := range confs {
+		if err := os.WriteFile(filepath.Join(confDir, name), []byte(conf), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, plugin := range plugins {
+		if err := os.WriteFile(filepath.Join(binDir, plugin), []byte(fakePlugin), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := NewManager(confDir, []string{binDir}, filepath.Join(dir, "run"))
+	// results are cached in the test dir instead of /var/lib/cni
+	m.cni = libcni.NewCNIConfigWithCacheDir(m.binDirs, filepath.Join(dir, "cache"), nil)
+	return m, filepath.Join(binDir, "log")
+}
+
+func conf(name string) string {
+	return `{"cniVersion":"1.0.0","name":"` + name + `","type":"fake","ip":"10.0.0.5"}`
+}
+
+func conflist(name string) string {
+	return `{"cniVersion":"1.0.0","name":"` + name + `","plugins":[{"type":"fake","ip":"10.0.0.5"}]}`
+}
+
+func TestNetworks(t *testing.T) {
+	tests := []struct {
+		name    string
+		confs   map[string]string
+		plugins []string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "first by name",
+			confs:   map[string]string{"20-b.conf": conf("b"), "10-a.conflist": conflist("a")},
+			plugins: []string{"fake", "loopback"},
+			want:    "cni-loopback,a",
+		},
+		{
+			name:    "invalid skipped",
+			confs:   map[string]string{"10-a.conf": "{", "20-b.conf": conf("b")},
+			plugins: []string{"fake", "loopback"},
+			want:    "cni-loopback,b",
+		},
+		{
+			name: "without plugins skipped",
+			confs: map[string]string{
+				"10-a.conflist": `{"cniVersion":"1.0.0","name":"a","plugins":[]}`,
+				"20-b.conflist": conflist("b"),
+			},
+			plugins: []string{"fake", "loopback"},
+			want:    "cni-loopback,b",
+		},
+		{
+			name:    "other extension ignored",
+			confs:   map[string]string{"10-a.txt": conf("a"), "20-b.json": conf("b")},
+			plugins: []string{"fake", "loopback"},
+			want:    "cni-loopback,b",
+		},
+		{
+			name:    "without loopback plugin",
+			confs:   map[string]string{"10-a.conf": conf("a")},
+			plugins: []string{"fake"},
+			want:    "a",
+		},
+		{
+			name:    "no valid config",
+			confs:   map[string]string{"10-a.conf": "{"},
+			plugins: []string{"fake", "loopback"},
+			wantErr: true,
+		},
+		{
+			name:    "no config",
+			plugins: []string{"fake", "loopback"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _ := newTestManager(t, tt.confs, tt.plugins...)
+			networks, err := m.networks()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("networks() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err := m.Ready(); (err != nil) != tt.wantErr {
+				t.Errorf("Ready() error = %v, want error %v", err, tt.wantErr)
+			}
+			names := []string{}
+			for _, network := range networks {
+				names = append(names, network.Name)
+			}
+			if got := strings.Join(names, ","); got != tt.want {
+				t.Errorf("networks = [%s], want [%s]", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetupTeardown(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("network namespace needs root")
+	}
+	m, log := newTestManager(t, map[string]string{"10-net.conflist": conflist("net")}, "fake", "loopback")
+	pod := PodInfo{Id: "pod1", Name: "pod", Namespace: "ns", Uid: "uid"}
+
+	netnsPath, ips, err := m.Setup(context.Background(), pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if netnsPath != m.netNSPath(pod.Id) {
+		t.Errorf("netns = %s, want %s", netnsPath, m.netNSPath(pod.Id))
+	}
+	if strings.Join(ips, ",") != "10.0.0.5" {
+		t.Errorf("ips = %v, want [10.0.0.5]", ips)
+	}
+	if _, err := os.Stat(netnsPath); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := m.Teardown(context.Background(), pod, netnsPath); err != nil {
+			t.Fatalf("teardown #%d: %v", i, err)
+		}
+	}
+	if _, err := os.Stat(netnsPath); !os.IsNotExist(err) {
+		t.Error("netns is left")
+	}
+
+	b, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// networks are deleted in reverse order of addition
+	want := []string{
+		"ADD cni-loopback lo",
+		"ADD net eth0",
+		"DEL net eth0",
+		"DEL cni-loopback lo",
+		"DEL net eth0",
+		"DEL cni-loopback lo",
+	}
+	if got := strings.Split(strings.TrimSpace(string(b)), "\n"); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("plugin calls = %q, want %q", got, want)
+	}
+}
+
+func TestSetupRollsBack(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("network namespace needs root")
+	}
+	// the network whose plugin is missing cannot be added
+	m, log := newTestManager(t, map[string]string{
+		"10-net.conflist": `{"cniVersion":"1.0.0","name":"net","plugins":[{"type":"missing"}]}`,
+	}, "loopback")
+	pod := PodInfo{Id: "pod1", Name: "pod", Namespace: "ns", Uid: "uid"}
+
+	if _, _, err := m.Setup(context.Background(), pod); err == nil {
+		t.Fatal("Setup succeeded")
+	}
+	if _, err := os.Stat(m.netNSPath(pod.Id)); !os.IsNotExist(err) {
+		t.Error("netns is left")
+	}
+	b, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"ADD cni-loopback lo", "DEL cni-loopback lo"}
+	if got := strings.Split(strings.TrimSpace(string(b)), "\n"); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("plugin calls = %q, want %q", got, want)
+	}
+}
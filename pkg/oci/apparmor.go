@@ -0,0 +1,143 @@
+package oci
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultApparmorProfile is the AppArmor profile applied to RuntimeDefault.
+// It is loaded by LoadDefaultApparmorProfile.
+const DefaultApparmorProfile = "zcm-default"
+
+// dockerApparmorProfile is applied to RuntimeDefault instead if the default
+// profile is not loaded, as docker loads it on the hosts it runs.
+const dockerApparmorProfile = "docker-default"
+
+// apparmorProfilesFile lists the loaded profiles as "<name> (<mode>)"
+const apparmorProfilesFile = "/sys/kernel/security/apparmor/profiles"
+
+// apparmorTemplate is the default profile of docker and containerd by the
+// name of the profile.
+var apparmorTemplate = template.Must(template.New("apparmor").Parse(`#include <tunables/global>
+
+profile {{.}} flags=(attach_disconnected,mediate_deleted) {
+  #include <abstractions/base>
+
+  network,
+  capability,
+  file,
+  umount,
+
+  # host processes may send signals to container processes
+  signal (receive) peer=unconfined,
+  # container processes may send signals amongst themselves
+  signal (send,receive) peer={{.}},
+
+  # deny write for all files directly in /proc (not in a subdir)
+  deny @{PROC}/* w,
+  # deny write to files not in /proc/<number>/** or /proc/sys/**
+  deny @{PROC}/{[^1-9],[^1-9][^0-9],[^1-9s][^0-9y][^0-9s],[^1-9][^0-9][^0-9][^0-9/]*}/** w,
+  # deny /proc/sys except /proc/sys/k* (effectively /proc/sys/kernel)
+  deny @{PROC}/sys/[^k]** w,
+  # deny everything except shm* in /proc/sys/kernel/
+  deny @{PROC}/sys/kernel/{?,??,[^s][^h][^m]**} w,
+  deny @{PROC}/sysrq-trigger rwklx,
+  deny @{PROC}/kcore rwklx,
+
+  deny mount,
+
+  deny /sys/[^f]*/** wklx,
+  deny /sys/f[^s]*/** wklx,
+  deny /sys/fs/[^c]*/** wklx,
+  deny /sys/fs/c[^g]*/** wklx,
+  deny /sys/fs/cg[^r]*/** wklx,
+  deny /sys/firmware/** rwklx,
+  deny /sys/devices/virtual/powercap/** rwklx,
+  deny /sys/kernel/security/** rwklx,
+
+  # suppress ptrace denials when using ps inside a container
+  ptrace (trace,read,tracedby,readby) peer={{.}},
+}
+`))
+
+// LoadDefaultApparmorProfile generates the default profile and loads it by
+// apparmor_parser unless it is loaded already. It does nothing if the host
+// does not support AppArmor.
+func LoadDefaultApparmorProfile() error {
+	if !apparmorEnabled() {
+		return nil
+	}
+	loaded, err := apparmorProfileLoaded(DefaultApparmorProfile)
+	if err != nil {
+		return err
+	}
+	if loaded {
+		return nil
+	}
+	f, err := os.CreateTemp("", "zcm-apparmor-")
+	if err != nil {
+		return errors.Wrap(err, "cannot create AppArmor profile file")
+	}
+	defer os.Remove(f.Name())
+	err = apparmorTemplate.Execute(f, DefaultApparmorProfile)
+	f.Close()
+	if err != nil {
+		return errors.Wrap(err, "cannot generate AppArmor profile")
+	}
+	// -K not to cache the profile, -r to replace the one of the same name
+	output, err := exec.Command("apparmor_parser", "-Kr", f.Name()).CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err, "cannot load AppArmor profile [%s], output=[%s]",
+			DefaultApparmorProfile, strings.TrimSpace(string(output)))
+	}
+	logrus.Infof("loaded AppArmor profile [%s]", DefaultApparmorProfile)
+	return nil
+}
+
+// defaultApparmorProfile returns the profile for RuntimeDefault among the
+// loaded ones. runc cannot run the container with the profile not loaded.
+func defaultApparmorProfile(loaded func(name string) (bool, error)) (string, error) {
+	for _, name := range []string{DefaultApparmorProfile, dockerApparmorProfile} {
+		ok, err := loaded(name)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return name, nil
+		}
+	}
+	return "", errors.Errorf("default AppArmor profile [%s] is not loaded", DefaultApparmorProfile)
+}
+
+func apparmorProfileLoaded(name string) (bool, error) {
+	f, err := os.Open(apparmorProfilesFile)
+	if err != nil {
+		return false, errors.Wrap(err, "cannot read loaded AppArmor profiles")
+	}
+	defer f.Close()
+	return hasApparmorProfile(f, name)
+}
+
+// hasApparmorProfile tells whether the profile is in the list of the loaded
+// profiles.
+func hasApparmorProfile(r io.Reader, name string) (bool, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), name+" (") {
+			return true, nil
+		}
+	}
+	return false, errors.Wrap(scanner.Err(), "cannot read loaded AppArmor profiles")
+}
+
+func apparmorEnabled() bool {
+	b, err := os.ReadFile("/sys/module/apparmor/parameters/enabled")
+	return err == nil && strings.TrimSpace(string(b)) == "Y"
+}
@@ -0,0 +1,95 @@
+package oci
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHasApparmorProfile(t *testing.T) {
+	profiles := "docker-default (enforce)\n" +
+		"zcm-default-old (enforce)\n" +
+		"/usr/bin/man (complain)\n"
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"docker-default", true},
+		{"/usr/bin/man", true},
+		{"zcm-default", false},
+		{"docker", false},
+	}
+	for _, tt := range tests {
+		got, err := hasApparmorProfile(strings.NewReader(profiles), tt.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("hasApparmorProfile(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDefaultApparmorProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		loaded  []string
+		want    string
+		wantErr bool
+	}{
+		{"default loaded", []string{DefaultApparmorProfile, dockerApparmorProfile}, DefaultApparmorProfile, false},
+		{"docker loaded", []string{dockerApparmorProfile}, dockerApparmorProfile, false},
+		{"none loaded", nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := defaultApparmorProfile(func(name string) (bool, error) {
+				for _, l := range tt.loaded {
+					if l == name {
+						return true, nil
+					}
+				}
+				return false, nil
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("profile = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApparmorTemplate(t *testing.T) {
+	b := &bytes.Buffer{}
+	if err := apparmorTemplate.Execute(b, DefaultApparmorProfile); err != nil {
+		t.Fatal(err)
+	}
+	profile := b.String()
+	for _, want := range []string{
+		"profile zcm-default flags=(attach_disconnected,mediate_deleted) {",
+		"signal (send,receive) peer=zcm-default,",
+		"deny mount,",
+	} {
+		if !strings.Contains(profile, want) {
+			t.Errorf("profile has no %q", want)
+		}
+	}
+
+	parser, err := exec.LookPath("apparmor_parser")
+	if err != nil {
+		t.Skip("apparmor_parser is not installed")
+	}
+	file := filepath.Join(t.TempDir(), "profile")
+	if err := os.WriteFile(file, b.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// -Q only parses the profile without loading it
+	if output, err := exec.Command(parser, "-Q", "-K", file).CombinedOutput(); err != nil {
+		t.Errorf("profile is invalid: %v, output=[%s]", err, output)
+	}
+}
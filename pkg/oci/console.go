@@ -0,0 +1,120 @@
+package oci
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// TerminalSize is the size of the terminal in characters.
+type TerminalSize struct {
+	Width  uint16
+	Height uint16
+}
+
+// console is the pseudo terminal given to runc as its stdio. runc relays it
+// to the terminal of the process, and resizes the terminal of the process
+// when it gets SIGWINCH on resize of the console.
+type console struct {
+	master *os.File
+	slave  *os.File
+	// outputDone is closed once the output of the process is copied
+	outputDone chan struct{}
+	done       chan struct{}
+}
+
+func newConsole() (*console, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot open ptmx")
+	}
+	if err := unix.IoctlSetPointerInt(int(master.Fd()), unix.TIOCSPTLCK, 0); err != nil {
+		master.Close()
+		return nil, errors.Wrap(err, "cannot unlock pty")
+	}
+	n, err := unix.IoctlGetUint32(int(master.Fd()), unix.TIOCGPTN)
+	if err != nil {
+		master.Close()
+		return nil, errors.Wrap(err, "cannot get pty number")
+	}
+	slave, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, errors.Wrap(err, "cannot open pty")
+	}
+	return &console{
+		master:     master,
+		slave:      slave,
+		outputDone: make(chan struct{}),
+		done:       make(chan struct{}),
+	}, nil
+}
+
+// setup makes the console the controlling terminal and the stdio of cmd.
+func (c *console) setup(cmd *exec.Cmd) {
+	cmd.Stdin = c.slave
+	cmd.Stdout = c.slave
+	cmd.Stderr = c.slave
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setsid:  true,
+		Setctty: true,
+		Ctty:    0,
+	}
+}
+
+// start copies the stdio from and to the console once cmd is started.
+func (c *console) start(stdio Stdio) {
+	// the output ends once runc, the only one which has the slave, exits
+	c.slave.Close()
+
+	if stdio.Stdin != nil {
+		go io.Copy(c.master, stdio.Stdin)
+	}
+	stdout := stdio.Stdout
+	if stdout == nil {
+		stdout = ioutil.Discard
+	}
+	go func() {
+		io.Copy(stdout, c.master)
+		close(c.outputDone)
+	}()
+	go func() {
+		for {
+			select {
+			case size, ok := <-stdio.Resize:
+				if !ok {
+					return
+				}
+				c.resize(size)
+			case <-c.done:
+				return
+			}
+		}
+	}()
+}
+
+func (c *console) resize(size TerminalSize) {
+	unix.IoctlSetWinsize(int(c.master.Fd()), unix.TIOCSWINSZ, &unix.Winsize{
+		Row: size.Height,
+		Col: size.Width,
+	})
+}
+
+// close waits for the output to be copied, and closes the console.
+func (c *console) close() {
+	<-c.outputDone
+	close(c.done)
+	c.master.Close()
+}
+
+// abort closes the console which is not started.
+func (c *console) abort() {
+	c.slave.Close()
+	c.master.Close()
+}
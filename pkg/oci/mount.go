@@ -0,0 +1,219 @@
+package oci
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"simpleconman/pkg/container"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/opencontainers/runtime-tools/generate"
+	"github.com/opencontainers/selinux/go-selinux/label"
+	"github.com/pkg/errors"
+)
+
+// defaultShmSize is the size of /dev/shm of the container which does not
+// share it with the pod sandbox
+const defaultShmSize = 64 * 1024 * 1024
+
+// PodMounts are files and dirs the pod sandbox shares with its containers.
+// Empty paths are not mounted.
+type PodMounts struct {
+	ShmPath        string
+	HostsPath      string
+	ResolvConfPath string
+	HostnamePath   string
+}
+
+// setupMounts adds the mounts given by the pod sandbox and the container to
+// the spec. Mounts of the container take precedence over the others to the
+// same destination.
+func setupMounts(gen *generate.Generator, opts SpecOptions) error {
+	userMounts := make(map[string]struct{}, len(opts.Mounts))
+	for _, m := range opts.Mounts {
+		userMounts[filepath.Clean(m.ContainerPath)] = struct{}{}
+	}
+	isUserMount := func(dest string) bool {
+		_, ok := userMounts[dest]
+		return ok
+	}
+
+	if !isUserMount("/dev/shm") {
+		gen.RemoveMount("/dev/shm")
+		if opts.Pod.ShmPath != "" {
+			gen.AddMount(bindMount(opts.Pod.ShmPath, "/dev/shm", false, "rprivate"))
+		} else {
+			shmSize := opts.ShmSize
+			if shmSize <= 0 {
+				shmSize = defaultShmSize
+			}
+			gen.AddMount(specs.Mount{
+				Destination: "/dev/shm",
+				Type:        "tmpfs",
+				Source:      "shm",
+				Options: []string{"nosuid", "noexec", "nodev", "mode=1777",
+					fmt.Sprintf("size=%d", shmSize)},
+			})
+		}
+	}
+	podFiles := []struct {
+		src  string
+		dest string
+	}{
+		{opts.Pod.HostsPath, "/etc/hosts"},
+		{opts.Pod.ResolvConfPath, "/etc/resolv.conf"},
+		{opts.Pod.HostnamePath, "/etc/hostname"},
+	}
+	for _, f := range podFiles {
+		if f.src == "" || isUserMount(f.dest) {
+			continue
+		}
+		gen.RemoveMount(f.dest)
+		gen.AddMount(bindMount(f.src, f.dest, opts.RootReadonly, "rprivate"))
+	}
+
+	// parent dirs are mounted before their children
+	mounts := append([]container.Mount{}, opts.Mounts...)
+	sort.SliceStable(mounts, func(i, j int) bool {
+		return depth(mounts[i].ContainerPath) < depth(mounts[j].ContainerPath)
+	})
+	for _, m := range mounts {
+		src, err := prepareHostPath(m.HostPath)
+		if err != nil {
+			return err
+		}
+		propagation := m.Propagation
+		if propagation == "" {
+			propagation = "rprivate"
+		}
+		if err := ensurePropagation(gen, src, propagation); err != nil {
+			return err
+		}
+		if m.SelinuxRelabel {
+			if err := label.Relabel(src, opts.MountLabel, false); err != nil && err != syscall.ENOTSUP {
+				return errors.Wrapf(err, "cannot relabel [%s] with [%s]", src, opts.MountLabel)
+			}
+		}
+		dest := filepath.Clean(m.ContainerPath)
+		gen.RemoveMount(dest)
+		gen.AddMount(bindMount(src, dest, m.Readonly, propagation))
+	}
+	return nil
+}
+
+func bindMount(src, dest string, readonly bool, propagation string) specs.Mount {
+	options := []string{"rbind", propagation, "rw"}
+	if readonly {
+		options[2] = "ro"
+	}
+	return specs.Mount{
+		Destination: dest,
+		Type:        "bind",
+		Source:      src,
+		Options:     options,
+	}
+}
+
+func depth(p string) int {
+	return len(strings.Split(filepath.Clean(p), string(filepath.Separator)))
+}
+
+// prepareHostPath creates the host path as a directory if it does not exist,
+// as kubelet expects, and resolves symlinks in it.
+func prepareHostPath(hostPath string) (string, error) {
+	if _, err := os.Stat(hostPath); err != nil {
+		if !os.IsNotExist(err) {
+			return "", errors.Wrapf(err, "cannot access host path [%s]", hostPath)
+		}
+		if err := os.MkdirAll(hostPath, 0755); err != nil {
+			return "", errors.Wrapf(err, "cannot create host path [%s]", hostPath)
+		}
+	}
+	src, err := filepath.EvalSymlinks(hostPath)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot resolve host path [%s]", hostPath)
+	}
+	return src, nil
+}
+
+// ensurePropagation checks whether the host mount of src can propagate mounts
+// as requested, and makes the rootfs propagation allow it.
+func ensurePropagation(gen *generate.Generator, src, propagation string) error {
+	if propagation == "rprivate" {
+		return nil
+	}
+	optional, err := mountOptionalFields(src)
+	if err != nil {
+		return err
+	}
+	shared := strings.Contains(optional, "shared:")
+	switch propagation {
+	case "rshared":
+		if !shared {
+			return errors.Errorf("host path [%s] is not a shared mount", src)
+		}
+		return gen.SetLinuxRootPropagation("rshared")
+	case "rslave":
+		if !shared && !strings.Contains(optional, "master:") {
+			return errors.Errorf("host path [%s] is not a shared or slave mount", src)
+		}
+		if root := gen.Spec().Linux.RootfsPropagation; root != "rshared" {
+			return gen.SetLinuxRootPropagation("rslave")
+		}
+		return nil
+	}
+	return errors.Errorf("unknown mount propagation [%s]", propagation)
+}
+
+// mountOptionalFields returns the optional fields in /proc/self/mountinfo of
+// the mount which src is on.
+func mountOptionalFields(src string) (string, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return "", errors.Wrap(err, "cannot open mountinfo")
+	}
+	defer f.Close()
+
+	var (
+		mountpoint string
+		optional   string
+	)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// id parent major:minor root mountpoint options [optional...] - fstype source super
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 7 {
+			continue
+		}
+		mp := fields[4]
+		if !isUnder(src, mp) || len(mp) < len(mountpoint) {
+			continue
+		}
+		mountpoint = mp
+		optional = ""
+		for _, field := range fields[6:] {
+			if field == "-" {
+				break
+			}
+			optional += field + " "
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return "", errors.Wrap(err, "cannot read mountinfo")
+	}
+	if mountpoint == "" {
+		return "", errors.Errorf("cannot find mount of [%s]", src)
+	}
+	return optional, nil
+}
+
+func isUnder(p, dir string) bool {
+	if dir == "/" {
+		return true
+	}
+	return p == dir || strings.HasPrefix(p, dir+"/")
+}
@@ -0,0 +1,157 @@
+package oci
+
+import (
+	"os"
+	"path/filepath"
+	"simpleconman/pkg/container"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func findMount(spec *specs.Spec, dest string) []specs.Mount {
+	var result []specs.Mount
+	for _, m := range spec.Mounts {
+		if m.Destination == dest {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+func TestSetupMounts(t *testing.T) {
+	host := t.TempDir()
+	if err := os.Mkdir(filepath.Join(host, "data"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(host, "data"), filepath.Join(host, "link")); err != nil {
+		t.Fatal(err)
+	}
+	spec := newTestSpec(t, SpecOptions{
+		RootReadonly: true,
+		Mounts: []container.Mount{
+			{ContainerPath: "/data/sub", HostPath: filepath.Join(host, "sub")},
+			{ContainerPath: "/data/", HostPath: filepath.Join(host, "link"), Readonly: true},
+			{ContainerPath: "/etc/hostname", HostPath: filepath.Join(host, "hostname")},
+		},
+		Pod: PodMounts{
+			ShmPath:        "/pod/shm",
+			HostsPath:      "/pod/hosts",
+			ResolvConfPath: "/pod/resolv.conf",
+			HostnamePath:   "/pod/hostname",
+		},
+	})
+
+	tests := []struct {
+		dest    string
+		source  string
+		options string
+	}{
+		{"/dev/shm", "/pod/shm", "rbind,rprivate,rw"},
+		// pod files follow the readonly rootfs
+		{"/etc/hosts", "/pod/hosts", "rbind,rprivate,ro"},
+		{"/etc/resolv.conf", "/pod/resolv.conf", "rbind,rprivate,ro"},
+		// mount of the container takes precedence over the pod
+		{"/etc/hostname", filepath.Join(host, "hostname"), "rbind,rprivate,rw"},
+		// symlink is resolved
+		{"/data", filepath.Join(host, "data"), "rbind,rprivate,ro"},
+		{"/data/sub", filepath.Join(host, "sub"), "rbind,rprivate,rw"},
+	}
+	for _, tt := range tests {
+		mounts := findMount(spec, tt.dest)
+		if len(mounts) != 1 {
+			t.Errorf("mounts of [%s] = %+v, want one", tt.dest, mounts)
+			continue
+		}
+		m := mounts[0]
+		if m.Source != tt.source || strings.Join(m.Options, ",") != tt.options {
+			t.Errorf("mount of [%s] = %s %v, want %s %s", tt.dest, m.Source, m.Options, tt.source, tt.options)
+		}
+	}
+
+	// parent dir is mounted before its child
+	index := map[string]int{}
+	for i, m := range spec.Mounts {
+		index[m.Destination] = i
+	}
+	if index["/data"] > index["/data/sub"] {
+		t.Error("/data/sub is mounted before /data")
+	}
+	// missing host path is created as kubelet expects
+	if info, err := os.Stat(filepath.Join(host, "sub")); err != nil || !info.IsDir() {
+		t.Errorf("host path is not created: %v", err)
+	}
+}
+
+func TestSetupMountsShm(t *testing.T) {
+	tests := []struct {
+		name    string
+		shmSize int64
+		want    string
+	}{
+		{"default", 0, "size=67108864"},
+		{"size", 1024, "size=1024"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := newTestSpec(t, SpecOptions{ShmSize: tt.shmSize})
+			mounts := findMount(spec, "/dev/shm")
+			if len(mounts) != 1 {
+				t.Fatalf("mounts of /dev/shm = %+v", mounts)
+			}
+			if mounts[0].Type != "tmpfs" || !strings.Contains(strings.Join(mounts[0].Options, ","), tt.want) {
+				t.Errorf("mount of /dev/shm = %+v, want tmpfs with %s", mounts[0], tt.want)
+			}
+		})
+	}
+}
+
+func TestSetupMountsUnknownPropagation(t *testing.T) {
+	_, err := NewSpec(SpecOptions{
+		Command:  []string{"/bin/sh"},
+		RootPath: t.TempDir(),
+		Mounts: []container.Mount{
+			{ContainerPath: "/data", HostPath: t.TempDir(), Propagation: "bogus"},
+		},
+	})
+	if err == nil {
+		t.Error("unknown propagation is accepted")
+	}
+}
+
+func TestDepth(t *testing.T) {
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/", 2},
+		{"/a", 2},
+		{"/a/b/", 3},
+		{"/a/b/c", 4},
+	}
+	for _, tt := range tests {
+		if got := depth(tt.path); got != tt.want {
+			t.Errorf("depth(%s) = %d, want %d", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestIsUnder(t *testing.T) {
+	tests := []struct {
+		path string
+		dir  string
+		want bool
+	}{
+		{"/a/b", "/", true},
+		{"/a/b", "/a", true},
+		{"/a", "/a", true},
+		{"/ab", "/a", false},
+		{"/a", "/a/b", false},
+	}
+	for _, tt := range tests {
+		if got := isUnder(tt.path, tt.dir); got != tt.want {
+			t.Errorf("isUnder(%s, %s) = %v, want %v", tt.path, tt.dir, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package oci
+
+import (
+	"fmt"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/opencontainers/runtime-tools/generate"
+)
+
+// Namespace is the namespace the container joins instead of creating a new
+// one of the type.
+type Namespace struct {
+	Type specs.LinuxNamespaceType
+	// Path is the namespace file such as /proc/<pid>/ns/net
+	Path string
+	// Host means the namespace of the host. Path is ignored.
+	Host bool
+}
+
+// NamespacePath returns the namespace file of the process. ns is the name of
+// the file such as "net" and "ipc".
+func NamespacePath(pid int, ns string) string {
+	return fmt.Sprintf("/proc/%d/ns/%s", pid, ns)
+}
+
+// setupNamespaces joins the namespaces. Container in the UTS namespace of
+// the host keeps the hostname of the host.
+func setupNamespaces(gen *generate.Generator, opts SpecOptions) error {
+	for _, ns := range opts.Namespaces {
+		if ns.Host {
+			if err := gen.RemoveLinuxNamespace(string(ns.Type)); err != nil {
+				return err
+			}
+			if ns.Type == specs.UTSNamespace {
+				gen.SetHostname("")
+			}
+			continue
+		}
+		if err := gen.AddOrReplaceLinuxNamespace(string(ns.Type), ns.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
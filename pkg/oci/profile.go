@@ -0,0 +1,245 @@
+package oci
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"slices"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/opencontainers/runtime-tools/generate"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+type ProfileType int
+
+const (
+	Unconfined ProfileType = iota
+	RuntimeDefault
+	Localhost
+)
+
+// SecurityProfile is a seccomp or AppArmor profile. LocalhostRef is the
+// path of the seccomp profile file relative to the profile root unless it is
+// absolute, or the name of the AppArmor profile loaded in the host.
+type SecurityProfile struct {
+	Type         ProfileType
+	LocalhostRef string
+}
+
+//go:embed seccomp_default.json
+var defaultSeccompProfile []byte
+
+// setupProfiles applies the seccomp and AppArmor profiles. Privileged
+// container is unconfined.
+func setupProfiles(gen *generate.Generator, opts SpecOptions) error {
+	if opts.Privileged {
+		gen.Spec().Linux.Seccomp = nil
+		return nil
+	}
+	var caps []string
+	if c := gen.Spec().Process.Capabilities; c != nil {
+		caps = c.Bounding
+	}
+	seccomp, err := seccompProfile(opts.Seccomp, opts.SeccompProfileRoot, caps)
+	if err != nil {
+		return err
+	}
+	gen.Spec().Linux.Seccomp = seccomp
+
+	apparmor, err := apparmorProfile(opts.Apparmor)
+	if err != nil {
+		return err
+	}
+	gen.SetProcessApparmorProfile(apparmor)
+	return nil
+}
+
+// seccompProfile returns the profile for the container with the bounding
+// capabilities caps, which the rules of the profile may be conditional on.
+func seccompProfile(profile SecurityProfile, root string, caps []string) (*specs.LinuxSeccomp, error) {
+	switch profile.Type {
+	case Unconfined:
+		return nil, nil
+	case RuntimeDefault:
+		seccomp, err := decodeSeccomp(defaultSeccompProfile, caps)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot decode default seccomp profile")
+		}
+		return seccomp, nil
+	case Localhost:
+		file := profile.LocalhostRef
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(root, file)
+		}
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot read seccomp profile")
+		}
+		seccomp, err := decodeSeccomp(b, caps)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot decode seccomp profile [%s]", file)
+		}
+		return seccomp, nil
+	}
+	return nil, errors.Errorf("unknown seccomp profile type [%d]", profile.Type)
+}
+
+// seccompCondition is the condition of a rule in the profile of docker.
+// Arches are GOARCH names.
+type seccompCondition struct {
+	Caps      []string `json:"caps,omitempty"`
+	Arches    []string `json:"arches,omitempty"`
+	MinKernel string   `json:"minKernel,omitempty"`
+}
+
+// decodeSeccomp decodes the profile in either OCI format or the format of
+// docker which lists architectures in archMap and makes rules conditional on
+// the architecture, the capabilities and the kernel version. Architectures
+// of the host are used if the profile has none.
+func decodeSeccomp(b []byte, caps []string) (*specs.LinuxSeccomp, error) {
+	profile := struct {
+		specs.LinuxSeccomp
+		ArchMap []struct {
+			Architecture     specs.Arch   `json:"architecture"`
+			SubArchitectures []specs.Arch `json:"subArchitectures"`
+		} `json:"archMap"`
+		Syscalls []struct {
+			specs.LinuxSyscall
+			Includes seccompCondition `json:"includes"`
+			Excludes seccompCondition `json:"excludes"`
+		} `json:"syscalls"`
+	}{}
+	if err := json.Unmarshal(b, &profile); err != nil {
+		return nil, err
+	}
+	seccomp := profile.LinuxSeccomp
+	if len(seccomp.Architectures) == 0 {
+		for _, arch := range profile.ArchMap {
+			if arch.Architecture == hostArchitectures()[0] {
+				seccomp.Architectures = append([]specs.Arch{arch.Architecture}, arch.SubArchitectures...)
+			}
+		}
+	}
+	if len(seccomp.Architectures) == 0 {
+		seccomp.Architectures = hostArchitectures()
+	}
+
+	kernel, err := hostKernelVersion()
+	if err != nil {
+		return nil, err
+	}
+	seccomp.Syscalls = nil
+	for _, rule := range profile.Syscalls {
+		ok, err := seccompRuleApplies(rule.Includes, rule.Excludes, runtime.GOARCH, caps, kernel)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid condition of rule for %v", rule.Names)
+		}
+		if ok {
+			seccomp.Syscalls = append(seccomp.Syscalls, rule.LinuxSyscall)
+		}
+	}
+	return &seccomp, nil
+}
+
+// seccompRuleApplies tells whether the rule is for the container, as docker
+// does. Every included capability is needed, and any excluded one rules it
+// out.
+func seccompRuleApplies(includes, excludes seccompCondition, arch string, caps []string, kernel kernelVersion) (bool, error) {
+	if slices.Contains(excludes.Arches, arch) {
+		return false, nil
+	}
+	for _, c := range excludes.Caps {
+		if containsCapability(caps, c) {
+			return false, nil
+		}
+	}
+	if len(includes.Arches) > 0 && !slices.Contains(includes.Arches, arch) {
+		return false, nil
+	}
+	for _, c := range includes.Caps {
+		if !containsCapability(caps, c) {
+			return false, nil
+		}
+	}
+	if includes.MinKernel != "" {
+		min, err := parseKernelVersion(includes.MinKernel)
+		if err != nil {
+			return false, err
+		}
+		if kernel.less(min) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// kernelVersion is the major and minor version of the kernel
+type kernelVersion struct {
+	major, minor int
+}
+
+func (v kernelVersion) less(o kernelVersion) bool {
+	return v.major < o.major || (v.major == o.major && v.minor < o.minor)
+}
+
+// parseKernelVersion parses the version in the form of the release of
+// uname, such as "5.15.0-91-generic".
+func parseKernelVersion(release string) (kernelVersion, error) {
+	v := kernelVersion{}
+	if _, err := fmt.Sscanf(release, "%d.%d", &v.major, &v.minor); err != nil {
+		return v, errors.Errorf("malformed kernel version [%s]", release)
+	}
+	return v, nil
+}
+
+func hostKernelVersion() (kernelVersion, error) {
+	uname := unix.Utsname{}
+	if err := unix.Uname(&uname); err != nil {
+		return kernelVersion{}, errors.Wrap(err, "cannot get kernel version")
+	}
+	return parseKernelVersion(unix.ByteSliceToString(uname.Release[:]))
+}
+
+// hostArchitectures returns the seccomp architectures the host runs
+// binaries of. The native one comes first.
+func hostArchitectures() []specs.Arch {
+	switch runtime.GOARCH {
+	case "amd64":
+		return []specs.Arch{specs.ArchX86_64, specs.ArchX86, specs.ArchX32}
+	case "386":
+		return []specs.Arch{specs.ArchX86}
+	case "arm64":
+		return []specs.Arch{specs.ArchAARCH64, specs.ArchARM}
+	case "arm":
+		return []specs.Arch{specs.ArchARM}
+	case "ppc64le":
+		return []specs.Arch{specs.ArchPPC64LE}
+	case "s390x":
+		return []specs.Arch{specs.ArchS390X, specs.ArchS390}
+	}
+	return []specs.Arch{}
+}
+
+func apparmorProfile(profile SecurityProfile) (string, error) {
+	switch profile.Type {
+	case Unconfined:
+		return "", nil
+	case RuntimeDefault:
+		// nothing to confine with if the host does not support AppArmor
+		if !apparmorEnabled() {
+			return "", nil
+		}
+		return defaultApparmorProfile(apparmorProfileLoaded)
+	case Localhost:
+		if profile.LocalhostRef == "" {
+			return "", errors.New("AppArmor profile name is not specified")
+		}
+		return profile.LocalhostRef, nil
+	}
+	return "", errors.Errorf("unknown AppArmor profile type [%d]", profile.Type)
+}
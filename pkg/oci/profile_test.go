@@ -0,0 +1,282 @@
+package oci
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// seccompRules returns the rules for the syscall of the default profile of
+// the container with the added capabilities.
+func seccompRules(t *testing.T, name string, addCaps ...string) []specs.LinuxSyscall {
+	t.Helper()
+	spec := newTestSpec(t, SpecOptions{
+		Seccomp:         SecurityProfile{Type: RuntimeDefault},
+		AddCapabilities: addCaps,
+	})
+	var rules []specs.LinuxSyscall
+	for _, rule := range spec.Linux.Seccomp.Syscalls {
+		if slices.Contains(rule.Names, name) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// allowed tells whether the rules allow the syscall regardless of its args.
+func allowed(rules []specs.LinuxSyscall) bool {
+	for _, rule := range rules {
+		if rule.Action == specs.ActAllow && len(rule.Args) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDefaultSeccompProfile(t *testing.T) {
+	seccomp, err := seccompProfile(SecurityProfile{Type: RuntimeDefault}, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seccomp.DefaultAction != specs.ActErrno || seccomp.DefaultErrnoRet == nil || *seccomp.DefaultErrnoRet != 1 {
+		t.Errorf("default action = %s %v, want EPERM", seccomp.DefaultAction, seccomp.DefaultErrnoRet)
+	}
+	if len(seccomp.Architectures) == 0 {
+		t.Error("no architecture")
+	}
+	for _, rule := range seccomp.Syscalls {
+		if len(rule.Names) == 0 || rule.Action == "" {
+			t.Errorf("malformed rule %+v", rule)
+		}
+	}
+}
+
+func TestDefaultSeccompProfileAllows(t *testing.T) {
+	names := []string{
+		"read", "statx", "faccessat2", "rseq", "close_range", "openat2",
+		"pidfd_open", "pidfd_send_signal", "epoll_pwait2", "membarrier",
+		"clock_gettime64", "futex_time64", "ppoll_time64", "timerfd_settime64",
+		"utimensat_time64", "semtimedop_time64",
+	}
+	kernel, err := hostKernelVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// upstream allows them from 4.8, which checks the ptrace of seccomp
+	if !kernel.less(kernelVersion{4, 8}) {
+		names = append(names, "ptrace", "process_vm_readv", "process_vm_writev")
+	}
+	for _, name := range names {
+		if !allowed(seccompRules(t, name)) {
+			t.Errorf("%s is not allowed", name)
+		}
+	}
+	for _, name := range []string{"mount", "unshare", "setns", "bpf", "reboot", "init_module", "open_by_handle_at"} {
+		if rules := seccompRules(t, name); len(rules) != 0 {
+			t.Errorf("%s is allowed without capability: %+v", name, rules)
+		}
+	}
+}
+
+func TestDefaultSeccompProfileCapabilities(t *testing.T) {
+	tests := []struct {
+		name    string
+		syscall string
+		cap     string
+	}{
+		{"sys admin", "mount", "SYS_ADMIN"},
+		{"sys admin clone3", "clone3", "SYS_ADMIN"},
+		{"sys boot", "reboot", "SYS_BOOT"},
+		{"sys module", "init_module", "SYS_MODULE"},
+		{"sys ptrace", "kcmp", "SYS_PTRACE"},
+		{"sys time", "settimeofday", "SYS_TIME"},
+		{"dac read search", "open_by_handle_at", "DAC_READ_SEARCH"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !allowed(seccompRules(t, tt.syscall, tt.cap)) {
+				t.Errorf("%s is not allowed with %s", tt.syscall, tt.cap)
+			}
+		})
+	}
+}
+
+func TestDefaultSeccompProfileClone(t *testing.T) {
+	clone3 := seccompRules(t, "clone3")
+	if len(clone3) != 1 || clone3[0].Action != specs.ActErrno ||
+		clone3[0].ErrnoRet == nil || *clone3[0].ErrnoRet != 38 {
+		t.Errorf("clone3 does not fail with ENOSYS: %+v", clone3)
+	}
+
+	// s390 has the flags of clone in the second arg
+	index := uint(0)
+	if runtime.GOARCH == "s390" || runtime.GOARCH == "s390x" {
+		index = 1
+	}
+	clone := seccompRules(t, "clone")
+	if len(clone) != 1 || len(clone[0].Args) != 1 || clone[0].Args[0].Index != index ||
+		clone[0].Args[0].Op != specs.OpMaskedEqual || clone[0].Args[0].Value != 0x7E020000 {
+		t.Errorf("clone does not mask namespace flags: %+v", clone)
+	}
+
+	if rules := seccompRules(t, "clone3", "SYS_ADMIN"); !allowed(rules) || len(rules) != 1 {
+		t.Errorf("clone3 is not allowed with SYS_ADMIN: %+v", rules)
+	}
+}
+
+func TestDefaultSeccompProfileArch(t *testing.T) {
+	rules := seccompRules(t, "arch_prctl")
+	if want := runtime.GOARCH == "amd64"; allowed(rules) != want {
+		t.Errorf("arch_prctl allowed = %v on %s", allowed(rules), runtime.GOARCH)
+	}
+	if rules := seccompRules(t, "riscv_flush_icache"); runtime.GOARCH != "riscv64" && len(rules) != 0 {
+		t.Errorf("syscall of other arch is allowed: %+v", rules)
+	}
+}
+
+func TestDefaultSeccompProfilePersonality(t *testing.T) {
+	values := map[uint64]bool{}
+	for _, rule := range seccompRules(t, "personality") {
+		// args of a rule are ANDed, so a rule can match a single value
+		if rule.Action != specs.ActAllow || len(rule.Args) != 1 ||
+			rule.Args[0].Index != 0 || rule.Args[0].Op != specs.OpEqualTo {
+			t.Errorf("unexpected personality rule %+v", rule)
+			continue
+		}
+		values[rule.Args[0].Value] = true
+	}
+	for _, v := range []uint64{0, 8, 0x20000, 0x20008, 0xffffffff} {
+		if !values[v] {
+			t.Errorf("personality(%#x) is not allowed", v)
+		}
+	}
+}
+
+func TestSeccompRuleApplies(t *testing.T) {
+	kernel := kernelVersion{5, 10}
+	tests := []struct {
+		name     string
+		includes seccompCondition
+		excludes seccompCondition
+		caps     []string
+		want     bool
+	}{
+		{"no condition", seccompCondition{}, seccompCondition{}, nil, true},
+		{"arch included", seccompCondition{Arches: []string{"amd64", "x32"}}, seccompCondition{}, nil, true},
+		{"arch not included", seccompCondition{Arches: []string{"arm64"}}, seccompCondition{}, nil, false},
+		{"arch excluded", seccompCondition{}, seccompCondition{Arches: []string{"amd64"}}, nil, false},
+		{"cap included", seccompCondition{Caps: []string{"CAP_SYS_ADMIN"}}, seccompCondition{}, []string{"CAP_SYS_ADMIN"}, true},
+		{"cap missing", seccompCondition{Caps: []string{"CAP_SYS_ADMIN"}}, seccompCondition{}, []string{"CAP_CHOWN"}, false},
+		{"every cap is needed", seccompCondition{Caps: []string{"CAP_SYS_ADMIN", "CAP_BPF"}}, seccompCondition{}, []string{"CAP_SYS_ADMIN"}, false},
+		{"cap excluded", seccompCondition{}, seccompCondition{Caps: []string{"CAP_SYS_ADMIN"}}, []string{"CAP_SYS_ADMIN"}, false},
+		{"cap not excluded", seccompCondition{}, seccompCondition{Caps: []string{"CAP_SYS_ADMIN"}}, []string{"CAP_CHOWN"}, true},
+		{"old kernel", seccompCondition{MinKernel: "5.11"}, seccompCondition{}, nil, false},
+		{"same kernel", seccompCondition{MinKernel: "5.10"}, seccompCondition{}, nil, true},
+		{"new kernel", seccompCondition{MinKernel: "4.8"}, seccompCondition{}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := seccompRuleApplies(tt.includes, tt.excludes, "amd64", tt.caps, kernel)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("seccompRuleApplies() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := seccompRuleApplies(seccompCondition{MinKernel: "new"}, seccompCondition{}, "amd64", nil, kernel); err == nil {
+		t.Error("malformed min kernel is accepted")
+	}
+}
+
+func TestParseKernelVersion(t *testing.T) {
+	tests := []struct {
+		release string
+		want    kernelVersion
+		wantErr bool
+	}{
+		{"4.8", kernelVersion{4, 8}, false},
+		{"5.15.0-91-generic", kernelVersion{5, 15}, false},
+		{"6.1.55+", kernelVersion{6, 1}, false},
+		{"unknown", kernelVersion{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseKernelVersion(tt.release)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseKernelVersion(%s) err = %v, wantErr %v", tt.release, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("parseKernelVersion(%s) = %+v, want %+v", tt.release, got, tt.want)
+		}
+	}
+}
+
+func TestSeccompProfile(t *testing.T) {
+	root := t.TempDir()
+	profile := []byte(`{"defaultAction": "SCMP_ACT_ALLOW", "architectures": ["SCMP_ARCH_X86_64"]}`)
+	if err := os.WriteFile(filepath.Join(root, "profile.json"), profile, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "invalid.json"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		profile SecurityProfile
+		want    specs.LinuxSeccompAction
+		wantErr bool
+	}{
+		{"unconfined", SecurityProfile{Type: Unconfined}, "", false},
+		{"runtime default", SecurityProfile{Type: RuntimeDefault}, specs.ActErrno, false},
+		{"relative", SecurityProfile{Type: Localhost, LocalhostRef: "profile.json"}, specs.ActAllow, false},
+		{"absolute", SecurityProfile{Type: Localhost, LocalhostRef: filepath.Join(root, "profile.json")}, specs.ActAllow, false},
+		{"missing", SecurityProfile{Type: Localhost, LocalhostRef: "missing.json"}, "", true},
+		{"invalid", SecurityProfile{Type: Localhost, LocalhostRef: "invalid.json"}, "", true},
+		{"unknown type", SecurityProfile{Type: 10}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seccomp, err := seccompProfile(tt.profile, root, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			var got specs.LinuxSeccompAction
+			if seccomp != nil {
+				got = seccomp.DefaultAction
+			}
+			if got != tt.want {
+				t.Errorf("default action = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeSeccompArchMap(t *testing.T) {
+	native := hostArchitectures()
+	if len(native) == 0 {
+		t.Skip("unknown host architecture")
+	}
+	profile := []byte(`{"defaultAction": "SCMP_ACT_ERRNO", "archMap": [
+		{"architecture": "` + string(native[0]) + `", "subArchitectures": ["SUB_ARCH"]},
+		{"architecture": "OTHER_ARCH", "subArchitectures": []}
+	]}`)
+	seccomp, err := decodeSeccomp(profile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []specs.Arch{native[0], "SUB_ARCH"}
+	if len(seccomp.Architectures) != len(want) ||
+		seccomp.Architectures[0] != want[0] || seccomp.Architectures[1] != want[1] {
+		t.Errorf("architectures = %v, want %v", seccomp.Architectures, want)
+	}
+}
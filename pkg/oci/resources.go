@@ -0,0 +1,163 @@
+package oci
+
+import (
+	"encoding/json"
+	"simpleconman/pkg/fsutil"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/opencontainers/runtime-tools/generate"
+	"github.com/pkg/errors"
+)
+
+// Resources are the cgroup limits of the container. Zero value of a field
+// means no limit.
+type Resources struct {
+	CPUPeriod  int64
+	CPUQuota   int64
+	CPUShares  int64
+	CpusetCpus string
+	CpusetMems string
+
+	MemoryLimit int64
+	// MemorySwapLimit is the limit of memory plus swap. It is the same as
+	// MemoryLimit if not set, so that the container does not use swap.
+	MemorySwapLimit int64
+
+	HugepageLimits []HugepageLimit
+	// Unified is the cgroup v2 parameters written as is
+	Unified map[string]string
+}
+
+type HugepageLimit struct {
+	// PageSize is in the form of "<size><unit>" such as "2MB" and "1GB"
+	PageSize string
+	Limit    uint64
+}
+
+// Validate checks the resources before they are given to the OCI runtime.
+// Negative CPU quota and memory swap limit mean unlimited.
+func (r *Resources) Validate() error {
+	if r.CPUPeriod < 0 {
+		return errors.Errorf("invalid CPU period [%d]", r.CPUPeriod)
+	}
+	if r.CPUShares < 0 {
+		return errors.Errorf("invalid CPU shares [%d]", r.CPUShares)
+	}
+	if r.CPUQuota < -1 {
+		return errors.Errorf("invalid CPU quota [%d]", r.CPUQuota)
+	}
+	if r.MemoryLimit < 0 {
+		return errors.Errorf("invalid memory limit [%d]", r.MemoryLimit)
+	}
+	if r.MemorySwapLimit < -1 {
+		return errors.Errorf("invalid memory swap limit [%d]", r.MemorySwapLimit)
+	}
+	if r.MemorySwapLimit > 0 && r.MemoryLimit > 0 && r.MemorySwapLimit < r.MemoryLimit {
+		return errors.Errorf("memory swap limit [%d] is less than memory limit [%d]",
+			r.MemorySwapLimit, r.MemoryLimit)
+	}
+	for _, l := range r.HugepageLimits {
+		if l.PageSize == "" {
+			return errors.New("hugepage limit without page size")
+		}
+	}
+	return nil
+}
+
+func setupResources(gen *generate.Generator, opts SpecOptions) error {
+	if opts.CgroupsPath != "" {
+		gen.SetLinuxCgroupsPath(opts.CgroupsPath)
+	}
+	if opts.OOMScoreAdj != 0 {
+		gen.SetProcessOOMScoreAdj(int(opts.OOMScoreAdj))
+	}
+	if opts.Resources == nil {
+		return nil
+	}
+	r := opts.Resources
+	if err := r.Validate(); err != nil {
+		return err
+	}
+
+	if r.CPUPeriod != 0 {
+		gen.SetLinuxResourcesCPUPeriod(uint64(r.CPUPeriod))
+	}
+	if r.CPUQuota != 0 {
+		gen.SetLinuxResourcesCPUQuota(r.CPUQuota)
+	}
+	if r.CPUShares != 0 {
+		gen.SetLinuxResourcesCPUShares(uint64(r.CPUShares))
+	}
+	if r.CpusetCpus != "" {
+		gen.SetLinuxResourcesCPUCpus(r.CpusetCpus)
+	}
+	if r.CpusetMems != "" {
+		gen.SetLinuxResourcesCPUMems(r.CpusetMems)
+	}
+	if r.MemoryLimit != 0 {
+		gen.SetLinuxResourcesMemoryLimit(r.MemoryLimit)
+		gen.SetLinuxResourcesMemorySwap(r.MemoryLimit)
+	}
+	if r.MemorySwapLimit != 0 {
+		gen.SetLinuxResourcesMemorySwap(r.MemorySwapLimit)
+	}
+	for _, l := range r.HugepageLimits {
+		gen.AddLinuxResourcesHugepageLimit(l.PageSize, l.Limit)
+	}
+	if len(r.Unified) > 0 {
+		if gen.Config.Linux.Resources == nil {
+			gen.Config.Linux.Resources = &specs.LinuxResources{}
+		}
+		gen.Config.Linux.Resources.Unified = make(map[string]string, len(r.Unified))
+		for k, v := range r.Unified {
+			gen.Config.Linux.Resources.Unified[k] = v
+		}
+	}
+	return nil
+}
+
+// LinuxResources converts the resources into the ones of the OCI runtime spec.
+func (r *Resources) LinuxResources() (*specs.LinuxResources, error) {
+	gen := generate.Generator{Config: &specs.Spec{}}
+	if err := setupResources(&gen, SpecOptions{Resources: r}); err != nil {
+		return nil, err
+	}
+	if gen.Config.Linux == nil || gen.Config.Linux.Resources == nil {
+		return &specs.LinuxResources{}, nil
+	}
+	return gen.Config.Linux.Resources, nil
+}
+
+// UpdateResources writes the resources into the runtime spec file, so the
+// container is created with them again. Only the resources which are set
+// are changed. The resources of the spec after the update are returned.
+func UpdateResources(specFile string, resources *specs.LinuxResources) (*specs.LinuxResources, error) {
+	spec, err := readSpec(specFile)
+	if err != nil {
+		return nil, err
+	}
+	if spec.Linux == nil {
+		spec.Linux = &specs.Linux{}
+	}
+	if spec.Linux.Resources == nil {
+		spec.Linux.Resources = &specs.LinuxResources{}
+	}
+	// decoding onto the current resources changes only the ones which are
+	// set, the same as the OCI runtime does
+	update, err := json.Marshal(resources)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot encode resources")
+	}
+	if err := json.Unmarshal(update, spec.Linux.Resources); err != nil {
+		return nil, errors.Wrap(err, "cannot merge resources")
+	}
+
+	b, err := json.MarshalIndent(spec, "", "\t")
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot encode OCI runtime spec")
+	}
+	if err := fsutil.WriteFileAtomic(specFile, b, 0644); err != nil {
+		return nil, errors.Wrap(err, "cannot write OCI runtime spec file")
+	}
+	return spec.Linux.Resources, nil
+}
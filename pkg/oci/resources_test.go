@@ -0,0 +1,184 @@
+package oci
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestResourcesValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		resources Resources
+		wantErr   bool
+	}{
+		{"no limit", Resources{}, false},
+		{"unlimited quota", Resources{CPUQuota: -1}, false},
+		{"unlimited swap", Resources{MemoryLimit: 100, MemorySwapLimit: -1}, false},
+		{"swap over memory", Resources{MemoryLimit: 100, MemorySwapLimit: 200}, false},
+		{"negative period", Resources{CPUPeriod: -1}, true},
+		{"negative shares", Resources{CPUShares: -1}, true},
+		{"invalid quota", Resources{CPUQuota: -2}, true},
+		{"negative memory", Resources{MemoryLimit: -1}, true},
+		{"invalid swap", Resources{MemorySwapLimit: -2}, true},
+		{"swap under memory", Resources{MemoryLimit: 200, MemorySwapLimit: 100}, true},
+		{"hugepage without size", Resources{HugepageLimits: []HugepageLimit{{Limit: 1}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.resources.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLinuxResources(t *testing.T) {
+	tests := []struct {
+		name      string
+		resources Resources
+		check     func(t *testing.T, r *specs.LinuxResources)
+	}{
+		{
+			name:      "no limit",
+			resources: Resources{},
+			check: func(t *testing.T, r *specs.LinuxResources) {
+				if r.CPU != nil || r.Memory != nil || len(r.HugepageLimits) != 0 || r.Unified != nil {
+					t.Errorf("limits are set: %+v", r)
+				}
+			},
+		},
+		{
+			name:      "cpu",
+			resources: Resources{CPUPeriod: 100000, CPUQuota: 50000, CPUShares: 512, CpusetCpus: "0-1", CpusetMems: "0"},
+			check: func(t *testing.T, r *specs.LinuxResources) {
+				cpu := r.CPU
+				if cpu == nil || *cpu.Period != 100000 || *cpu.Quota != 50000 || *cpu.Shares != 512 ||
+					cpu.Cpus != "0-1" || cpu.Mems != "0" {
+					t.Errorf("cpu = %+v", cpu)
+				}
+			},
+		},
+		{
+			name:      "memory without swap",
+			resources: Resources{MemoryLimit: 1 << 20},
+			check: func(t *testing.T, r *specs.LinuxResources) {
+				if r.Memory == nil || *r.Memory.Limit != 1<<20 || *r.Memory.Swap != 1<<20 {
+					t.Errorf("memory = %+v", r.Memory)
+				}
+			},
+		},
+		{
+			name:      "memory with swap",
+			resources: Resources{MemoryLimit: 1 << 20, MemorySwapLimit: 2 << 20},
+			check: func(t *testing.T, r *specs.LinuxResources) {
+				if r.Memory == nil || *r.Memory.Limit != 1<<20 || *r.Memory.Swap != 2<<20 {
+					t.Errorf("memory = %+v", r.Memory)
+				}
+			},
+		},
+		{
+			name:      "unlimited swap",
+			resources: Resources{MemoryLimit: 1 << 20, MemorySwapLimit: -1},
+			check: func(t *testing.T, r *specs.LinuxResources) {
+				if r.Memory == nil || *r.Memory.Swap != -1 {
+					t.Errorf("memory = %+v", r.Memory)
+				}
+			},
+		},
+		{
+			name:      "hugepages and unified",
+			resources: Resources{HugepageLimits: []HugepageLimit{{PageSize: "2MB", Limit: 4 << 20}}, Unified: map[string]string{"memory.high": "max"}},
+			check: func(t *testing.T, r *specs.LinuxResources) {
+				if len(r.HugepageLimits) != 1 || r.HugepageLimits[0].Pagesize != "2MB" || r.HugepageLimits[0].Limit != 4<<20 {
+					t.Errorf("hugepage limits = %+v", r.HugepageLimits)
+				}
+				if r.Unified["memory.high"] != "max" {
+					t.Errorf("unified = %v", r.Unified)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := tt.resources.LinuxResources()
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, r)
+		})
+	}
+
+	if _, err := (&Resources{CPUShares: -1}).LinuxResources(); err == nil {
+		t.Error("invalid resources are converted")
+	}
+}
+
+func TestNewSpecResources(t *testing.T) {
+	spec := newTestSpec(t, SpecOptions{
+		CgroupsPath: "/zcm/c1",
+		OOMScoreAdj: 100,
+		Resources:   &Resources{MemoryLimit: 1 << 20},
+	})
+	if spec.Linux.CgroupsPath != "/zcm/c1" {
+		t.Errorf("cgroups path = %s", spec.Linux.CgroupsPath)
+	}
+	if spec.Process.OOMScoreAdj == nil || *spec.Process.OOMScoreAdj != 100 {
+		t.Errorf("oom score adj = %v", spec.Process.OOMScoreAdj)
+	}
+	if r := spec.Linux.Resources; r == nil || r.Memory == nil || *r.Memory.Limit != 1<<20 {
+		t.Errorf("resources = %+v", r)
+	}
+}
+
+func TestUpdateResources(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.json")
+	b, err := NewSpec(SpecOptions{
+		RootPath:  newTestRootfs(t),
+		Command:   []string{"/bin/sh"},
+		Resources: &Resources{CPUShares: 512, MemoryLimit: 1 << 20},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	update, err := (&Resources{MemoryLimit: 2 << 20}).LinuxResources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated, err := UpdateResources(file, update)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := &specs.Spec{}
+	if err := json.Unmarshal(b, spec); err != nil {
+		t.Fatal(err)
+	}
+	r := spec.Linux.Resources
+	if *r.Memory.Limit != 2<<20 || *r.Memory.Swap != 2<<20 {
+		t.Errorf("memory = %+v, want updated", r.Memory)
+	}
+	if r.CPU == nil || *r.CPU.Shares != 512 {
+		t.Errorf("cpu = %+v, want kept", r.CPU)
+	}
+	if spec.Process == nil || len(spec.Process.Args) == 0 {
+		t.Error("rest of spec is lost")
+	}
+	if *updated.Memory.Limit != 2<<20 || *updated.CPU.Shares != 512 {
+		t.Errorf("returned resources = %+v, want the ones of the spec", updated)
+	}
+
+	if _, err := UpdateResources(filepath.Join(t.TempDir(), "missing.json"), update); err == nil {
+		t.Error("missing spec file is updated")
+	}
+}
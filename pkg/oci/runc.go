@@ -1,154 +1,515 @@
 package oci
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
-	"path"
+	"path/filepath"
 	"simpleconman/pkg/container"
+	shim "simpleconman/runtime"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
+// ErrShimNotRunning is the error of the container whose shim cannot be
+// dialed.
+var ErrShimNotRunning = errors.New("shim is not running")
+
+// ShimOptions are how the shim runs the containers.
+type ShimOptions struct {
+	// Path is the path to the shim binary
+	Path string
+	// RunDir is the run dir of the manager, which the shim serves the RPC
+	// socket in
+	RunDir string
+	// LogMaxLineSize, LogSync, LogMaxSize and LogMaxFiles are the options
+	// of the container log the shim writes. Zero values are the defaults of
+	// the shim.
+	LogMaxLineSize int
+	LogSync        string
+	LogMaxSize     int64
+	LogMaxFiles    int
+}
+
+// args returns the flags of the shim for the options which are set.
+func (o ShimOptions) args() []string {
+	var args []string
+	if o.RunDir != "" {
+		args = append(args, "--run-dir", o.RunDir)
+	}
+	if o.LogMaxLineSize > 0 {
+		args = append(args, "--log-max-line-size", strconv.Itoa(o.LogMaxLineSize))
+	}
+	if o.LogSync != "" {
+		args = append(args, "--log-sync", o.LogSync)
+	}
+	if o.LogMaxSize > 0 {
+		args = append(args, "--log-max-size", strconv.FormatInt(o.LogMaxSize, 10))
+	}
+	if o.LogMaxFiles > 0 {
+		args = append(args, "--log-max-files", strconv.Itoa(o.LogMaxFiles))
+	}
+	return args
+}
+
 type runcRuntime struct {
-	// shimmyPath is path to shimy executable
-	shimmyPath string
+	shim ShimOptions
 
 	// runtimePath is path to runc executable
 	runtimePath string
 
 	// rootPath is directory path to store container state
 	rootPath string
+
+	// systemdCgroup makes runc manage cgroups via systemd, in which case the
+	// cgroups path of the spec is in the form of "slice:prefix:name"
+	systemdCgroup bool
 }
 
-func NewRuncRuntime(shimmyPath string, runtimePath string, rootPath string) *runcRuntime {
+func NewRuncRuntime(shim ShimOptions, runtimePath string, rootPath string, systemdCgroup bool) *runcRuntime {
 	return &runcRuntime{
-		shimmyPath:  shimmyPath,
-		runtimePath: runtimePath,
-		rootPath:    rootPath,
+		shim:          shim,
+		runtimePath:   runtimePath,
+		rootPath:      rootPath,
+		systemdCgroup: systemdCgroup,
+	}
+}
+
+// command returns runc command with the global options
+func (r *runcRuntime) command(args ...string) *exec.Cmd {
+	globalArgs := []string{"--root", r.rootPath}
+	if r.systemdCgroup {
+		globalArgs = append(globalArgs, "--systemd-cgroup")
+	}
+	return exec.Command(r.runtimePath, append(globalArgs, args...)...)
+}
+
+// Version returns the version in the first line of `runc --version` such as
+// "runc version 1.1.4".
+func (r *runcRuntime) Version() (string, error) {
+	output, err := runCommand(exec.Command(r.runtimePath, "--version"))
+	if err != nil {
+		return "", err
+	}
+	line := strings.SplitN(string(output), "\n", 2)[0]
+	version := strings.TrimPrefix(strings.TrimSpace(line), "runc version ")
+	if version == "" {
+		return "", errors.Errorf("unknown runc version output [%s]", string(output))
 	}
+	return version, nil
 }
 
+// CreateContainer starts the shim of the container, which creates the
+// container with runc and stays with it. It returns once the container is
+// created.
 func (r *runcRuntime) CreateContainer(handle *container.Handle,
 	stdin bool, stdinOnce bool, timeout time.Duration) (*container.Instance, error) {
-	cmd := exec.Command(
-		r.shimmyPath,
-		"--shimmy-pidfile", path.Join(handle.BundleDir(), "shimmy.pid"),
-		"--shimmy-log-level", strings.ToUpper(logrus.GetLevel().String()),
-		"--runtime", r.runtimePath,
-		fmt.Sprintf("--runtime-arg='--root=%s'", r.rootPath),
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, r.shim.Path,
+		"--action", "start",
+		"--id", handle.Id().String(),
 		"--bundle", handle.BundleDir(),
-		"--container-id", handle.Id().String(),
-		"--container-pidfile", path.Join(handle.BundleDir(), "container.pid"),
-		"--container-logfile", handle.LogFile(),
-		"--container-exitfile", handle.ExitFile(),
-		"--container-attachfile", handle.AttachFile(),
+		"--runtime", r.runtimePath,
+		"--runtime-root", r.rootPath,
+		"--shim-pid", handle.ShimPidFile(),
+		"--pid-file", handle.ContainerPidFile(),
+		"--log-file", handle.LogFile(),
+		"--exit-file", handle.ExitFile(),
+		"--attach-file", handle.AttachFile(),
 	)
+	cmd.Args = append(cmd.Args, r.shim.args()...)
+	if r.systemdCgroup {
+		cmd.Args = append(cmd.Args, "--systemd-cgroup")
+	}
 	if stdin {
 		cmd.Args = append(cmd.Args, "--stdin")
 	}
 	if stdinOnce {
 		cmd.Args = append(cmd.Args, "--stdin-once")
 	}
+	cmd.Dir = handle.BundleDir()
 
-	syncPipeRead, syncPipeWrite, err := os.Pipe()
-	if err != nil {
+	if _, err := runCommand(cmd); err != nil {
+		if ctx.Err() != nil {
+			return nil, errors.Wrap(ctx.Err(), "timeout creating container")
+		}
 		return nil, err
 	}
-	defer syncPipeRead.Close()
-	defer syncPipeWrite.Close()
+	b, err := ioutil.ReadFile(handle.ContainerPidFile())
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read container pid file")
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "malformed container pid file [%s]", string(b))
+	}
+	return &container.Instance{Id: handle.Id(), Pid: uint32(pid), Status: container.Created}, nil
+}
 
-	cmd.ExtraFiles = append(cmd.ExtraFiles, syncPipeWrite)
-	cmd.Args = append(
-		cmd.Args,
-		"--syncpipe-fd", strconv.Itoa(2+len(cmd.ExtraFiles)),
-	)
+func (r *runcRuntime) StartContainer(handle *container.Handle) error {
+	cmd := r.command("start", handle.Id().String())
+	_, err := runCommand(cmd)
+	return err
+}
 
-	if _, err := runCommand(cmd); err != nil {
+func (r *runcRuntime) RuntimeState(handle *container.Handle) ([]byte, error) {
+	cmd := r.command("state", handle.Id().String())
+	return runCommand(cmd)
+}
+
+func (r *runcRuntime) Container(handle *container.Handle) (*container.Instance, error) {
+	runcState, err := r.state(handle)
+	if err != nil {
+		return nil, err
+	}
+	state, err := handle.State()
+	if err != nil {
 		return nil, err
 	}
+	result := &container.Instance{
+		Id:         handle.Id(),
+		Pid:        uint32(runcState.Pid),
+		CreatedAt:  runcState.Created,
+		StartedAt:  state.StartedAt,
+		FinishedAt: state.FinishedAt,
+		ExitCode:   state.ExitCode,
+		Status:     runcState.status(),
+		Metadata:   handle.Metadata(),
+	}
+	// container exited by itself, so nobody has recorded its exit yet
+	if result.Status == container.Stopped && state.Status != container.Stopped {
+		code, finishedAt, err := handle.ExitStatus()
+		if err == nil {
+			result.ExitCode = code
+			result.FinishedAt = finishedAt
+		} else if runcState.withoutShim {
+			// the shim is gone without writing the exit file
+			result.ExitCode = container.UnknownExitCode
+		}
+	}
+	return result, nil
+}
 
-	type Report struct {
-		Kind   string `json:"kind"`
-		Status string `json:"status"`
-		Stderr string `json:"stderr"`
-		Pid    int    `json:"pid"`
+// state asks the shim of the container for the state. If the shim is not
+// running, the state is taken from the exit file and runc instead.
+func (r *runcRuntime) state(handle *container.Handle) (*runcState, error) {
+	var state *runcState
+	err := r.withShim(handle, func(ctx context.Context, client *shim.Client) error {
+		resp, err := client.State(ctx)
+		if err != nil {
+			return err
+		}
+		state = &runcState{
+			Id:      handle.Id().String(),
+			Pid:     resp.Pid,
+			Status:  resp.Status,
+			Created: resp.CreatedAt,
+		}
+		return nil
+	})
+	if errors.Is(err, ErrShimNotRunning) {
+		logrus.WithError(err).Debugf("get state of container [%s] without shim", handle.Id())
+		return r.stateWithoutShim(handle)
 	}
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get state from shim")
+	}
+	return state, nil
+}
 
-	type Result struct {
-		Err    error
-		Report Report
+// stateWithoutShim returns the state of the container whose shim is gone,
+// e.g. killed or lost on reboot. The container which has the exit file or
+// which runc does not know has exited. The container which runc still runs
+// cannot be managed without the shim, so its status is unknown.
+func (r *runcRuntime) stateWithoutShim(handle *container.Handle) (*runcState, error) {
+	stopped := &runcState{Id: handle.Id().String(), Status: "stopped", withoutShim: true}
+	if _, _, err := handle.ExitStatus(); err == nil {
+		return stopped, nil
 	}
+	exists, err := r.runcExists(handle)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return stopped, nil
+	}
+	state := &runcState{Id: handle.Id().String(), Status: "unknown", withoutShim: true}
+	b, err := r.RuntimeState(handle)
+	if err != nil {
+		logrus.WithError(err).Warnf("cannot get state of container [%s] from runc", handle.Id())
+		return state, nil
+	}
+	if err := json.Unmarshal(b, state); err != nil {
+		return nil, errors.Wrap(err, "malformed runc state")
+	}
+	if state.status() != container.Stopped {
+		state.Status = "unknown"
+	}
+	return state, nil
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	ch := make(chan Result, 1)
+// runcExists reports whether runc has the state of the container in its root.
+func (r *runcRuntime) runcExists(handle *container.Handle) (bool, error) {
+	_, err := os.Stat(filepath.Join(r.rootPath, handle.Id().String(), "state.json"))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
 
-	go func() {
-		defer cancel()
+// Kill sends the signal through the shim, which runs runc kill with the
+// runtime root of the container.
+func (r *runcRuntime) Kill(handle *container.Handle, signal syscall.Signal, all bool) error {
+	return r.withShim(handle, func(ctx context.Context, client *shim.Client) error {
+		return client.Kill(ctx, signal, all)
+	})
+}
 
-		b, err := ioutil.ReadAll(syncPipeRead)
-		if err != nil {
-			ch <- Result{Err: err}
+// DeleteContainer deletes the container, and shuts down its shim which has
+// nothing more to do.
+func (r *runcRuntime) DeleteContainer(handle *container.Handle) error {
+	if err := r.deleteFromRunc(handle); err != nil {
+		return err
+	}
+	if err := r.shutdownShim(handle); err != nil {
+		logrus.WithError(err).Warnf("cannot shut down shim of container [%s], kill it", handle.Id())
+		return KillShim(r.shim.RunDir, handle)
+	}
+	return nil
+}
+
+// deleteFromRunc deletes the container from runc. The container which runc
+// does not know is already deleted.
+func (r *runcRuntime) deleteFromRunc(handle *container.Handle) error {
+	exists, err := r.runcExists(handle)
+	if err != nil || !exists {
+		return err
+	}
+	cmd := r.command("delete", "--force", handle.Id().String())
+	if _, err := runCommand(cmd); err != nil {
+		// runc may have deleted the container by itself meanwhile
+		if exists, _ := r.runcExists(handle); exists {
+			return err
 		}
-		syncPipeRead.Close()
+	}
+	return nil
+}
 
-		report := &Report{}
-		if err := json.Unmarshal(b, report); err != nil {
-			ch <- Result{
-				Err: errors.Wrap(err,
-					fmt.Sprintf("failed to decode report [%v]. raw [%v]", string(b), b)),
+// shutdownShim waits for the shim to record the exit of the container, and
+// shuts it down. The shim which is not running is not an error.
+func (r *runcRuntime) shutdownShim(handle *container.Handle) error {
+	ctx, cancel := context.WithTimeout(context.Background(), shimCallTimeout)
+	defer cancel()
+	client, err := shim.Dial(ctx, r.shim.RunDir, handle.Id().String())
+	if err != nil {
+		// the shim removes the socket on shutdown
+		return nil
+	}
+	defer client.Close()
+	if _, err := client.Wait(ctx); err != nil {
+		return errors.Wrap(err, "cannot wait for container exit")
+	}
+	return client.Shutdown(ctx)
+}
+
+// KillShim kills the shim of the container if it has been started, and
+// removes the socket it has left in the run dir.
+func KillShim(runDir string, handle *container.Handle) error {
+	pid, err := handle.ShimPid()
+	if os.IsNotExist(errors.Cause(err)) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := syscall.Kill(pid, syscall.SIGKILL); err != nil && err != syscall.ESRCH {
+		return err
+	}
+	addr, err := shim.ShimAddr(context.Background(), runDir, handle.Id().String())
+	if err != nil {
+		return err
+	}
+	if err := shim.RemoveSocket(addr); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (r *runcRuntime) UpdateContainer(handle *container.Handle, resources *specs.LinuxResources) error {
+	b, err := json.Marshal(resources)
+	if err != nil {
+		return errors.Wrap(err, "cannot encode resources")
+	}
+	cmd := r.command("update", "--resources", "-", handle.Id().String())
+	cmd.Stdin = bytes.NewReader(b)
+	_, err = runCommand(cmd)
+	return err
+}
+
+func (r *runcRuntime) Exec(ctx context.Context, handle *container.Handle,
+	process *specs.Process, stdio Stdio) (int, error) {
+	processFile, err := writeTempJSON(handle.BundleDir(), "exec-*.json", process)
+	if err != nil {
+		return 0, errors.Wrap(err, "cannot write process file")
+	}
+	defer os.Remove(processFile)
+	pidFile := strings.TrimSuffix(processFile, ".json") + ".pid"
+	defer os.Remove(pidFile)
+
+	cmd := r.command("exec", "--process", processFile, "--pid-file", pidFile, handle.Id().String())
+	// processes forked by the exec'd one may hold the output pipes after it
+	// exits, which would block Wait forever
+	cmd.WaitDelay = execWaitDelay
+	var (
+		console *console
+		stdin   io.WriteCloser
+	)
+	if process.Terminal {
+		if console, err = newConsole(); err != nil {
+			return 0, err
+		}
+		console.setup(cmd)
+	} else {
+		cmd.Stdout = stdio.Stdout
+		cmd.Stderr = stdio.Stderr
+		// the copy of stdin does not hold Wait as the pipe of exec.Cmd does
+		if stdio.Stdin != nil {
+			if stdin, err = cmd.StdinPipe(); err != nil {
+				return 0, errors.Wrap(err, "cannot create stdin pipe")
 			}
 		}
-
-		if report.Kind != "container_pid" && report.Pid <= 0 {
-			ch <- Result{Err: errors.Errorf("%+v", report)}
+	}
+	if err := cmd.Start(); err != nil {
+		if console != nil {
+			console.abort()
 		}
-
-		ch <- Result{Report: *report}
+		return 0, errors.Wrap(err, "cannot run runc exec")
+	}
+	if console != nil {
+		console.start(stdio)
+		defer console.close()
+	}
+	if stdin != nil {
+		go func() {
+			io.Copy(stdin, stdio.Stdin)
+			stdin.Close()
+		}()
+	}
+	waitCh := make(chan error, 1)
+	go func() {
+		waitCh <- cmd.Wait()
 	}()
 
 	select {
+	case err = <-waitCh:
 	case <-ctx.Done():
-		return nil, errors.Wrap(ctx.Err(), "timeout")
-	case result := <-ch:
-		if result.Err != nil {
-			return nil, err
+		// runc exec exits with the process
+		if err := killPidFile(pidFile); err != nil {
+			logrus.WithError(err).Warnf("cannot kill process exec'd in container [%s]", handle.Id())
+			cmd.Process.Kill()
 		}
-		// FIXME: maybe we don't need to return as *Instance type
-		return &container.Instance{Pid: uint32(result.Report.Pid)}, nil
+		<-waitCh
+		return 0, errors.Wrapf(ctx.Err(), "exec in container [%s] is not done in time", handle.Id())
+	}
+	logrus.WithError(err).Debugf("exec %s", strings.Join(cmd.Args, " "))
+	if errors.Is(err, exec.ErrWaitDelay) {
+		// the exec'd process exited successfully, but its output may be cut
+		logrus.Warnf("output of process exec'd in container [%s] is still held open", handle.Id())
+		err = nil
+	}
+	var ee *exec.ExitError
+	if errors.As(err, &ee) {
+		return ee.ExitCode(), nil
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "runc exec failed")
 	}
+	return 0, nil
 }
 
-func (r *runcRuntime) StartContainer(handle *container.Handle) error {
-	cmd := exec.Command(
-		r.runtimePath,
-		"--root", r.rootPath,
-		"start", handle.Id().String(),
-	)
-	_, err := runCommand(cmd)
-	return err
+// execWaitDelay is how long output of the exec'd process is copied after it
+// exits
+const execWaitDelay = 2 * time.Second
+
+// shimCallTimeout limits each call to the shim of the container
+const shimCallTimeout = 5 * time.Second
+
+// withShim calls fn with the client of the shim of the container. The shim
+// which cannot be dialed is an error, as it has died or never been started.
+func (r *runcRuntime) withShim(handle *container.Handle, fn func(ctx context.Context, client *shim.Client) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), shimCallTimeout)
+	defer cancel()
+	client, err := shim.Dial(ctx, r.shim.RunDir, handle.Id().String())
+	if err != nil {
+		return errors.Wrapf(ErrShimNotRunning, "container [%s]: %v", handle.Id(), err)
+	}
+	defer client.Close()
+	return fn(ctx, client)
 }
 
-func (r *runcRuntime) Container(handle *container.Handle) (*container.Instance, error) {
-	cmd := exec.Command(
-		r.runtimePath,
-		"--root", r.rootPath,
-		"state",
-		handle.Id().String(),
-	)
-	b, err := runCommand(cmd)
+func writeTempJSON(dir, pattern string, v interface{}) (string, error) {
+	f, err := ioutil.TempFile(dir, pattern)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	result := &container.Instance{}
-	return result, json.Unmarshal(b, result)
+	defer f.Close()
+	if err := json.NewEncoder(f).Encode(v); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+func killPidFile(pidFile string) error {
+	b, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		return err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return errors.Wrapf(err, "malformed pid file [%s]", string(b))
+	}
+	if err := syscall.Kill(pid, syscall.SIGKILL); err != nil && err != syscall.ESRCH {
+		return err
+	}
+	return nil
+}
+
+// runcState is the output of `runc state`
+type runcState struct {
+	Id      string    `json:"id"`
+	Pid     int       `json:"pid"`
+	Status  string    `json:"status"`
+	Created time.Time `json:"created"`
+	// withoutShim is whether the state was taken without the shim
+	withoutShim bool
+}
+
+func (s *runcState) status() container.Status {
+	switch s.Status {
+	case "creating", "created":
+		return container.Created
+	case "running", "pausing", "paused":
+		return container.Running
+	case "stopped":
+		return container.Stopped
+	}
+	return container.Unknown
 }
 
 func runCommand(cmd *exec.Cmd) ([]byte, error) {
@@ -190,6 +551,13 @@ type runcContainerGetter struct {
 	runcRuntime   *runcRuntime
 }
 
+func NewRuncContainerGetter(store container.ReadOnlyStore, runtime *runcRuntime) *runcContainerGetter {
+	return &runcContainerGetter{
+		readOnlyStore: store,
+		runcRuntime:   runtime,
+	}
+}
+
 func (r *runcContainerGetter) Get(id container.Id) (*container.Instance, *container.Handle, error) {
 	handle, err := r.readOnlyStore.Get(id)
 	if err != nil {
@@ -202,6 +570,23 @@ func (r *runcContainerGetter) Get(id container.Id) (*container.Instance, *contai
 	return cont, handle, nil
 }
 
+// List returns every container of the store. The container whose state
+// cannot be read is listed in unknown state, not to hide the others.
 func (r *runcContainerGetter) List() ([]*container.Instance, error) {
-	panic("not implemented") // TODO: Implement
+	iter := r.readOnlyStore.Iter()
+	result := []*container.Instance{}
+	for iter.HasNext() {
+		handle := iter.Next()
+		cont, err := r.runcRuntime.Container(handle)
+		if err != nil {
+			logrus.WithError(err).Warnf("cannot get state of container [%s]", handle.Id())
+			cont = &container.Instance{
+				Id:       handle.Id(),
+				Status:   container.Unknown,
+				Metadata: handle.Metadata(),
+			}
+		}
+		result = append(result, cont)
+	}
+	return result, nil
 }
@@ -0,0 +1,252 @@
+package oci
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"simpleconman/pkg/container"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// newFakeRunc returns the runtime whose runc is the script. The script gets
+// the pid file of `runc exec` in $pidfile.
+func newFakeRunc(t *testing.T, script string) (*runcRuntime, *container.Handle) {
+	t.Helper()
+	dir := t.TempDir()
+	runc := filepath.Join(dir, "runc")
+	content := "#!/bin/sh\n" +
+		"while [ $# -gt 0 ]; do\n" +
+		"\tcase \"$1\" in --pid-file) pidfile=$2; shift;; esac\n" +
+		"\tshift\n" +
+		"done\n" +
+		"echo $$ > \"$pidfile\"\n" + script
+	if err := os.WriteFile(runc, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+	file := func(id container.Id) string {
+		return path.Join(dir, "files", id.String())
+	}
+	handle, err := container.NewHandle(nil, "c1", func(id container.Id) string {
+		return path.Join(dir, "containers", id.String())
+	}, file, file, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(handle.BundleDir(), 0700); err != nil {
+		t.Fatal(err)
+	}
+	return NewRuncRuntime(ShimOptions{}, runc, filepath.Join(dir, "root"), false), handle
+}
+
+func TestExec(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   string
+		timeout  time.Duration
+		wantCode int
+		wantOut  string
+		wantErr  error
+	}{
+		{"exit", "echo out\nexit 3\n", time.Minute, 3, "out\n", nil},
+		{"child holds output", "echo out\nsleep 5 &\nexit 0\n", time.Minute, 0, "out\n", nil},
+		{"timeout", "sleep 5\n", 200 * time.Millisecond, 0, "", context.DeadlineExceeded},
+		{"timeout with child holding output", "sleep 5 &\nwait\n", 200 * time.Millisecond, 0, "", context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, handle := newFakeRunc(t, tt.script)
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+
+			stdout := &bytes.Buffer{}
+			start := time.Now()
+			code, err := r.Exec(ctx, handle, &specs.Process{Args: []string{"true"}}, Stdio{
+				Stdout: stdout,
+				Stderr: &bytes.Buffer{},
+			})
+			if elapsed := time.Since(start); elapsed > execWaitDelay+2*time.Second {
+				t.Errorf("exec took %s", elapsed)
+			}
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if code != tt.wantCode {
+				t.Errorf("exit code = %d, want %d", code, tt.wantCode)
+			}
+			if stdout.String() != tt.wantOut {
+				t.Errorf("stdout = %q, want %q", stdout.String(), tt.wantOut)
+			}
+		})
+	}
+}
+
+func TestShimOptionsArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		opts ShimOptions
+		want string
+	}{
+		{"defaults", ShimOptions{Path: "zcm-shim"}, ""},
+		{"log line", ShimOptions{LogMaxLineSize: 1024, LogSync: "line"}, "--log-max-line-size 1024 --log-sync line"},
+		{"log rotation", ShimOptions{LogMaxSize: 1 << 20, LogMaxFiles: 3}, "--log-max-size 1048576 --log-max-files 3"},
+		{"run dir", ShimOptions{RunDir: "/run/zcm"}, "--run-dir /run/zcm"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.Join(tt.opts.args(), " "); got != tt.want {
+				t.Errorf("args() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContainerWithoutShim(t *testing.T) {
+	tests := []struct {
+		name       string
+		exitFile   string
+		runcState  bool
+		script     string
+		wantStatus container.Status
+		wantCode   int32
+	}{
+		{"exit file", "3\n", true, "exit 1\n", container.Stopped, 3},
+		{"unknown to runc", "", false, "exit 1\n", container.Stopped, container.UnknownExitCode},
+		{"stopped in runc", "", true, "echo '{\"id\":\"c1\",\"status\":\"stopped\"}'\n", container.Stopped, container.UnknownExitCode},
+		{"running in runc", "", true, "echo '{\"id\":\"c1\",\"pid\":1,\"status\":\"running\"}'\n", container.Unknown, 0},
+		{"runc fails", "", true, "exit 1\n", container.Unknown, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, handle := newFakeRunc(t, tt.script)
+			r.shim.RunDir = t.TempDir()
+			if tt.exitFile != "" {
+				if err := os.MkdirAll(filepath.Dir(handle.ExitFile()), 0700); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(handle.ExitFile(), []byte(tt.exitFile), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.runcState {
+				dir := filepath.Join(r.rootPath, handle.Id().String())
+				if err := os.MkdirAll(dir, 0700); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(dir, "state.json"), []byte("{}"), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			cont, err := r.Container(handle)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cont.Status != tt.wantStatus {
+				t.Errorf("status = %v, want %v", cont.Status, tt.wantStatus)
+			}
+			if cont.ExitCode != tt.wantCode {
+				t.Errorf("exit code = %d, want %d", cont.ExitCode, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestDeleteContainer(t *testing.T) {
+	tests := []struct {
+		name      string
+		runcState bool
+		script    string
+		wantErr   bool
+		wantCall  bool
+	}{
+		{"unknown to runc", false, "", false, false},
+		{"deleted", true, "rm -r \"$root\"\n", false, true},
+		{"deleted by runc meanwhile", true, "rm -r \"$root\"\nexit 1\n", false, true},
+		{"fails", true, "exit 1\n", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script := "root=\"$(dirname \"$0\")/root/c1\"\n" +
+				"touch \"$(dirname \"$0\")/called\"\n" + tt.script
+			r, handle := newFakeRunc(t, script)
+			r.shim.RunDir = t.TempDir()
+			dir := filepath.Join(r.rootPath, handle.Id().String())
+			if tt.runcState {
+				if err := os.MkdirAll(dir, 0700); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(dir, "state.json"), []byte("{}"), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := r.DeleteContainer(handle)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DeleteContainer() error = %v, want error %v", err, tt.wantErr)
+			}
+			_, err = os.Stat(filepath.Join(filepath.Dir(r.runtimePath), "called"))
+			if called := err == nil; called != tt.wantCall {
+				t.Errorf("runc called = %v, want %v", called, tt.wantCall)
+			}
+		})
+	}
+}
+
+func TestContainerGetterList(t *testing.T) {
+	// c1 has exited and c2 is running without the shim
+	r, c1 := newFakeRunc(t, "echo '{\"id\":\"c2\",\"pid\":1,\"status\":\"running\"}'\n")
+	r.shim.RunDir = t.TempDir()
+	dir := filepath.Dir(filepath.Dir(c1.BaseDir()))
+	file := func(id container.Id) string {
+		return path.Join(dir, "files", id.String())
+	}
+	c2, err := container.NewHandle(nil, "c2", func(id container.Id) string {
+		return path.Join(dir, "containers", id.String())
+	}, file, file, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(c1.ExitFile()), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(c1.ExitFile(), []byte("0\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(r.rootPath, "c2"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(r.rootPath, "c2", "state.json"), []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	store := container.NewInMemStore()
+	for _, handle := range []*container.Handle{c1, c2} {
+		if err := store.Put(handle); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conts, err := NewRuncContainerGetter(store, r).List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := map[container.Id]container.Status{}
+	for _, cont := range conts {
+		statuses[cont.Id] = cont.Status
+	}
+	want := map[container.Id]container.Status{"c1": container.Stopped, "c2": container.Unknown}
+	if len(statuses) != len(want) || statuses["c1"] != want["c1"] || statuses["c2"] != want["c2"] {
+		t.Errorf("statuses = %v, want %v", statuses, want)
+	}
+}
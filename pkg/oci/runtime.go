@@ -1,13 +1,47 @@
 package oci
 
 import (
+	"context"
+	"io"
 	"simpleconman/pkg/container"
+	"syscall"
 	"time"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
 )
 
 type Runtime interface {
+	// Version returns the version of the OCI runtime.
+	Version() (string, error)
 	CreateContainer(handle *container.Handle, stdin bool,
 		stdinOnce bool, timeout time.Duration) (*container.Instance, error)
 	StartContainer(*container.Handle) error
 	Container(handle *container.Handle) (*container.Instance, error)
+	// RuntimeState returns the raw state of the container reported by the
+	// OCI runtime.
+	RuntimeState(handle *container.Handle) ([]byte, error)
+	// Kill sends the signal to the container init process. If all is true,
+	// the signal is sent to every process in the container.
+	Kill(handle *container.Handle, signal syscall.Signal, all bool) error
+	// DeleteContainer deletes the container from the OCI runtime. Deleting
+	// container which the runtime does not know is not an error.
+	DeleteContainer(handle *container.Handle) error
+	// UpdateContainer changes the cgroup limits of the created or running
+	// container. Only the resources which are set are changed.
+	UpdateContainer(handle *container.Handle, resources *specs.LinuxResources) error
+	// Exec runs the process in the running container, and returns its exit
+	// code once it exits. The process is killed if ctx is done. The process
+	// gets a terminal if process.Terminal is set.
+	Exec(ctx context.Context, handle *container.Handle, process *specs.Process, stdio Stdio) (int, error)
+}
+
+// Stdio are the streams of the process exec'd in the container. Nil stream
+// is not connected. Stderr is unused if the process has a terminal, whose
+// output is all written to Stdout.
+type Stdio struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	// Resize gives the size of the terminal of the process
+	Resize <-chan TerminalSize
 }
@@ -0,0 +1,222 @@
+package oci
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/opencontainers/runtime-tools/generate"
+	"github.com/opencontainers/runtime-tools/validate"
+	"github.com/pkg/errors"
+	"github.com/syndtr/gocapability/capability"
+	"golang.org/x/sys/unix"
+)
+
+const allCapabilities = "ALL"
+
+var (
+	// DefaultMaskedPaths and DefaultReadonlyPaths are the ones the kubelet
+	// asks for with the default proc mount.
+	DefaultMaskedPaths = []string{
+		"/proc/acpi",
+		"/proc/kcore",
+		"/proc/keys",
+		"/proc/latency_stats",
+		"/proc/timer_list",
+		"/proc/timer_stats",
+		"/proc/sched_debug",
+		"/proc/scsi",
+		"/sys/firmware",
+	}
+	DefaultReadonlyPaths = []string{
+		"/proc/asound",
+		"/proc/bus",
+		"/proc/fs",
+		"/proc/irq",
+		"/proc/sys",
+		"/proc/sysrq-trigger",
+	}
+)
+
+// setupSecurity applies privileged mode, capabilities, no_new_privs, masked
+// and readonly paths to the spec.
+func setupSecurity(gen *generate.Generator, opts SpecOptions) error {
+	gen.SetProcessNoNewPrivileges(opts.NoNewPrivileges)
+	if opts.Privileged {
+		return setupPrivileged(gen)
+	}
+	if err := setupCapabilities(gen, opts.AddCapabilities, opts.DropCapabilities); err != nil {
+		return err
+	}
+
+	// replaces the defaults of the generator, as containerd does
+	spec := gen.Spec()
+	spec.Linux.MaskedPaths = append([]string{}, opts.MaskedPaths...)
+	spec.Linux.ReadonlyPaths = append([]string{}, opts.ReadonlyPaths...)
+	return nil
+}
+
+// setupPrivileged gives the container all capabilities and all host devices,
+// and lets it write to sysfs.
+func setupPrivileged(gen *generate.Generator) error {
+	gen.SetupPrivileged(true)
+
+	devices, err := hostDevices()
+	if err != nil {
+		return err
+	}
+	for _, d := range devices {
+		gen.AddDevice(d)
+	}
+	gen.AddLinuxResourcesDevice(true, "a", nil, nil, "rwm")
+
+	spec := gen.Spec()
+	for i, m := range spec.Mounts {
+		if m.Destination != "/sys" {
+			continue
+		}
+		var options []string
+		for _, o := range m.Options {
+			if o != "ro" {
+				options = append(options, o)
+			}
+		}
+		spec.Mounts[i].Options = append(options, "rw")
+	}
+	spec.Linux.MaskedPaths = nil
+	spec.Linux.ReadonlyPaths = nil
+	return nil
+}
+
+// setupCapabilities adds and drops capabilities from the default set. "ALL"
+// in add gives every capability, and "ALL" in drop removes every capability
+// before the others are added. Inheritable and ambient capabilities are never
+// given.
+func setupCapabilities(gen *generate.Generator, add, drop []string) error {
+	caps := gen.Spec().Process.Capabilities
+	current := append([]string{}, caps.Bounding...)
+	if containsCapability(add, allCapabilities) {
+		current = hostCapabilities()
+	}
+	if containsCapability(drop, allCapabilities) {
+		current = []string{}
+	}
+	for _, c := range add {
+		name := capabilityName(c)
+		if name == allCapabilities {
+			continue
+		}
+		if err := validate.CapValid(name, true); err != nil {
+			return errors.Wrapf(err, "cannot add capability [%s]", c)
+		}
+		if !containsCapability(current, name) {
+			current = append(current, name)
+		}
+	}
+	for _, c := range drop {
+		name := capabilityName(c)
+		if name == allCapabilities {
+			continue
+		}
+		var result []string
+		for _, cap := range current {
+			if cap != name {
+				result = append(result, cap)
+			}
+		}
+		current = result
+	}
+
+	caps.Bounding = current
+	caps.Effective = append([]string{}, current...)
+	caps.Permitted = append([]string{}, current...)
+	caps.Inheritable = []string{}
+	caps.Ambient = []string{}
+	return nil
+}
+
+// capabilityName normalizes c in the form of CAP_XXX.
+func capabilityName(c string) string {
+	name := strings.ToUpper(c)
+	if name == allCapabilities || strings.HasPrefix(name, "CAP_") {
+		return name
+	}
+	return "CAP_" + name
+}
+
+func containsCapability(caps []string, c string) bool {
+	for _, cap := range caps {
+		if capabilityName(cap) == c {
+			return true
+		}
+	}
+	return false
+}
+
+// hostCapabilities lists every capability the host kernel supports.
+func hostCapabilities() []string {
+	var result []string
+	for _, c := range capability.List() {
+		if c > validate.LastCap() {
+			continue
+		}
+		result = append(result, fmt.Sprintf("CAP_%s", strings.ToUpper(c.String())))
+	}
+	return result
+}
+
+// hostDevices lists char and block devices under /dev except the ones in the
+// dirs which the container has of its own.
+func hostDevices() ([]specs.LinuxDevice, error) {
+	var result []specs.LinuxDevice
+	err := filepath.Walk("/dev", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// devices may be removed while walking
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			switch info.Name() {
+			case "pts", "shm", "fd", "mqueue", ".lxc", ".lxd-mounts", ".udev":
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Name() == "console" {
+			return nil
+		}
+		var devType string
+		switch {
+		case info.Mode()&os.ModeCharDevice != 0:
+			devType = "c"
+		case info.Mode()&os.ModeDevice != 0:
+			devType = "b"
+		default:
+			return nil
+		}
+		var stat unix.Stat_t
+		if err := unix.Lstat(path, &stat); err != nil {
+			return nil
+		}
+		mode := info.Mode().Perm()
+		uid, gid := stat.Uid, stat.Gid
+		result = append(result, specs.LinuxDevice{
+			Path:     path,
+			Type:     devType,
+			Major:    int64(unix.Major(stat.Rdev)),
+			Minor:    int64(unix.Minor(stat.Rdev)),
+			FileMode: &mode,
+			UID:      &uid,
+			GID:      &gid,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot list host devices")
+	}
+	return result, nil
+}
@@ -0,0 +1,139 @@
+package oci
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSetupSecurityPaths(t *testing.T) {
+	tests := []struct {
+		name         string
+		opts         SpecOptions
+		wantMasked   []string
+		wantReadonly []string
+	}{
+		{
+			name:         "defaults",
+			opts:         SpecOptions{MaskedPaths: DefaultMaskedPaths, ReadonlyPaths: DefaultReadonlyPaths},
+			wantMasked:   DefaultMaskedPaths,
+			wantReadonly: DefaultReadonlyPaths,
+		},
+		{
+			name:         "given",
+			opts:         SpecOptions{MaskedPaths: []string{"/proc/kcore"}, ReadonlyPaths: []string{"/proc/sys"}},
+			wantMasked:   []string{"/proc/kcore"},
+			wantReadonly: []string{"/proc/sys"},
+		},
+		{
+			name:         "unmasked",
+			opts:         SpecOptions{MaskedPaths: []string{}, ReadonlyPaths: []string{}},
+			wantMasked:   nil,
+			wantReadonly: nil,
+		},
+		{
+			name:         "none given",
+			opts:         SpecOptions{},
+			wantMasked:   nil,
+			wantReadonly: nil,
+		},
+		{
+			name: "privileged",
+			opts: SpecOptions{
+				Privileged:    true,
+				MaskedPaths:   DefaultMaskedPaths,
+				ReadonlyPaths: DefaultReadonlyPaths,
+			},
+			wantMasked:   nil,
+			wantReadonly: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := newTestSpec(t, tt.opts)
+			if got := strings.Join(spec.Linux.MaskedPaths, ","); got != strings.Join(tt.wantMasked, ",") {
+				t.Errorf("masked paths = [%s], want %v", got, tt.wantMasked)
+			}
+			if got := strings.Join(spec.Linux.ReadonlyPaths, ","); got != strings.Join(tt.wantReadonly, ",") {
+				t.Errorf("readonly paths = [%s], want %v", got, tt.wantReadonly)
+			}
+		})
+	}
+}
+
+func TestSetupCapabilities(t *testing.T) {
+	tests := []struct {
+		name    string
+		add     []string
+		drop    []string
+		want    []string
+		notWant []string
+	}{
+		{"default", nil, nil, []string{"CAP_CHOWN", "CAP_KILL"}, []string{"CAP_SYS_ADMIN"}},
+		{"add", []string{"SYS_ADMIN"}, nil, []string{"CAP_CHOWN", "CAP_SYS_ADMIN"}, nil},
+		{"add with prefix", []string{"cap_net_admin"}, nil, []string{"CAP_NET_ADMIN"}, nil},
+		{"drop", nil, []string{"CHOWN"}, []string{"CAP_KILL"}, []string{"CAP_CHOWN"}},
+		{"add all", []string{"ALL"}, nil, []string{"CAP_SYS_ADMIN", "CAP_NET_ADMIN"}, nil},
+		{"add all drop one", []string{"ALL"}, []string{"SYS_ADMIN"}, []string{"CAP_NET_ADMIN"}, []string{"CAP_SYS_ADMIN"}},
+		{"drop all", nil, []string{"ALL"}, nil, []string{"CAP_CHOWN", "CAP_KILL"}},
+		{"drop all add one", []string{"NET_BIND_SERVICE"}, []string{"ALL"}, []string{"CAP_NET_BIND_SERVICE"}, []string{"CAP_CHOWN"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := newTestSpec(t, SpecOptions{AddCapabilities: tt.add, DropCapabilities: tt.drop})
+			caps := spec.Process.Capabilities
+			for _, set := range [][]string{caps.Bounding, caps.Effective, caps.Permitted} {
+				for _, c := range tt.want {
+					if !containsCapability(set, c) {
+						t.Errorf("%s is missing in %v", c, set)
+					}
+				}
+				for _, c := range tt.notWant {
+					if containsCapability(set, c) {
+						t.Errorf("%s is given in %v", c, set)
+					}
+				}
+			}
+			if len(caps.Inheritable) != 0 || len(caps.Ambient) != 0 {
+				t.Errorf("inheritable %v and ambient %v are given", caps.Inheritable, caps.Ambient)
+			}
+		})
+	}
+}
+
+func TestSetupCapabilitiesInvalid(t *testing.T) {
+	_, err := NewSpec(SpecOptions{
+		RootPath:        newTestRootfs(t),
+		Command:         []string{"/bin/sh"},
+		AddCapabilities: []string{"NO_SUCH_CAP"},
+	})
+	if err == nil {
+		t.Error("invalid capability is added")
+	}
+}
+
+func TestSetupNoNewPrivileges(t *testing.T) {
+	for _, want := range []bool{true, false} {
+		spec := newTestSpec(t, SpecOptions{NoNewPrivileges: want})
+		if spec.Process.NoNewPrivileges != want {
+			t.Errorf("no_new_privs = %v, want %v", spec.Process.NoNewPrivileges, want)
+		}
+	}
+}
+
+func TestCapabilityName(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"chown", "CAP_CHOWN"},
+		{"CHOWN", "CAP_CHOWN"},
+		{"CAP_CHOWN", "CAP_CHOWN"},
+		{"cap_chown", "CAP_CHOWN"},
+		{"all", "ALL"},
+	}
+	for _, tt := range tests {
+		if got := capabilityName(tt.in); got != tt.want {
+			t.Errorf("capabilityName(%s) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,392 @@
+package oci
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"simpleconman/pkg/container"
+	shim "simpleconman/runtime"
+	"simpleconman/runtime/runc"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// the test binary runs as the shim if the env is set
+const shimEnv = "ZCM_TEST_SHIM"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(shimEnv) == "1" {
+		shim.Run(runc.New())
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// fakeShimRunc is runc which runs the command in the file "command" of the
+// bundle as the container. Creation fails if the bundle has the file "fail".
+const fakeShimRunc = `#!/bin/sh
+while [ $# -gt 0 ]; do
+	case "$1" in
+	--root) shift;;
+	--systemd-cgroup) ;;
+	*) break;;
+	esac
+	shift
+done
+cmd=$1
+shift
+case "$cmd" in
+create)
+	while [ $# -gt 0 ]; do
+		case "$1" in
+		--pid-file) pidfile=$2; shift;;
+		--bundle|--console-socket) shift;;
+		esac
+		shift
+	done
+	if [ -f fail ]; then
+		echo "no such image" >&2
+		exit 1
+	fi
+	# background job of sh reads /dev/null unless stdin is given by another fd
+	exec 3<&0
+	sh -c "$(cat command)" <&3 3<&- &
+	echo $! > "$pidfile"
+	;;
+state)
+	echo '{"status": "running"}'
+	;;
+kill)
+	kill -9 $(cat container.pid)
+	;;
+esac
+`
+
+// newShimTest returns the runtime which starts the test binary as the shim
+// with the options, and the handle of the container which runs the command.
+func newShimTest(t *testing.T, opts ShimOptions, command string) (*runcRuntime, *container.Handle) {
+	t.Helper()
+	t.Setenv(shimEnv, "1")
+	// the temp dir of the test is too long for the path of unix socket
+	runDir, err := os.MkdirTemp("", "zcm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(runDir) })
+
+	dir := t.TempDir()
+	runcPath := filepath.Join(dir, "runc")
+	if err := os.WriteFile(runcPath, []byte(fakeShimRunc), 0755); err != nil {
+		t.Fatal(err)
+	}
+	file := func(name string) container.BaseFileFn {
+		return func(id container.Id) string {
+			return path.Join(dir, name, id.String())
+		}
+	}
+	for _, name := range []string{"logs", "attach", "exits"} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	id := container.Id(fmt.Sprintf("test-%d", time.Now().UnixNano()))
+	handle, err := container.NewHandle(nil, id, func(id container.Id) string {
+		return path.Join(dir, "containers", id.String())
+	}, file("logs"), file("attach"), file("exits"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(handle.BundleDir(), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := handle.Bundle([]byte(`{"process": {}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(handle.BundleDir(), "command"), []byte(command), 0600); err != nil {
+		t.Fatal(err)
+	}
+	opts.Path = os.Args[0]
+	opts.RunDir = runDir
+	r := NewRuncRuntime(opts, runcPath, filepath.Join(dir, "root"), false)
+	t.Cleanup(func() {
+		KillShim(runDir, handle)
+	})
+	return r, handle
+}
+
+func waitFile(t *testing.T, file string) []byte {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		b, err := os.ReadFile(file)
+		if err == nil && len(b) > 0 {
+			return b
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("[%s] is not written", file)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func shimRunning(handle *container.Handle) bool {
+	pid, err := handle.ShimPid()
+	if err != nil {
+		return false
+	}
+	return syscall.Kill(pid, 0) == nil
+}
+
+func TestShimLifecycle(t *testing.T) {
+	r, handle := newShimTest(t, ShimOptions{}, "echo hello; exec sleep 60")
+
+	cont, err := r.CreateContainer(handle, false, false, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cont.Pid == 0 {
+		t.Error("pid of container is not returned")
+	}
+	if !shimRunning(handle) {
+		t.Fatal("shim is not running")
+	}
+	state, err := r.Container(handle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Pid != cont.Pid || state.Status != container.Running {
+		t.Errorf("state = %+v, want running with pid %d", state, cont.Pid)
+	}
+	if log := string(waitFile(t, handle.LogFile())); !strings.HasSuffix(log, " stdout F hello\n") {
+		t.Errorf("log = %q", log)
+	}
+
+	if err := r.Kill(handle, syscall.SIGKILL, false); err != nil {
+		t.Fatal(err)
+	}
+	if code := string(waitFile(t, handle.ExitFile())); code != "137" {
+		t.Errorf("exit code = %s, want 137", code)
+	}
+	if err := r.DeleteContainer(handle); err != nil {
+		t.Fatal(err)
+	}
+	// the shim is shut down once it has removed the socket
+	addr, _ := shim.ShimAddr(context.Background(), r.shim.RunDir, handle.Id().String())
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(shim.SocketPath(addr)); os.IsNotExist(err) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("shim is not shut down")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestShimCreateFailure(t *testing.T) {
+	r, handle := newShimTest(t, ShimOptions{}, "exec sleep 60")
+	if err := os.WriteFile(filepath.Join(handle.BundleDir(), "fail"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := r.CreateContainer(handle, false, false, 10*time.Second)
+	if err == nil {
+		t.Fatal("creation succeeded")
+	}
+	if !strings.Contains(err.Error(), "no such image") {
+		t.Errorf("err = %v, want the one of runc", err)
+	}
+	if shimRunning(handle) {
+		t.Error("shim is left running")
+	}
+}
+
+func TestShimAttach(t *testing.T) {
+	r, handle := newShimTest(t, ShimOptions{}, "exec cat")
+
+	if _, err := r.CreateContainer(handle, true, true, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.DialUnix("unixpacket", nil, &net.UnixAddr{Name: handle.AttachFile(), Net: "unixpacket"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("ping\n")); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 8193)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(buf[:n]); got != "\x02ping\n" {
+		t.Errorf("packet = %q, want stdout ping", got)
+	}
+
+	// stdin once closes the stdin of the container, so cat exits
+	if err := conn.CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	if code := string(waitFile(t, handle.ExitFile())); code != "0" {
+		t.Errorf("exit code = %s, want 0", code)
+	}
+	if log := string(waitFile(t, handle.LogFile())); !strings.HasSuffix(log, " stdout F ping\n") {
+		t.Errorf("log = %q", log)
+	}
+	if err := r.DeleteContainer(handle); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// attachInput writes the input to the stdin of the container through the
+// attach socket.
+func attachInput(t *testing.T, handle *container.Handle, input string) {
+	t.Helper()
+	conn, err := net.DialUnix("unixpacket", nil, &net.UnixAddr{Name: handle.AttachFile(), Net: "unixpacket"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(input)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitLogLines waits until the log file has n lines, and returns them.
+func waitLogLines(t *testing.T, file string, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		b, _ := os.ReadFile(file)
+		lines := strings.SplitAfter(string(b), "\n")
+		lines = lines[:len(lines)-1]
+		if len(lines) >= n || time.Now().After(deadline) {
+			if len(lines) != n {
+				t.Fatalf("[%s] has lines %q, want %d", file, lines, n)
+			}
+			return lines
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestShimReopenLog(t *testing.T) {
+	r, handle := newShimTest(t, ShimOptions{}, "exec cat")
+	if _, err := r.CreateContainer(handle, true, false, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	attachInput(t, handle, "before\n")
+	waitLogLines(t, handle.LogFile(), 1)
+
+	rotated := handle.LogFile() + ".rotated"
+	if err := os.Rename(handle.LogFile(), rotated); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := shim.Dial(ctx, r.shim.RunDir, handle.Id().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if err := client.ReopenLog(ctx); err != nil {
+		t.Fatal(err)
+	}
+	attachInput(t, handle, "after\n")
+
+	if lines := waitLogLines(t, handle.LogFile(), 1); !strings.HasSuffix(lines[0], " F after\n") {
+		t.Errorf("log = %q, want after", lines)
+	}
+	if lines := waitLogLines(t, rotated, 1); !strings.HasSuffix(lines[0], " F before\n") {
+		t.Errorf("rotated log = %q, want before", lines)
+	}
+	if err := r.Kill(handle, syscall.SIGKILL, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.DeleteContainer(handle); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestShimRotateLog(t *testing.T) {
+	// a line of the log is over 30 bytes, so each is in a file of its own
+	r, handle := newShimTest(t, ShimOptions{LogMaxSize: 30, LogMaxFiles: 2},
+		"echo line0; echo line1; echo line2; echo line3")
+	if _, err := r.CreateContainer(handle, false, false, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	waitFile(t, handle.ExitFile())
+
+	for i, file := range []string{handle.LogFile(), handle.LogFile() + ".1", handle.LogFile() + ".2"} {
+		want := fmt.Sprintf(" F line%d\n", 3-i)
+		if lines := waitLogLines(t, file, 1); !strings.HasSuffix(lines[0], want) {
+			t.Errorf("%s = %q, want %q", filepath.Base(file), lines, want)
+		}
+	}
+	if _, err := os.Stat(handle.LogFile() + ".3"); !os.IsNotExist(err) {
+		t.Error("log over max files is kept")
+	}
+	if err := r.DeleteContainer(handle); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestShimNotRunning(t *testing.T) {
+	// runc records that it is called, which it must not be
+	r, handle := newFakeRunc(t, "touch \"$(dirname \"$0\")/called\"\n")
+	if err := r.Kill(handle, syscall.SIGTERM, false); !errors.Is(err, ErrShimNotRunning) {
+		t.Errorf("container without shim is killed, err = %v", err)
+	}
+	// runc does not know the container, so it has exited
+	cont, err := r.Container(handle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cont.Status != container.Stopped {
+		t.Errorf("status of container without shim = %v, want %v", cont.Status, container.Stopped)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(r.runtimePath), "called")); !os.IsNotExist(err) {
+		t.Error("runc is called instead of shim")
+	}
+}
+
+func TestShimSocketInRunDir(t *testing.T) {
+	ctx := context.Background()
+	r1, handle := newShimTest(t, ShimOptions{}, "exec sleep 60")
+	if _, err := r1.CreateContainer(handle, false, false, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	addr, err := shim.ShimAddr(ctx, r1.shim.RunDir, handle.Id().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(shim.SocketPath(addr), r1.shim.RunDir+"/s/") {
+		t.Errorf("socket [%s] is not in run dir [%s]", shim.SocketPath(addr), r1.shim.RunDir)
+	}
+	if _, err := os.Stat(shim.SocketPath(addr)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the shim of the same container id of another manager is not reached
+	r2 := NewRuncRuntime(ShimOptions{RunDir: t.TempDir()}, r1.runtimePath, r1.rootPath, false)
+	if err := r2.Kill(handle, syscall.SIGTERM, false); !errors.Is(err, ErrShimNotRunning) {
+		t.Errorf("shim in another run dir is dialed, err = %v", err)
+	}
+	if _, err := r1.Container(handle); err != nil {
+		t.Fatal(err)
+	}
+	if err := r1.Kill(handle, syscall.SIGKILL, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := r1.DeleteContainer(handle); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,19 +1,94 @@
 package oci
 
 import (
-	"bufio"
 	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"simpleconman/pkg/container"
+	"strconv"
+	"strings"
+	"syscall"
 
+	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/opencontainers/runtime-tools/generate"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
 )
 
+// StopSignalAnnotation is the OCI image annotation which holds the signal
+// used to stop the container.
+const StopSignalAnnotation = "org.opencontainers.image.stopSignal"
+
 type RuntimeSpec []byte
 
+// ImageConfig is the part of the OCI image config which gives defaults to the
+// container process.
+type ImageConfig struct {
+	User       string
+	Env        []string
+	Entrypoint []string
+	Cmd        []string
+	WorkingDir string
+	StopSignal string
+}
+
+// User is the user the container process runs as. Username is looked up in
+// the rootfs. Uid and Gid override what the lookup finds.
+type User struct {
+	Uid                *int64
+	Gid                *int64
+	Username           string
+	SupplementalGroups []int64
+}
+
 type SpecOptions struct {
-	Command      []string
-	Args         []string
+	Command []string
+	Args    []string
+	// Envs are in the form of KEY=VALUE
+	Envs         []string
+	WorkingDir   string
+	User         User
+	Hostname     string
+	Terminal     bool
 	RootPath     string
 	RootReadonly bool
+	// Image gives defaults to what is not specified in the options
+	Image *ImageConfig
+
+	Mounts []container.Mount
+	Pod    PodMounts
+	// ShmSize is the size of /dev/shm in bytes unless the pod sandbox
+	// shares it
+	ShmSize int64
+	// ProcessLabel and MountLabel are the SELinux labels of the process and
+	// of the mounts which are relabeled
+	ProcessLabel string
+	MountLabel   string
+
+	Privileged       bool
+	NoNewPrivileges  bool
+	AddCapabilities  []string
+	DropCapabilities []string
+	// MaskedPaths and ReadonlyPaths are used as they are, so nothing is
+	// masked if empty. Privileged container has none of them.
+	MaskedPaths   []string
+	ReadonlyPaths []string
+
+	Seccomp  SecurityProfile
+	Apparmor SecurityProfile
+	// SeccompProfileRoot is the dir of the Localhost seccomp profiles whose
+	// paths are relative
+	SeccompProfileRoot string
+
+	// CgroupsPath is the cgroup of the container in the form of the cgroup
+	// driver in use
+	CgroupsPath string
+	Resources   *Resources
+	OOMScoreAdj int64
+
+	// Namespaces are joined by the container, which are the ones of the pod
+	// sandbox usually
+	Namespaces []Namespace
 }
 
 func NewSpec(opts SpecOptions) (RuntimeSpec, error) {
@@ -21,15 +96,181 @@ func NewSpec(opts SpecOptions) (RuntimeSpec, error) {
 	if err != nil {
 		return nil, err
 	}
+	image := opts.Image
+	if image == nil {
+		image = &ImageConfig{}
+	}
+
 	gen.HostSpecific = true
 	gen.SetRootPath(opts.RootPath)
 	gen.SetRootReadonly(opts.RootReadonly)
-	gen.SetProcessArgs(append(opts.Command, opts.Args...))
+
+	args, err := processArgs(opts.Command, opts.Args, image)
+	if err != nil {
+		return nil, err
+	}
+	gen.SetProcessArgs(args)
+	gen.SetProcessTerminal(opts.Terminal)
+
+	// container envs override image envs, which override the defaults
+	for _, env := range append(append([]string{}, image.Env...), opts.Envs...) {
+		parts := strings.SplitN(env, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errors.Errorf("invalid env [%s]", env)
+		}
+		gen.AddProcessEnv(parts[0], parts[1])
+	}
+
+	if opts.Hostname != "" {
+		gen.SetHostname(opts.Hostname)
+		gen.AddProcessEnv("HOSTNAME", opts.Hostname)
+	}
+
+	cwd := opts.WorkingDir
+	if cwd == "" {
+		cwd = image.WorkingDir
+	}
+	if cwd == "" {
+		cwd = "/"
+	}
+	gen.SetProcessCwd(cwd)
+
+	user, err := resolveUser(opts.RootPath, opts.User, image.User)
+	if err != nil {
+		return nil, err
+	}
+	gen.SetProcessUID(user.uid)
+	gen.SetProcessGID(user.gid)
+	gen.ClearProcessAdditionalGids()
+	for _, gid := range user.additionalGids {
+		gen.AddProcessAdditionalGid(gid)
+	}
+
+	if err := setupMounts(&gen, opts); err != nil {
+		return nil, err
+	}
+	if err := setupSecurity(&gen, opts); err != nil {
+		return nil, err
+	}
+	if err := setupProfiles(&gen, opts); err != nil {
+		return nil, err
+	}
+	if err := setupResources(&gen, opts); err != nil {
+		return nil, err
+	}
+	if err := setupNamespaces(&gen, opts); err != nil {
+		return nil, err
+	}
+	if opts.ProcessLabel != "" {
+		gen.SetProcessSelinuxLabel(opts.ProcessLabel)
+	}
+	if opts.MountLabel != "" {
+		gen.SetLinuxMountLabel(opts.MountLabel)
+	}
+
+	if image.StopSignal != "" {
+		gen.AddAnnotation(StopSignalAnnotation, image.StopSignal)
+	}
 
 	var buf bytes.Buffer
 	exportOpts := generate.ExportOptions{}
-	if err := gen.Save(bufio.NewWriter(&buf), exportOpts); err != nil {
+	if err := gen.Save(&buf, exportOpts); err != nil {
 		return nil, err
 	}
 	return buf.Bytes(), nil
 }
+
+// processArgs merges the command with the image config. Command overrides
+// the entrypoint and args override the cmd of the image. If the command is
+// given, the cmd of the image is ignored as well.
+func processArgs(command, args []string, image *ImageConfig) ([]string, error) {
+	entrypoint, cmd := command, args
+	if len(entrypoint) == 0 {
+		entrypoint = image.Entrypoint
+		if len(cmd) == 0 {
+			cmd = image.Cmd
+		}
+	}
+	result := append(append([]string{}, entrypoint...), cmd...)
+	if len(result) == 0 {
+		return nil, errors.New("no command specified")
+	}
+	return result, nil
+}
+
+// StopSignal returns the stop signal recorded in the runtime spec file.
+// SIGTERM is returned if there is none.
+func StopSignal(specFile string) (syscall.Signal, error) {
+	spec, err := readSpec(specFile)
+	if err != nil {
+		return 0, err
+	}
+	value, ok := spec.Annotations[StopSignalAnnotation]
+	if !ok || value == "" {
+		return unix.SIGTERM, nil
+	}
+	return ParseSignal(value)
+}
+
+// ExecProcess returns the process to exec in the container. It runs args
+// with the env, user, cwd and security settings of the container process.
+func ExecProcess(specFile string, args []string, terminal bool) (*specs.Process, error) {
+	if len(args) == 0 {
+		return nil, errors.New("no command specified")
+	}
+	spec, err := readSpec(specFile)
+	if err != nil {
+		return nil, err
+	}
+	if spec.Process == nil {
+		return nil, errors.New("OCI runtime spec has no process")
+	}
+	process := *spec.Process
+	process.Args = args
+	process.Terminal = terminal
+	process.ConsoleSize = nil
+	return &process, nil
+}
+
+// CgroupsPath returns the cgroups path of the OCI runtime spec file.
+func CgroupsPath(specFile string) (string, error) {
+	spec, err := readSpec(specFile)
+	if err != nil {
+		return "", err
+	}
+	if spec.Linux == nil || spec.Linux.CgroupsPath == "" {
+		return "", errors.New("OCI runtime spec has no cgroups path")
+	}
+	return spec.Linux.CgroupsPath, nil
+}
+
+func readSpec(specFile string) (*specs.Spec, error) {
+	b, err := ioutil.ReadFile(specFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read OCI runtime spec file")
+	}
+	spec := &specs.Spec{}
+	if err := json.Unmarshal(b, spec); err != nil {
+		return nil, errors.Wrap(err, "cannot decode OCI runtime spec file")
+	}
+	return spec, nil
+}
+
+// ParseSignal parses signal in the forms of "SIGTERM", "TERM" or "15".
+func ParseSignal(value string) (syscall.Signal, error) {
+	if n, err := strconv.Atoi(value); err == nil {
+		if n <= 0 {
+			return 0, errors.Errorf("invalid signal: %s", value)
+		}
+		return syscall.Signal(n), nil
+	}
+	name := strings.ToUpper(value)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	sig := unix.SignalNum(name)
+	if sig == 0 {
+		return 0, errors.Errorf("unknown signal: %s", value)
+	}
+	return sig, nil
+}
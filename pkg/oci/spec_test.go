@@ -0,0 +1,236 @@
+package oci
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// newTestRootfs returns the rootfs with /etc/passwd and /etc/group.
+func newTestRootfs(t *testing.T) string {
+	t.Helper()
+	rootfs := t.TempDir()
+	files := map[string]string{
+		"etc/passwd": "root:x:0:0:root:/root:/bin/sh\n" +
+			"# comment\n" +
+			"app:x:1000:1000::/home/app:/bin/sh\n" +
+			"nobody:x:65534:65534::/:/sbin/nologin\n",
+		"etc/group": "root:x:0:\n" +
+			"app:x:1000:\n" +
+			"audio:x:29:app\n" +
+			"video:x:44:app,nobody\n",
+	}
+	for name, content := range files {
+		file := filepath.Join(rootfs, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rootfs
+}
+
+func newTestSpec(t *testing.T, opts SpecOptions) *specs.Spec {
+	t.Helper()
+	if opts.RootPath == "" {
+		opts.RootPath = newTestRootfs(t)
+	}
+	if len(opts.Command) == 0 && opts.Image == nil {
+		opts.Command = []string{"/bin/sh"}
+	}
+	b, err := NewSpec(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := &specs.Spec{}
+	if err := json.Unmarshal(b, spec); err != nil {
+		t.Fatal(err)
+	}
+	return spec
+}
+
+func envValue(env []string, key string) (string, bool) {
+	for _, kv := range env {
+		if strings.HasPrefix(kv, key+"=") {
+			return strings.TrimPrefix(kv, key+"="), true
+		}
+	}
+	return "", false
+}
+
+func TestProcessArgs(t *testing.T) {
+	image := &ImageConfig{Entrypoint: []string{"/entry"}, Cmd: []string{"default"}}
+	tests := []struct {
+		name    string
+		command []string
+		args    []string
+		image   *ImageConfig
+		want    []string
+	}{
+		{"image", nil, nil, image, []string{"/entry", "default"}},
+		{"args override cmd", nil, []string{"arg"}, image, []string{"/entry", "arg"}},
+		{"command ignores cmd", []string{"/cmd"}, nil, image, []string{"/cmd"}},
+		{"command and args", []string{"/cmd"}, []string{"arg"}, image, []string{"/cmd", "arg"}},
+		{"args only", nil, []string{"/bin/ls", "-l"}, &ImageConfig{}, []string{"/bin/ls", "-l"}},
+		{"nothing", nil, nil, &ImageConfig{}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := processArgs(tt.command, tt.args, tt.image)
+			if tt.want == nil {
+				if err == nil {
+					t.Errorf("processArgs() = %v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("processArgs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewSpecProcess(t *testing.T) {
+	spec := newTestSpec(t, SpecOptions{
+		Envs:     []string{"FOO=container", "EMPTY=", "WITH_EQ=a=b"},
+		Hostname: "pod",
+		Terminal: true,
+		Image: &ImageConfig{
+			Entrypoint: []string{"/entry"},
+			Env:        []string{"FOO=image", "BAR=image"},
+			WorkingDir: "/image",
+			StopSignal: "SIGQUIT",
+		},
+	})
+	if got := strings.Join(spec.Process.Args, " "); got != "/entry" {
+		t.Errorf("args = %s", got)
+	}
+	wantEnvs := map[string]string{
+		"FOO":      "container",
+		"BAR":      "image",
+		"EMPTY":    "",
+		"WITH_EQ":  "a=b",
+		"HOSTNAME": "pod",
+	}
+	for key, want := range wantEnvs {
+		if got, ok := envValue(spec.Process.Env, key); !ok || got != want {
+			t.Errorf("env %s = %q (set %v), want %q", key, got, ok, want)
+		}
+	}
+	if _, ok := envValue(spec.Process.Env, "PATH"); !ok {
+		t.Error("default PATH is not set")
+	}
+	if spec.Process.Cwd != "/image" {
+		t.Errorf("cwd = %s, want the one of image", spec.Process.Cwd)
+	}
+	if spec.Hostname != "pod" {
+		t.Errorf("hostname = %s", spec.Hostname)
+	}
+	if !spec.Process.Terminal {
+		t.Error("terminal is not set")
+	}
+	if got := spec.Annotations[StopSignalAnnotation]; got != "SIGQUIT" {
+		t.Errorf("stop signal annotation = %s", got)
+	}
+}
+
+func TestNewSpecWorkingDir(t *testing.T) {
+	tests := []struct {
+		name       string
+		workingDir string
+		image      string
+		want       string
+	}{
+		{"default", "", "", "/"},
+		{"image", "", "/image", "/image"},
+		{"container", "/app", "/image", "/app"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := newTestSpec(t, SpecOptions{
+				Command:    []string{"/bin/sh"},
+				WorkingDir: tt.workingDir,
+				Image:      &ImageConfig{WorkingDir: tt.image},
+			})
+			if spec.Process.Cwd != tt.want {
+				t.Errorf("cwd = %s, want %s", spec.Process.Cwd, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewSpecInvalidEnv(t *testing.T) {
+	for _, env := range []string{"NOVALUE", "=value"} {
+		_, err := NewSpec(SpecOptions{
+			Command:  []string{"/bin/sh"},
+			Envs:     []string{env},
+			RootPath: t.TempDir(),
+		})
+		if err == nil {
+			t.Errorf("env [%s] is accepted", env)
+		}
+	}
+}
+
+func TestParseSignal(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    syscall.Signal
+		wantErr bool
+	}{
+		{"SIGTERM", syscall.SIGTERM, false},
+		{"TERM", syscall.SIGTERM, false},
+		{"sigkill", syscall.SIGKILL, false},
+		{"9", syscall.SIGKILL, false},
+		{"0", 0, true},
+		{"-1", 0, true},
+		{"SIGNOPE", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSignal(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseSignal(%s) = %v, %v, want %v, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestStopSignal(t *testing.T) {
+	dir := t.TempDir()
+	for _, tt := range []struct {
+		image string
+		want  syscall.Signal
+	}{
+		{"", syscall.SIGTERM},
+		{"SIGINT", syscall.SIGINT},
+	} {
+		b, err := NewSpec(SpecOptions{
+			Command:  []string{"/bin/sh"},
+			RootPath: dir,
+			Image:    &ImageConfig{StopSignal: tt.image},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		file := filepath.Join(dir, "config.json")
+		if err := os.WriteFile(file, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := StopSignal(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("stop signal of image [%s] = %v, want %v", tt.image, got, tt.want)
+		}
+	}
+}
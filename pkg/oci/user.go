@@ -0,0 +1,186 @@
+package oci
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type processUser struct {
+	uid            uint32
+	gid            uint32
+	additionalGids []uint32
+}
+
+type passwdEntry struct {
+	name string
+	uid  uint32
+	gid  uint32
+}
+
+type groupEntry struct {
+	name    string
+	gid     uint32
+	members []string
+}
+
+// resolveUser resolves the user of the container process. User given by the
+// options takes precedence over the user of the image, which is in the forms
+// of "user", "uid", "user:group" or "uid:gid". Names are looked up in
+// /etc/passwd and /etc/group of the rootfs.
+func resolveUser(rootfs string, opts User, imageUser string) (*processUser, error) {
+	result := &processUser{}
+	var (
+		username string
+		group    string
+	)
+	switch {
+	case opts.Username != "":
+		username = opts.Username
+	case opts.Uid != nil:
+		username = strconv.FormatInt(*opts.Uid, 10)
+	default:
+		parts := strings.SplitN(imageUser, ":", 2)
+		username = parts[0]
+		if len(parts) == 2 {
+			group = parts[1]
+		}
+	}
+
+	var entry *passwdEntry
+	if username != "" {
+		entries, err := readPasswd(rootfs)
+		if err != nil {
+			return nil, err
+		}
+		entry = lookupPasswd(entries, username)
+		if entry == nil {
+			uid, err := strconv.ParseUint(username, 10, 32)
+			if err != nil {
+				return nil, errors.Errorf("cannot find user [%s] in the rootfs", username)
+			}
+			// numeric uid does not need to exist in /etc/passwd
+			entry = &passwdEntry{uid: uint32(uid)}
+		}
+		result.uid = entry.uid
+		result.gid = entry.gid
+	}
+
+	groups, err := readGroup(rootfs)
+	if err != nil {
+		return nil, err
+	}
+	if group != "" {
+		g := lookupGroup(groups, group)
+		if g == nil {
+			gid, err := strconv.ParseUint(group, 10, 32)
+			if err != nil {
+				return nil, errors.Errorf("cannot find group [%s] in the rootfs", group)
+			}
+			g = &groupEntry{gid: uint32(gid)}
+		}
+		result.gid = g.gid
+	}
+	if opts.Gid != nil {
+		result.gid = uint32(*opts.Gid)
+	}
+
+	if entry != nil && entry.name != "" {
+		for _, g := range groups {
+			for _, member := range g.members {
+				if member == entry.name && g.gid != result.gid {
+					result.additionalGids = append(result.additionalGids, g.gid)
+				}
+			}
+		}
+	}
+	for _, gid := range opts.SupplementalGroups {
+		result.additionalGids = append(result.additionalGids, uint32(gid))
+	}
+	return result, nil
+}
+
+func lookupPasswd(entries []passwdEntry, user string) *passwdEntry {
+	for i := range entries {
+		if entries[i].name == user || strconv.FormatUint(uint64(entries[i].uid), 10) == user {
+			return &entries[i]
+		}
+	}
+	return nil
+}
+
+func lookupGroup(entries []groupEntry, group string) *groupEntry {
+	for i := range entries {
+		if entries[i].name == group || strconv.FormatUint(uint64(entries[i].gid), 10) == group {
+			return &entries[i]
+		}
+	}
+	return nil
+}
+
+// readPasswd reads /etc/passwd of the rootfs. Missing file is read as empty.
+func readPasswd(rootfs string) ([]passwdEntry, error) {
+	var result []passwdEntry
+	err := readColonFile(filepath.Join(rootfs, "etc", "passwd"), func(fields []string) {
+		// name:password:uid:gid:gecos:home:shell
+		if len(fields) < 4 {
+			return
+		}
+		uid, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			return
+		}
+		gid, err := strconv.ParseUint(fields[3], 10, 32)
+		if err != nil {
+			return
+		}
+		result = append(result, passwdEntry{name: fields[0], uid: uint32(uid), gid: uint32(gid)})
+	})
+	return result, err
+}
+
+// readGroup reads /etc/group of the rootfs. Missing file is read as empty.
+func readGroup(rootfs string) ([]groupEntry, error) {
+	var result []groupEntry
+	err := readColonFile(filepath.Join(rootfs, "etc", "group"), func(fields []string) {
+		// name:password:gid:members
+		if len(fields) < 3 {
+			return
+		}
+		gid, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			return
+		}
+		entry := groupEntry{name: fields[0], gid: uint32(gid)}
+		if len(fields) > 3 && fields[3] != "" {
+			entry.members = strings.Split(fields[3], ",")
+		}
+		result = append(result, entry)
+	})
+	return result, err
+}
+
+func readColonFile(file string, fn func(fields []string)) error {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "cannot open [%s]", file)
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fn(strings.Split(line, ":"))
+	}
+	return sc.Err()
+}
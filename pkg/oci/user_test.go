@@ -0,0 +1,64 @@
+package oci
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestResolveUser(t *testing.T) {
+	rootfs := newTestRootfs(t)
+	id := func(v int64) *int64 {
+		return &v
+	}
+	tests := []struct {
+		name      string
+		opts      User
+		imageUser string
+		want      string
+		wantErr   bool
+	}{
+		{"default", User{}, "", "0:0 []", false},
+		{"image user name", User{}, "app", "1000:1000 [29 44]", false},
+		{"image uid", User{}, "1000", "1000:1000 [29 44]", false},
+		{"image user and group", User{}, "app:audio", "1000:29 [44]", false},
+		{"image numeric ids", User{}, "2000:3000", "2000:3000 []", false},
+		{"image unknown user", User{}, "ghost", "", true},
+		{"image unknown group", User{}, "app:ghost", "", true},
+		{"username overrides image", User{Username: "nobody"}, "app", "65534:65534 [44]", false},
+		{"uid overrides image", User{Uid: id(1000)}, "nobody", "1000:1000 [29 44]", false},
+		{"unknown uid", User{Uid: id(1234)}, "", "1234:0 []", false},
+		{"gid overrides", User{Uid: id(1000), Gid: id(5)}, "", "1000:5 [29 44]", false},
+		{"supplemental groups", User{Uid: id(0), SupplementalGroups: []int64{10, 20}}, "", "0:0 [10 20]", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := resolveUser(rootfs, tt.opts, tt.imageUser)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("resolveUser() = %+v, want error", user)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			gids := user.additionalGids
+			if gids == nil {
+				gids = []uint32{}
+			}
+			if got := fmt.Sprintf("%d:%d %v", user.uid, user.gid, gids); got != tt.want {
+				t.Errorf("resolveUser() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveUserWithoutEtc(t *testing.T) {
+	user, err := resolveUser(t.TempDir(), User{}, "1000:1000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.uid != 1000 || user.gid != 1000 {
+		t.Errorf("user = %+v", user)
+	}
+}
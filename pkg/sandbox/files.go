@@ -0,0 +1,146 @@
+package sandbox
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"simpleconman/pkg/oci"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// shmSize is the size of /dev/shm shared by the containers of the sandbox
+const shmSize = 64 * 1024 * 1024
+
+const defaultHosts = `127.0.0.1	localhost
+::1	localhost ip6-localhost ip6-loopback
+fe00::0	ip6-localnet
+ff00::0	ip6-mcastprefix
+ff02::1	ip6-allnodes
+ff02::2	ip6-allrouters
+`
+
+// DNSConfig is written into resolv.conf of the sandbox. If it is nil, the one
+// of the host is used.
+type DNSConfig struct {
+	Servers  []string `json:"servers,omitempty"`
+	Searches []string `json:"searches,omitempty"`
+	Options  []string `json:"options,omitempty"`
+}
+
+func (h *Handle) ShmDir() string {
+	return path.Join(h.BaseDir(), "shm")
+}
+
+func (h *Handle) HostsFile() string {
+	return path.Join(h.BaseDir(), "hosts")
+}
+
+func (h *Handle) ResolvConfFile() string {
+	return path.Join(h.BaseDir(), "resolv.conf")
+}
+
+func (h *Handle) HostnameFile() string {
+	return path.Join(h.BaseDir(), "hostname")
+}
+
+// PodMounts returns the files and dirs shared by the containers of the
+// sandbox. Sandbox in the IPC namespace of the host shares /dev/shm of the
+// host.
+func (h *Handle) PodMounts() oci.PodMounts {
+	shmPath := h.ShmDir()
+	if h.metadata.Namespaces.Ipc == NodeNamespace {
+		shmPath = "/dev/shm"
+	}
+	return oci.PodMounts{
+		ShmPath:        shmPath,
+		HostsPath:      h.HostsFile(),
+		ResolvConfPath: h.ResolvConfFile(),
+		HostnamePath:   h.HostnameFile(),
+	}
+}
+
+// SetupFiles writes hosts, resolv.conf and hostname files, and mounts shm of
+// the sandbox by its metadata. Sandbox in the network namespace of the host
+// has the hosts file and the hostname of the host.
+func (h *Handle) SetupFiles() error {
+	hostNetwork := h.metadata.Namespaces.Network == NodeNamespace
+	hosts := []byte(defaultHosts)
+	if hostNetwork {
+		b, err := ioutil.ReadFile("/etc/hosts")
+		if err != nil {
+			return errors.Wrap(err, "cannot read hosts file of host")
+		}
+		hosts = b
+	}
+	if err := ioutil.WriteFile(h.HostsFile(), hosts, 0644); err != nil {
+		return errors.Wrap(err, "cannot write hosts file")
+	}
+	if err := h.writeResolvConf(); err != nil {
+		return err
+	}
+	hostname := h.metadata.Hostname
+	if hostname == "" || hostNetwork {
+		var err error
+		if hostname, err = os.Hostname(); err != nil {
+			return errors.Wrap(err, "cannot get hostname")
+		}
+	}
+	if err := ioutil.WriteFile(h.HostnameFile(), []byte(hostname+"\n"), 0644); err != nil {
+		return errors.Wrap(err, "cannot write hostname file")
+	}
+
+	if h.metadata.Namespaces.Ipc == NodeNamespace {
+		return nil
+	}
+	if err := os.MkdirAll(h.ShmDir(), 0700); err != nil {
+		return errors.Wrap(err, "cannot create shm dir")
+	}
+	opts := fmt.Sprintf("mode=1777,size=%d", shmSize)
+	if err := unix.Mount("shm", h.ShmDir(), "tmpfs",
+		unix.MS_NOEXEC|unix.MS_NOSUID|unix.MS_NODEV, opts); err != nil {
+		return errors.Wrap(err, "cannot mount shm")
+	}
+	return nil
+}
+
+func (h *Handle) writeResolvConf() error {
+	dns := h.metadata.DNS
+	if dns == nil {
+		b, err := ioutil.ReadFile("/etc/resolv.conf")
+		if err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "cannot read resolv.conf of host")
+		}
+		if err := ioutil.WriteFile(h.ResolvConfFile(), b, 0644); err != nil {
+			return errors.Wrap(err, "cannot write resolv.conf")
+		}
+		return nil
+	}
+
+	var b strings.Builder
+	for _, server := range dns.Servers {
+		fmt.Fprintf(&b, "nameserver %s\n", server)
+	}
+	if len(dns.Searches) > 0 {
+		fmt.Fprintf(&b, "search %s\n", strings.Join(dns.Searches, " "))
+	}
+	if len(dns.Options) > 0 {
+		fmt.Fprintf(&b, "options %s\n", strings.Join(dns.Options, " "))
+	}
+	if err := ioutil.WriteFile(h.ResolvConfFile(), []byte(b.String()), 0644); err != nil {
+		return errors.Wrap(err, "cannot write resolv.conf")
+	}
+	return nil
+}
+
+// UnmountShm unmounts shm of the sandbox. Unmounting twice is not an error.
+func (h *Handle) UnmountShm() error {
+	err := unix.Unmount(h.ShmDir(), unix.MNT_DETACH)
+	if err == nil || err == unix.EINVAL || err == unix.ENOENT {
+		return nil
+	}
+	return errors.Wrap(err, "cannot unmount shm")
+}
@@ -0,0 +1,77 @@
+package sandbox
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path"
+	"simpleconman/pkg/fsutil"
+
+	"github.com/pkg/errors"
+)
+
+// metadataVersion is bumped whenever Metadata changes incompatibly, so the
+// record written by older manager is not misread.
+const metadataVersion = 1
+
+// Metadata is what the sandbox is created with. It is kept in MetadataFile()
+// to list, inspect and recover the sandbox later.
+type Metadata struct {
+	Name           string            `json:"name"`
+	Uid            string            `json:"uid"`
+	Namespace      string            `json:"namespace"`
+	Attempt        uint32            `json:"attempt"`
+	Hostname       string            `json:"hostname,omitempty"`
+	LogDirectory   string            `json:"logDirectory,omitempty"`
+	CgroupParent   string            `json:"cgroupParent,omitempty"`
+	RuntimeHandler string            `json:"runtimeHandler,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	Annotations    map[string]string `json:"annotations,omitempty"`
+	DNS            *DNSConfig        `json:"dns,omitempty"`
+	Namespaces     NamespaceOptions  `json:"namespaces"`
+}
+
+type metadataRecord struct {
+	Version  int      `json:"version"`
+	Metadata Metadata `json:"metadata"`
+}
+
+func (h *Handle) MetadataFile() string {
+	return path.Join(h.BaseDir(), "metadata.json")
+}
+
+func (h *Handle) Metadata() Metadata {
+	return h.metadata
+}
+
+// SetMetadata records the metadata in MetadataFile().
+func (h *Handle) SetMetadata(metadata Metadata) error {
+	b, err := json.Marshal(&metadataRecord{
+		Version:  metadataVersion,
+		Metadata: metadata,
+	})
+	if err != nil {
+		return errors.Wrap(err, "cannot encode metadata")
+	}
+	if err := fsutil.WriteFileAtomic(h.MetadataFile(), b, 0600); err != nil {
+		return errors.Wrap(err, "cannot write metadata")
+	}
+	h.metadata = metadata
+	return nil
+}
+
+// LoadMetadata reads the metadata recorded in MetadataFile().
+func (h *Handle) LoadMetadata() error {
+	b, err := ioutil.ReadFile(h.MetadataFile())
+	if err != nil {
+		return errors.Wrap(err, "cannot read metadata file")
+	}
+	record := &metadataRecord{}
+	if err := json.Unmarshal(b, record); err != nil {
+		return errors.Wrap(err, "cannot decode metadata file")
+	}
+	if record.Version != metadataVersion {
+		return errors.Errorf("unsupported metadata version [%d]", record.Version)
+	}
+	h.metadata = record.Metadata
+	return nil
+}
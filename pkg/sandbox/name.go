@@ -0,0 +1,20 @@
+package sandbox
+
+import (
+	"fmt"
+	"simpleconman/pkg/store"
+)
+
+// FullName is the name of the sandbox unique in the node. Kubelet creates
+// sandbox with the same pod and attempt only once.
+func (m Metadata) FullName() string {
+	return fmt.Sprintf("%s_%s_%s_%d", m.Name, m.Namespace, m.Uid, m.Attempt)
+}
+
+// NameIndex reserves names for sandboxes so that no two sandboxes share a
+// name.
+type NameIndex = store.NameIndex[Id]
+
+func NewNameIndex() *NameIndex {
+	return store.NewNameIndex[Id]("sandbox")
+}
@@ -0,0 +1,28 @@
+package sandbox
+
+import "testing"
+
+func TestFullName(t *testing.T) {
+	m := Metadata{Name: "web", Namespace: "default", Uid: "uid1", Attempt: 1}
+	if got, want := m.FullName(), "web_default_uid1_1"; got != want {
+		t.Errorf("FullName() = %s, want %s", got, want)
+	}
+}
+
+func TestNameIndex(t *testing.T) {
+	names := NewNameIndex()
+	if err := names.Reserve("web", "s1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := names.Reserve("web", "s2"); err == nil {
+		t.Fatal("name is reserved twice")
+	}
+	names.Release("web", "s2")
+	if err := names.Reserve("web", "s2"); err == nil {
+		t.Fatal("name is released by other sandbox")
+	}
+	names.Release("web", "s1")
+	if err := names.Reserve("web", "s2"); err != nil {
+		t.Fatal(err)
+	}
+}
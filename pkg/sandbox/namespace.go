@@ -0,0 +1,51 @@
+package sandbox
+
+import "fmt"
+
+// NamespaceMode tells whose namespace the containers of the sandbox use.
+type NamespaceMode uint32
+
+const (
+	// PodNamespace is the namespace of the pause container shared by the
+	// containers of the sandbox
+	PodNamespace NamespaceMode = iota
+	// ContainerNamespace is the namespace of each container
+	ContainerNamespace
+	// NodeNamespace is the namespace of the host
+	NodeNamespace
+	// TargetNamespace is the namespace of another container in the sandbox
+	TargetNamespace
+)
+
+var namespaceModeValue = []string{
+	"pod",
+	"container",
+	"node",
+	"target",
+}
+
+func (m NamespaceMode) String() string {
+	return namespaceModeValue[m]
+}
+
+func (m NamespaceMode) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *NamespaceMode) UnmarshalText(b []byte) error {
+	for i, v := range namespaceModeValue {
+		if v == string(b) {
+			*m = NamespaceMode(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown namespace mode: %s", string(b))
+}
+
+// NamespaceOptions are the namespace modes of the sandbox. UTS namespace
+// follows the network one.
+type NamespaceOptions struct {
+	Network NamespaceMode `json:"network"`
+	Pid     NamespaceMode `json:"pid"`
+	Ipc     NamespaceMode `json:"ipc"`
+}
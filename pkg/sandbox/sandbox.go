@@ -0,0 +1,241 @@
+package sandbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"simpleconman/pkg/container"
+	"simpleconman/pkg/fsutil"
+	"simpleconman/pkg/oci"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+type Status uint32
+
+const (
+	Initial Status = iota
+	Ready
+	NotReady
+)
+
+var statusValue = []string{
+	"initial",
+	"ready",
+	"notready",
+}
+
+func (s Status) String() string {
+	return statusValue[s]
+}
+
+func (s Status) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Status) UnmarshalText(b []byte) error {
+	for i, v := range statusValue {
+		if v == string(b) {
+			*s = Status(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown status: %s", string(b))
+}
+
+type Id string
+
+func (id Id) String() string {
+	return string(id)
+}
+
+func GenId() Id {
+	return Id(strings.ReplaceAll(uuid.NewString(), "-", ""))
+}
+
+type BaseDirFn func(id Id) string
+
+// Handle is the pod sandbox. The sandbox holds the namespaces shared by its
+// containers with the pause container, which does nothing but keeps the
+// namespaces alive.
+type Handle struct {
+	id       Id
+	baseDir  string
+	metadata Metadata
+	pause    *container.Handle
+}
+
+// NewHandle creates the base dir of the sandbox. The pause container has the
+// same id as the sandbox, and its attach and exit files are given by the
+// file functions.
+func NewHandle(id Id, fn BaseDirFn, attachFileFn, exitFileFn container.BaseFileFn) (*Handle, error) {
+	baseDir := fn(id)
+
+	ok, err := fsutil.Exists(baseDir)
+	if ok {
+		return nil, errors.New("sandbox directory already exists")
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot access dir")
+	}
+	if err := os.MkdirAll(baseDir, 0700); err != nil {
+		return nil, errors.Wrap(err, "cannot create sandbox dir")
+	}
+
+	h := &Handle{
+		id:      id,
+		baseDir: baseDir,
+	}
+	pause, err := container.NewHandle(nil, h.PauseId(), h.pauseDir, h.pauseLogFile,
+		attachFileFn, exitFileFn)
+	if err != nil {
+		os.RemoveAll(baseDir)
+		return nil, err
+	}
+	h.pause = pause
+	return h, nil
+}
+
+// RestoreHandle returns the handle of the sandbox created before. Metadata
+// is read by LoadMetadata().
+func RestoreHandle(id Id, fn BaseDirFn, attachFileFn, exitFileFn container.BaseFileFn) *Handle {
+	h := &Handle{
+		id:      id,
+		baseDir: fn(id),
+	}
+	h.pause = container.RestoreHandle(h.PauseId(), h.pauseDir, h.pauseLogFile,
+		attachFileFn, exitFileFn)
+	return h
+}
+
+func (h *Handle) Id() Id {
+	return h.id
+}
+
+func (h *Handle) BaseDir() string {
+	return h.baseDir
+}
+
+func (h *Handle) StateFile() string {
+	return path.Join(h.BaseDir(), "state.json")
+}
+
+// PauseId is the id of the pause container, which is the same as the one of
+// the sandbox.
+func (h *Handle) PauseId() container.Id {
+	return container.Id(h.id)
+}
+
+func (h *Handle) Pause() *container.Handle {
+	return h.pause
+}
+
+func (h *Handle) pauseDir(container.Id) string {
+	return path.Join(h.BaseDir(), "pause")
+}
+
+func (h *Handle) pauseLogFile(container.Id) string {
+	return path.Join(h.BaseDir(), "pause.log")
+}
+
+// Remove unmounts shm and removes every file of the sandbox including the
+// ones of the pause container.
+func (h *Handle) Remove() error {
+	if err := h.UnmountShm(); err != nil {
+		return err
+	}
+	if err := h.pause.Remove(); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(h.BaseDir()); err != nil {
+		return errors.Wrap(err, "cannot remove sandbox dir")
+	}
+	return nil
+}
+
+// State is what the manager records about the sandbox lifecycle in
+// StateFile().
+type State struct {
+	Status    Status    `json:"status"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Pid is the pid of the pause container, whose namespaces are joined by
+	// the containers of the sandbox
+	Pid int `json:"pid,omitempty"`
+	// NetNSPath is the network namespace set up by the network manager.
+	// Sandbox in the network namespace of the host or of the pause
+	// container has none.
+	NetNSPath string   `json:"netnsPath,omitempty"`
+	IPs       []string `json:"ips,omitempty"`
+}
+
+// State returns the recorded state. Sandbox which has no state file yet is
+// in Initial status.
+func (h *Handle) State() (*State, error) {
+	b, err := ioutil.ReadFile(h.StateFile())
+	if os.IsNotExist(err) {
+		return &State{Status: Initial}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read state file")
+	}
+	state := &State{}
+	if err := json.Unmarshal(b, state); err != nil {
+		return nil, errors.Wrap(err, "cannot decode state file")
+	}
+	return state, nil
+}
+
+func (h *Handle) writeState(state *State) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return errors.Wrap(err, "cannot encode state")
+	}
+	if err := fsutil.WriteFileAtomic(h.StateFile(), b, 0600); err != nil {
+		return errors.Wrap(err, "cannot write state")
+	}
+	return nil
+}
+
+func (h *Handle) updateState(fn func(state *State)) error {
+	state, err := h.State()
+	if err != nil {
+		return err
+	}
+	fn(state)
+	return h.writeState(state)
+}
+
+// Ready records the sandbox is ready with the pause container of pid.
+func (h *Handle) Ready(pid int) error {
+	return h.updateState(func(state *State) {
+		state.Status = Ready
+		state.CreatedAt = time.Now()
+		state.Pid = pid
+	})
+}
+
+// SetNetwork records the network namespace and the IPs of the sandbox. Empty
+// path means the network is torn down.
+func (h *Handle) SetNetwork(netnsPath string, ips []string) error {
+	return h.updateState(func(state *State) {
+		state.NetNSPath = netnsPath
+		state.IPs = ips
+	})
+}
+
+func (h *Handle) NotReady() error {
+	return h.updateState(func(state *State) {
+		state.Status = NotReady
+	})
+}
+
+// NamespacePath returns the path of the namespace of the pause container,
+// such as "net" and "ipc".
+func (s *State) NamespacePath(ns string) string {
+	return oci.NamespacePath(s.Pid, ns)
+}
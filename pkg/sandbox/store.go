@@ -0,0 +1,83 @@
+package sandbox
+
+import (
+	"errors"
+	"simpleconman/pkg/container"
+	"simpleconman/pkg/store"
+
+	"github.com/sirupsen/logrus"
+)
+
+type Iterator = store.Iterator[*Handle]
+
+var ErrNotFound = errors.New("sandbox not found")
+
+type Store interface {
+	Get(id Id) (*Handle, error)
+	Put(*Handle) error
+	Delete(id Id) error
+	Iter() Iterator
+}
+
+type InMemStore = store.InMemStore[Id, *Handle]
+
+func NewInMemStore() *InMemStore {
+	return store.NewInMemStore[Id, *Handle](ErrNotFound)
+}
+
+// PersistentStore is a store which is rebuilt from the sandbox dirs left by
+// the previous run, so sandboxes survive restarts of the manager.
+type PersistentStore struct {
+	*InMemStore
+
+	// orphans are half-created sandboxes which should be cleaned up
+	orphans []*Handle
+}
+
+// NewPersistentStore scans dir which contains a base dir per sandbox and
+// restores each sandbox from its state and metadata. Sandbox whose pause
+// container is gone is restored as not ready, so that kubelet recreates it.
+func NewPersistentStore(dir string, inspector container.Inspector, fn BaseDirFn,
+	attachFileFn, exitFileFn container.BaseFileFn) (*PersistentStore, error) {
+	s := &PersistentStore{
+		InMemStore: NewInMemStore(),
+	}
+	orphans, err := s.Restore(dir, "sandbox", func(id Id) *Handle {
+		return RestoreHandle(id, fn, attachFileFn, exitFileFn)
+	}, func(handle *Handle) error {
+		return restore(handle, inspector)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.orphans = orphans
+	return s, nil
+}
+
+func restore(handle *Handle, inspector container.Inspector) error {
+	if err := handle.LoadMetadata(); err != nil {
+		return err
+	}
+	state, err := handle.State()
+	if err != nil {
+		return err
+	}
+	// RunPodSandbox did not complete
+	if state.Status == Initial {
+		return errors.New("sandbox is half-created")
+	}
+	if state.Status != Ready {
+		return nil
+	}
+	pause, err := inspector.Container(handle.Pause())
+	if err != nil || pause.Status != container.Running {
+		logrus.WithError(err).Infof("pause container of sandbox [%s] is gone", handle.Id())
+		return handle.NotReady()
+	}
+	return nil
+}
+
+// Orphans returns sandboxes which could not be restored.
+func (s *PersistentStore) Orphans() []*Handle {
+	return s.orphans
+}
@@ -0,0 +1,94 @@
+package sandbox
+
+import (
+	"errors"
+	"path"
+	"simpleconman/pkg/container"
+	"sort"
+	"strings"
+	"testing"
+)
+
+type fakeInspector map[container.Id]*container.Instance
+
+func (i fakeInspector) Container(handle *container.Handle) (*container.Instance, error) {
+	cont, ok := i[handle.Id()]
+	if !ok {
+		return nil, errors.New("container does not exist")
+	}
+	return cont, nil
+}
+
+func TestPersistentStoreRestore(t *testing.T) {
+	dir := t.TempDir()
+	baseDir := func(id Id) string {
+		return path.Join(dir, "sandboxes", id.String())
+	}
+	file := func(id container.Id) string {
+		return path.Join(dir, "files", id.String())
+	}
+	inspector := fakeInspector{
+		"running": {Status: container.Running},
+		"stopped": {Status: container.Stopped},
+	}
+	tests := []struct {
+		id         Id
+		setup      func(h *Handle) error
+		orphan     bool
+		wantStatus Status
+	}{
+		{"running", func(h *Handle) error { return h.Ready(1) }, false, Ready},
+		{"stopped", func(h *Handle) error { return h.Ready(1) }, false, NotReady},
+		{"gone", func(h *Handle) error { return h.Ready(1) }, false, NotReady},
+		{"not-ready", func(h *Handle) error { return h.NotReady() }, false, NotReady},
+		{"half-created", func(h *Handle) error { return nil }, true, Initial},
+	}
+	for _, tt := range tests {
+		handle, err := NewHandle(tt.id, baseDir, file, file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := handle.SetMetadata(Metadata{Name: tt.id.String()}); err != nil {
+			t.Fatal(err)
+		}
+		if err := tt.setup(handle); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store, err := NewPersistentStore(path.Join(dir, "sandboxes"), inspector, baseDir, file, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var orphans []string
+	for _, h := range store.Orphans() {
+		orphans = append(orphans, h.Id().String())
+	}
+	sort.Strings(orphans)
+	if strings.Join(orphans, ",") != "half-created" {
+		t.Errorf("orphans = %v, want [half-created]", orphans)
+	}
+	for _, tt := range tests {
+		handle, err := store.Get(tt.id)
+		if tt.orphan {
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("orphan [%s] is restored", tt.id)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("sandbox [%s] is not restored: %v", tt.id, err)
+			continue
+		}
+		state, err := handle.State()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state.Status != tt.wantStatus {
+			t.Errorf("status of [%s] = %s, want %s", tt.id, state.Status, tt.wantStatus)
+		}
+		if name := handle.Metadata().Name; name != tt.id.String() {
+			t.Errorf("name of [%s] = %s", tt.id, name)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package store
+
+import (
+	"fmt"
+	"sync"
+)
+
+// NameIndex reserves names for the items so that no two items share a name.
+type NameIndex[K ~string] struct {
+	lock  *sync.Mutex
+	names map[string]K
+	// kind names the items in errors
+	kind string
+}
+
+func NewNameIndex[K ~string](kind string) *NameIndex[K] {
+	return &NameIndex[K]{
+		lock:  &sync.Mutex{},
+		names: make(map[string]K),
+		kind:  kind,
+	}
+}
+
+// Reserve reserves the name for the item. Reserving the name again for the
+// same item is not an error.
+func (n *NameIndex[K]) Reserve(name string, id K) error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if owner, ok := n.names[name]; ok && owner != id {
+		return fmt.Errorf("name [%s] is already reserved for %s [%s]", name, n.kind, owner)
+	}
+	n.names[name] = id
+	return nil
+}
+
+// Release releases the name if it is reserved for the item.
+func (n *NameIndex[K]) Release(name string, id K) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if owner, ok := n.names[name]; ok && owner == id {
+		delete(n.names, name)
+	}
+}
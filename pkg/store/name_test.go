@@ -0,0 +1,31 @@
+package store
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNameIndex(t *testing.T) {
+	names := NewNameIndex[testId]("item")
+	tests := []struct {
+		name    string
+		op      func() error
+		wantErr bool
+	}{
+		{"reserve", func() error { return names.Reserve("web", "a") }, false},
+		{"reserve again", func() error { return names.Reserve("web", "a") }, false},
+		{"reserve by other", func() error { return names.Reserve("web", "b") }, true},
+		{"release by other", func() error { names.Release("web", "b"); return names.Reserve("web", "b") }, true},
+		{"release", func() error { names.Release("web", "a"); return names.Reserve("web", "b") }, false},
+		{"release unknown", func() error { names.Release("db", "a"); return nil }, false},
+	}
+	for _, tt := range tests {
+		err := tt.op()
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("%s: err = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+		if err != nil && !strings.Contains(err.Error(), "item [a]") {
+			t.Errorf("%s: error %q does not name the owner", tt.name, err)
+		}
+	}
+}
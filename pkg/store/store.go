@@ -0,0 +1,127 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Item is what the store keeps: a handle of a container or a sandbox.
+type Item[K ~string] interface {
+	Id() K
+}
+
+type Iterator[V any] interface {
+	HasNext() bool
+	Next() V
+}
+
+type defaultIter[V any] struct {
+	curr  int
+	items []V
+}
+
+func (i *defaultIter[V]) HasNext() bool {
+	return i.curr < len(i.items)
+}
+
+func (i *defaultIter[V]) Next() V {
+	if !i.HasNext() {
+		var zero V
+		return zero
+	}
+	result := i.items[i.curr]
+	i.curr += 1
+	return result
+}
+
+type InMemStore[K ~string, V Item[K]] struct {
+	lock  *sync.RWMutex
+	items map[K]V
+	// errNotFound is wrapped in the error of Get of unknown id
+	errNotFound error
+}
+
+func NewInMemStore[K ~string, V Item[K]](errNotFound error) *InMemStore[K, V] {
+	return &InMemStore[K, V]{
+		lock:        &sync.RWMutex{},
+		items:       make(map[K]V),
+		errNotFound: errNotFound,
+	}
+}
+
+func (s *InMemStore[K, V]) Put(item V) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if item.Id() == "" {
+		return errors.New("cannot put handle because id is not defined")
+	}
+	s.items[item.Id()] = item
+	return nil
+}
+
+func (s *InMemStore[K, V]) Get(id K) (V, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	item, ok := s.items[id]
+	if !ok {
+		return item, fmt.Errorf("cannot find handle. id [%s]: %w", id, s.errNotFound)
+	}
+	return item, nil
+}
+
+func (s *InMemStore[K, V]) Delete(id K) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.items, id)
+	return nil
+}
+
+func (s *InMemStore[K, V]) Iter() Iterator[V] {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	items := make([]V, 0, len(s.items))
+	for _, item := range s.items {
+		items = append(items, item)
+	}
+	return &defaultIter[V]{items: items}
+}
+
+// Restore scans dir which contains a base dir per item, and puts each item
+// made by newFn from the dir name into the store once restoreFn succeeds.
+// Items which cannot be restored are returned as orphans. Kind names the
+// items in logs and errors.
+func (s *InMemStore[K, V]) Restore(dir string, kind string, newFn func(id K) V,
+	restoreFn func(item V) error) ([]V, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %ss dir: %w", kind, err)
+	}
+	var orphans []V
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		item := newFn(K(entry.Name()))
+		if err := restoreFn(item); err != nil {
+			logrus.WithError(err).Warnf("cannot restore %s [%s], mark as orphan", kind, item.Id())
+			orphans = append(orphans, item)
+			continue
+		}
+		if err := s.Put(item); err != nil {
+			return nil, err
+		}
+	}
+	return orphans, nil
+}
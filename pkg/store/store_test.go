@@ -0,0 +1,123 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+type testId string
+
+type testItem struct {
+	id testId
+}
+
+func (i *testItem) Id() testId {
+	return i.id
+}
+
+var errTestNotFound = errors.New("item not found")
+
+func TestInMemStore(t *testing.T) {
+	s := NewInMemStore[testId, *testItem](errTestNotFound)
+	if err := s.Put(&testItem{}); err == nil {
+		t.Error("item without id is put")
+	}
+	for _, id := range []testId{"a", "b"} {
+		if err := s.Put(&testItem{id: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	item, err := s.Get("a")
+	if err != nil || item.id != "a" {
+		t.Errorf("Get(a) = %v, %v", item, err)
+	}
+	if _, err := s.Get("c"); !errors.Is(err, errTestNotFound) {
+		t.Errorf("Get(c) err = %v, want not found", err)
+	}
+	if err := s.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get("a"); !errors.Is(err, errTestNotFound) {
+		t.Error("deleted item is found")
+	}
+
+	var ids []string
+	for iter := s.Iter(); iter.HasNext(); {
+		ids = append(ids, string(iter.Next().id))
+	}
+	if strings.Join(ids, ",") != "b" {
+		t.Errorf("iterated %v, want [b]", ids)
+	}
+}
+
+func TestIteratorIsSnapshot(t *testing.T) {
+	s := NewInMemStore[testId, *testItem](errTestNotFound)
+	if err := s.Put(&testItem{id: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	iter := s.Iter()
+	if err := s.Put(&testItem{id: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if !iter.HasNext() || iter.Next().id != "a" {
+		t.Fatal("first item is not iterated")
+	}
+	if iter.HasNext() {
+		t.Error("item put after Iter() is iterated")
+	}
+	if next := iter.Next(); next != nil {
+		t.Errorf("Next() after the end = %v", next)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"good", "bad"} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "file"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewInMemStore[testId, *testItem](errTestNotFound)
+	var restored []string
+	orphans, err := s.Restore(dir, "item", func(id testId) *testItem {
+		return &testItem{id: id}
+	}, func(item *testItem) error {
+		restored = append(restored, string(item.id))
+		if item.id == "bad" {
+			return errors.New("broken")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(restored)
+	if strings.Join(restored, ",") != "bad,good" {
+		t.Errorf("restored %v, want only dirs", restored)
+	}
+	if len(orphans) != 1 || orphans[0].id != "bad" {
+		t.Errorf("orphans = %v, want [bad]", orphans)
+	}
+	if _, err := s.Get("good"); err != nil {
+		t.Error("restored item is not put")
+	}
+	if _, err := s.Get("bad"); err == nil {
+		t.Error("orphan is put")
+	}
+}
+
+func TestRestoreWithoutDir(t *testing.T) {
+	s := NewInMemStore[testId, *testItem](errTestNotFound)
+	orphans, err := s.Restore(filepath.Join(t.TempDir(), "none"), "item", nil, nil)
+	if err != nil || len(orphans) != 0 || s.Iter().HasNext() {
+		t.Errorf("restore of missing dir = %v, %v", orphans, err)
+	}
+}
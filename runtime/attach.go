@@ -0,0 +1,165 @@
+package runtime
+
+import (
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// The attach socket is a seqpacket socket. Each packet to the client starts
+// with the byte of the pipe the output is of. What the client writes is the
+// stdin of the container as is.
+const (
+	attachPipeStdout = 2
+	attachPipeStderr = 3
+
+	// attachBufSize is the max size of the output in a packet
+	attachBufSize = 8192
+	// attachWriteTimeout keeps the client which does not read from holding
+	// the log of the container
+	attachWriteTimeout = 5 * time.Second
+)
+
+// attachServer copies the output of the container to the clients of the
+// attach socket, and their input to the stdin of the container.
+type attachServer struct {
+	path     string
+	listener *net.UnixListener
+
+	mu    sync.Mutex
+	conns map[*net.UnixConn]struct{}
+	// closed is set once the container has exited
+	closed bool
+}
+
+// newAttachServer listens on the socket at path. Socket left by the shim
+// of the previous run is removed.
+func newAttachServer(path string) (*attachServer, error) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "cannot remove stale attach socket")
+	}
+	l, err := net.ListenUnix("unixpacket", &net.UnixAddr{Name: path, Net: "unixpacket"})
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot listen on attach socket")
+	}
+	return &attachServer{
+		path:     path,
+		listener: l,
+		conns:    make(map[*net.UnixConn]struct{}),
+	}, nil
+}
+
+// serve accepts the clients until the server is closed. Input of the
+// clients is written to the container process p.
+func (s *attachServer) serve(p *process) {
+	for {
+		conn, err := s.listener.AcceptUnix()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		go s.copyInput(conn, p)
+	}
+}
+
+// copyInput writes the input of the client to the stdin of the container
+// until the client closes its write end. The stdin is closed then if it is
+// stdin once, and the client keeps reading the output.
+func (s *attachServer) copyInput(conn *net.UnixConn, p *process) {
+	buf := make([]byte, attachBufSize)
+	for {
+		n, err := conn.Read(buf)
+		if n > 0 {
+			if err := p.writeStdin(buf[:n]); err != nil {
+				logrus.WithError(err).Warn("cannot write stdin of container")
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	if stdinOnce {
+		if err := p.closeIO(); err != nil {
+			logrus.WithError(err).Warn("cannot close stdin of container")
+		}
+	}
+}
+
+// writer returns the writer of the output of the stream to the clients. It
+// never fails so that the log is written regardless of the clients.
+func (s *attachServer) writer(stream Stream) io.Writer {
+	pipe := byte(attachPipeStdout)
+	if stream == Stderr {
+		pipe = attachPipeStderr
+	}
+	return &attachWriter{server: s, pipe: pipe}
+}
+
+type attachWriter struct {
+	server *attachServer
+	pipe   byte
+}
+
+func (w *attachWriter) Write(b []byte) (int, error) {
+	w.server.broadcast(w.pipe, b)
+	return len(b), nil
+}
+
+// broadcast sends the output to every client. Client which cannot take it
+// is disconnected.
+func (s *attachServer) broadcast(pipe byte, b []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.conns) == 0 {
+		return
+	}
+	packet := make([]byte, 0, attachBufSize+1)
+	for len(b) > 0 {
+		n := len(b)
+		if n > attachBufSize {
+			n = attachBufSize
+		}
+		packet = append(append(packet[:0], pipe), b[:n]...)
+		b = b[n:]
+		for conn := range s.conns {
+			conn.SetWriteDeadline(time.Now().Add(attachWriteTimeout))
+			if _, err := conn.Write(packet); err != nil {
+				logrus.WithError(err).Info("attach client is disconnected")
+				conn.Close()
+				delete(s.conns, conn)
+			}
+		}
+	}
+}
+
+// Close disconnects the clients and removes the socket. Closing it twice is
+// not an error.
+func (s *attachServer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	s.listener.Close()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+	if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
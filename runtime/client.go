@@ -0,0 +1,94 @@
+package runtime
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/rpc"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// Client is the RPC client of the shim of a container.
+type Client struct {
+	client *rpc.Client
+}
+
+// Dial connects to the shim of the container which has been started with
+// the run dir.
+func Dial(ctx context.Context, runDir, id string) (*Client, error) {
+	addr, err := ShimAddr(ctx, runDir, id)
+	if err != nil {
+		return nil, err
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", SocketPath(addr))
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot connect to shim")
+	}
+	return &Client{client: rpc.NewClient(conn)}, nil
+}
+
+// call calls the method of the shim. It returns once ctx is done without
+// waiting for the response.
+func (c *Client) call(ctx context.Context, method string, req, resp interface{}) error {
+	call := c.client.Go(ServiceName+"."+method, req, resp, nil)
+	select {
+	case <-call.Done:
+		return call.Error
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Client) State(ctx context.Context) (*StateResponse, error) {
+	resp := &StateResponse{}
+	if err := c.call(ctx, "State", Empty{}, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Kill sends the signal to the container init process. If all is true, the
+// signal is sent to every process in the container.
+func (c *Client) Kill(ctx context.Context, signal syscall.Signal, all bool) error {
+	return c.call(ctx, "Kill", KillRequest{Signal: int(signal), All: all}, &Empty{})
+}
+
+// Wait blocks until the container exits or ctx is done.
+func (c *Client) Wait(ctx context.Context) (*WaitResponse, error) {
+	resp := &WaitResponse{}
+	if err := c.call(ctx, "Wait", Empty{}, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) ResizePty(ctx context.Context, width, height uint16) error {
+	return c.call(ctx, "ResizePty", ResizePtyRequest{Width: width, Height: height}, &Empty{})
+}
+
+// CloseIO closes the stdin of the container.
+func (c *Client) CloseIO(ctx context.Context) error {
+	return c.call(ctx, "CloseIO", Empty{}, &Empty{})
+}
+
+// ReopenLog makes the shim reopen the log file of the container.
+func (c *Client) ReopenLog(ctx context.Context) error {
+	return c.call(ctx, "ReopenLog", Empty{}, &Empty{})
+}
+
+// Shutdown stops the shim of the exited container. The shim exiting before
+// the response is not an error.
+func (c *Client) Shutdown(ctx context.Context) error {
+	err := c.call(ctx, "Shutdown", Empty{}, &Empty{})
+	if err == rpc.ErrShutdown || err == io.ErrUnexpectedEOF {
+		return nil
+	}
+	return err
+}
+
+func (c *Client) Close() error {
+	return c.client.Close()
+}
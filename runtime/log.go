@@ -0,0 +1,258 @@
+package runtime
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Stream is the stream of the container output a log line is of.
+type Stream string
+
+const (
+	Stdout Stream = "stdout"
+	Stderr Stream = "stderr"
+)
+
+// Tags of the log line. Line longer than the max line size is split into
+// partial lines followed by the full line which ends it.
+const (
+	logTagPartial = "P"
+	logTagFull    = "F"
+)
+
+// DefaultMaxLineSize is the max size of the log line content. Longer line is
+// split.
+const DefaultMaxLineSize = 16 * 1024
+
+// SyncPolicy tells when the log file is synced to the disk.
+type SyncPolicy string
+
+const (
+	// SyncNone leaves it to the kernel
+	SyncNone SyncPolicy = "none"
+	// SyncLine syncs every line, which is the safest and the slowest
+	SyncLine SyncPolicy = "line"
+	// SyncPeriodic syncs once per logSyncPeriod if anything is written
+	SyncPeriodic SyncPolicy = "periodic"
+)
+
+const logSyncPeriod = time.Second
+
+// ParseSyncPolicy parses the policy. Empty value means SyncNone.
+func ParseSyncPolicy(value string) (SyncPolicy, error) {
+	switch p := SyncPolicy(value); p {
+	case "":
+		return SyncNone, nil
+	case SyncNone, SyncLine, SyncPeriodic:
+		return p, nil
+	}
+	return "", errors.Errorf("unknown log sync policy [%s]", value)
+}
+
+type LogOptions struct {
+	// MaxLineSize is DefaultMaxLineSize if not positive
+	MaxLineSize int
+	Sync        SyncPolicy
+	// MaxSize is the size in bytes the log file is rotated over. The shim
+	// does not rotate the log if it is not positive, which is the case of
+	// kubelet rotating it.
+	MaxSize int64
+	// MaxFiles is how many rotated files are kept as <path>.1 to
+	// <path>.<MaxFiles>, newest first. It is 1 if not positive.
+	MaxFiles int
+}
+
+// Logger writes the container output to the log file in the CRI log format:
+//
+//	<RFC3339Nano timestamp> <stdout|stderr> <P|F> <content>
+//
+// Both streams can be written at once. Lines of them are not interleaved.
+type Logger struct {
+	path string
+	opts LogOptions
+
+	mu    sync.Mutex
+	file  *os.File
+	size  int64
+	dirty bool
+	// closed is set once the log is closed. It is not reopened then.
+	closed bool
+
+	done chan struct{}
+	once sync.Once
+}
+
+func NewLogger(path string, opts LogOptions) (*Logger, error) {
+	if opts.MaxLineSize <= 0 {
+		opts.MaxLineSize = DefaultMaxLineSize
+	}
+	if opts.MaxFiles <= 0 {
+		opts.MaxFiles = 1
+	}
+	file, size, err := openLogFile(path)
+	if err != nil {
+		return nil, err
+	}
+	l := &Logger{
+		path: path,
+		opts: opts,
+		file: file,
+		size: size,
+		done: make(chan struct{}),
+	}
+	if opts.Sync == SyncPeriodic {
+		go l.syncPeriodically()
+	}
+	return l, nil
+}
+
+// openLogFile opens the log file to append, and returns its size.
+func openLogFile(path string) (*os.File, int64, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "cannot open log file")
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, errors.Wrap(err, "cannot stat log file")
+	}
+	return f, info.Size(), nil
+}
+
+// Copy writes what is read from r to the log as the stream until r ends.
+// Content after the last newline is written as the full line at the end.
+func (l *Logger) Copy(stream Stream, r io.Reader) error {
+	br := bufio.NewReaderSize(r, l.opts.MaxLineSize)
+	for {
+		line, isPrefix, err := br.ReadLine()
+		if len(line) > 0 || (err == nil && !isPrefix) {
+			tag := logTagFull
+			if isPrefix {
+				tag = logTagPartial
+			}
+			if err := l.writeLine(stream, tag, line); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "cannot read %s", stream)
+		}
+	}
+}
+
+func (l *Logger) writeLine(stream Stream, tag string, content []byte) error {
+	buf := make([]byte, 0, len(content)+64)
+	buf = time.Now().AppendFormat(buf, time.RFC3339Nano)
+	buf = append(buf, ' ')
+	buf = append(buf, stream...)
+	buf = append(buf, ' ')
+	buf = append(buf, tag...)
+	buf = append(buf, ' ')
+	buf = append(buf, content...)
+	buf = append(buf, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.opts.MaxSize > 0 && l.size > 0 && l.size+int64(len(buf)) > l.opts.MaxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.file.Write(buf)
+	l.size += int64(n)
+	if err != nil {
+		return errors.Wrap(err, "cannot write log file")
+	}
+	if l.opts.Sync == SyncLine {
+		return l.file.Sync()
+	}
+	l.dirty = true
+	return nil
+}
+
+func (l *Logger) syncPeriodically() {
+	ticker := time.NewTicker(logSyncPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			l.mu.Lock()
+			if l.dirty {
+				l.file.Sync()
+				l.dirty = false
+			}
+			l.mu.Unlock()
+		case <-l.done:
+			return
+		}
+	}
+}
+
+// Reopen closes the log file and opens the file at the path again, which is
+// new one if the file has been moved away.
+func (l *Logger) Reopen() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return errors.New("log is closed")
+	}
+	return l.reopen()
+}
+
+func (l *Logger) reopen() error {
+	if l.opts.Sync != SyncNone {
+		l.file.Sync()
+	}
+	l.file.Close()
+	file, size, err := openLogFile(l.path)
+	if err != nil {
+		return err
+	}
+	l.file = file
+	l.size = size
+	l.dirty = false
+	return nil
+}
+
+// rotate moves the log file to <path>.1 after moving the rotated files one
+// number up. The oldest one over MaxFiles is overwritten.
+func (l *Logger) rotate() error {
+	for i := l.opts.MaxFiles - 1; i >= 1; i-- {
+		err := os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "cannot rotate log file")
+		}
+	}
+	if err := os.Rename(l.path, l.path+".1"); err != nil {
+		return errors.Wrap(err, "cannot rotate log file")
+	}
+	return l.reopen()
+}
+
+// Close closes the log file. It is synced first unless the sync policy is
+// SyncNone.
+func (l *Logger) Close() error {
+	l.once.Do(func() {
+		close(l.done)
+	})
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	if l.opts.Sync != SyncNone {
+		l.file.Sync()
+	}
+	return l.file.Close()
+}
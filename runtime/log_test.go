@@ -0,0 +1,290 @@
+package runtime
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// logLine is a line of the CRI log
+type logLine struct {
+	stream  Stream
+	tag     string
+	content string
+}
+
+// readLog parses the log file, failing on the line not in the CRI format.
+func readLog(t *testing.T, path string) []logLine {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []logLine
+	for _, l := range strings.SplitAfter(string(b), "\n") {
+		if l == "" {
+			continue
+		}
+		if !strings.HasSuffix(l, "\n") {
+			t.Fatalf("log line %q does not end with newline", l)
+		}
+		fields := strings.SplitN(strings.TrimSuffix(l, "\n"), " ", 4)
+		if len(fields) != 4 {
+			t.Fatalf("malformed log line %q", l)
+		}
+		if _, err := time.Parse(time.RFC3339Nano, fields[0]); err != nil {
+			t.Errorf("malformed timestamp of %q: %v", l, err)
+		}
+		lines = append(lines, logLine{Stream(fields[1]), fields[2], fields[3]})
+	}
+	return lines
+}
+
+func TestLoggerCopy(t *testing.T) {
+	tests := []struct {
+		name        string
+		stream      Stream
+		maxLineSize int
+		input       string
+		want        []logLine
+	}{
+		{
+			name:   "lines",
+			stream: Stdout,
+			input:  "hello\nworld\n",
+			want:   []logLine{{Stdout, "F", "hello"}, {Stdout, "F", "world"}},
+		},
+		{
+			name:   "stderr",
+			stream: Stderr,
+			input:  "oops\n",
+			want:   []logLine{{Stderr, "F", "oops"}},
+		},
+		{
+			name:   "empty line",
+			stream: Stdout,
+			input:  "\n",
+			want:   []logLine{{Stdout, "F", ""}},
+		},
+		{
+			name:   "no newline at end",
+			stream: Stdout,
+			input:  "hello\nwor",
+			want:   []logLine{{Stdout, "F", "hello"}, {Stdout, "F", "wor"}},
+		},
+		{
+			name:        "long line",
+			stream:      Stdout,
+			maxLineSize: 16,
+			input:       strings.Repeat("a", 16) + strings.Repeat("b", 16) + "cc\n",
+			want: []logLine{
+				{Stdout, "P", strings.Repeat("a", 16)},
+				{Stdout, "P", strings.Repeat("b", 16)},
+				{Stdout, "F", "cc"},
+			},
+		},
+		{
+			name:        "line of max size",
+			stream:      Stdout,
+			maxLineSize: 16,
+			input:       strings.Repeat("a", 16) + "\n",
+			want:        []logLine{{Stdout, "P", strings.Repeat("a", 16)}, {Stdout, "F", ""}},
+		},
+		{
+			name:   "no output",
+			stream: Stdout,
+			input:  "",
+			want:   nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "log")
+			l, err := NewLogger(path, LogOptions{MaxLineSize: tt.maxLineSize})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := l.Copy(tt.stream, strings.NewReader(tt.input)); err != nil {
+				t.Fatal(err)
+			}
+			if err := l.Close(); err != nil {
+				t.Fatal(err)
+			}
+			got := readLog(t, path)
+			if len(got) != len(tt.want) {
+				t.Fatalf("lines = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("line %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLoggerAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	for _, content := range []string{"first", "second"} {
+		l, err := NewLogger(path, LogOptions{Sync: SyncLine})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := l.Copy(Stdout, strings.NewReader(content+"\n")); err != nil {
+			t.Fatal(err)
+		}
+		l.Close()
+	}
+	if lines := readLog(t, path); len(lines) != 2 || lines[0].content != "first" || lines[1].content != "second" {
+		t.Errorf("lines = %+v, want both runs", lines)
+	}
+}
+
+func TestParseSyncPolicy(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    SyncPolicy
+		wantErr bool
+	}{
+		{"", SyncNone, false},
+		{"none", SyncNone, false},
+		{"line", SyncLine, false},
+		{"periodic", SyncPeriodic, false},
+		{"always", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSyncPolicy(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSyncPolicy(%q) err = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseSyncPolicy(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestLoggerReopen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "log")
+	l, err := NewLogger(path, LogOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if err := l.Copy(Stdout, strings.NewReader("before\n")); err != nil {
+		t.Fatal(err)
+	}
+	// kubelet moves the log away before asking to reopen it
+	rotated := filepath.Join(dir, "log.rotated")
+	if err := os.Rename(path, rotated); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Copy(Stdout, strings.NewReader("after\n")); err != nil {
+		t.Fatal(err)
+	}
+	if lines := readLog(t, rotated); len(lines) != 1 || lines[0].content != "before" {
+		t.Errorf("rotated lines = %+v, want before", lines)
+	}
+	if lines := readLog(t, path); len(lines) != 1 || lines[0].content != "after" {
+		t.Errorf("lines = %+v, want after", lines)
+	}
+
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Reopen(); err == nil {
+		t.Error("closed log is reopened")
+	}
+}
+
+func TestLoggerRotate(t *testing.T) {
+	// every line "<timestamp> stdout F lineN\n" takes 36 to 51 bytes
+	tests := []struct {
+		name     string
+		maxSize  int64
+		maxFiles int
+		lines    int
+		// want is the content of the log and of each rotated file
+		want [][]string
+	}{
+		{
+			name:  "no rotation",
+			lines: 3,
+			want:  [][]string{{"line0", "line1", "line2"}},
+		},
+		{
+			name:     "line per file",
+			maxSize:  30,
+			maxFiles: 5,
+			lines:    3,
+			want:     [][]string{{"line2"}, {"line1"}, {"line0"}},
+		},
+		{
+			name:     "oldest is dropped",
+			maxSize:  30,
+			maxFiles: 2,
+			lines:    5,
+			want:     [][]string{{"line4"}, {"line3"}, {"line2"}},
+		},
+		{
+			name:    "one rotated file by default",
+			maxSize: 30,
+			lines:   3,
+			want:    [][]string{{"line2"}, {"line1"}},
+		},
+		{
+			// two lines take 72 to 102 bytes by the timestamp, three over 105
+			name:     "lines per file",
+			maxSize:  105,
+			maxFiles: 5,
+			lines:    5,
+			want:     [][]string{{"line4"}, {"line2", "line3"}, {"line0", "line1"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "log")
+			l, err := NewLogger(path, LogOptions{MaxSize: tt.maxSize, MaxFiles: tt.maxFiles})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < tt.lines; i++ {
+				if err := l.Copy(Stdout, strings.NewReader(fmt.Sprintf("line%d\n", i))); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := l.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			files, err := filepath.Glob(path + "*")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != len(tt.want) {
+				t.Fatalf("files = %v, want %d", files, len(tt.want))
+			}
+			for i, want := range tt.want {
+				file := path
+				if i > 0 {
+					file = fmt.Sprintf("%s.%d", path, i)
+				}
+				var got []string
+				for _, line := range readLog(t, file) {
+					got = append(got, line.content)
+				}
+				if strings.Join(got, ",") != strings.Join(want, ",") {
+					t.Errorf("%s = %v, want %v", filepath.Base(file), got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,413 @@
+package runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// reaperMu keeps the reaper from reaping the commands run by the shim, which
+// are waited for by exec. The commands hold it for reading.
+var reaperMu sync.RWMutex
+
+// process is the init process of the container which the shim creates with
+// the OCI runtime. Its output is written to the log by the shim.
+type process struct {
+	pid       int
+	createdAt time.Time
+	logger    *Logger
+	// attach copies the output to the clients of the attach socket. It is
+	// nil if the shim serves no attach socket.
+	attach *attachServer
+	// outputDone is closed once the output is all written to the log
+	outputDone chan struct{}
+	// console is the master of the terminal of the container. It is nil if
+	// the container has no terminal.
+	console *os.File
+
+	mu sync.Mutex
+	// stdin is the write end of the stdin of the container. It is nil if the
+	// stdin is not open or closed.
+	stdin *os.File
+
+	// exitCh is closed once the exit code is recorded
+	exitCh   chan struct{}
+	exitCode int
+	exitedAt time.Time
+}
+
+// createContainer creates the container by `<runtime> create`. The
+// container process keeps the pipes of its stdio, or the terminal, after
+// the runtime exits, and the shim holds the other ends. The output is
+// written to the log and to the attach clients.
+func createContainer(logger *Logger, attach *attachServer) (_ *process, retErr error) {
+	terminal, err := specTerminal()
+	if err != nil {
+		return nil, err
+	}
+	p := &process{
+		logger:     logger,
+		attach:     attach,
+		outputDone: make(chan struct{}),
+		exitCh:     make(chan struct{}),
+	}
+	cmd := runtimeCommand("create",
+		"--bundle", bundle,
+		"--pid-file", containerPidFile,
+	)
+	var (
+		outputs map[Stream]*os.File
+		socket  *consoleSocket
+		// stderr is where the error of the runtime is read from
+		stderr *os.File
+	)
+	if terminal {
+		if socket, err = newConsoleSocket(); err != nil {
+			return nil, err
+		}
+		defer socket.Close()
+		cmd.Args = append(cmd.Args, "--console-socket", socket.path)
+		var w *os.File
+		if stderr, w, err = os.Pipe(); err != nil {
+			return nil, err
+		}
+		defer stderr.Close()
+		cmd.Stderr = w
+	} else if outputs, err = p.setupPipes(cmd); err != nil {
+		return nil, err
+	} else {
+		stderr = outputs[Stderr]
+	}
+	defer func() {
+		if retErr != nil {
+			p.closeIO()
+			for _, r := range outputs {
+				r.Close()
+			}
+		}
+	}()
+	cmd.Args = append(cmd.Args, containerId)
+
+	reaperMu.RLock()
+	err = cmd.Run()
+	reaperMu.RUnlock()
+	// the ends of the container are closed not to hold the output open
+	for _, f := range []interface{}{cmd.Stdin, cmd.Stdout, cmd.Stderr} {
+		if f, ok := f.(*os.File); ok {
+			f.Close()
+		}
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s create failed, stderr=[%s]", filepath.Base(runtime), readRuntimeError(stderr))
+	}
+	if socket != nil {
+		if p.console, err = socket.receive(); err != nil {
+			return nil, err
+		}
+		outputs = map[Stream]*os.File{Stdout: p.console}
+	}
+	if p.pid, err = readPidFile(containerPidFile); err != nil {
+		return nil, err
+	}
+	p.createdAt = time.Now()
+
+	var wg sync.WaitGroup
+	for stream, r := range outputs {
+		wg.Add(1)
+		go func(stream Stream, r *os.File) {
+			defer wg.Done()
+			if r != p.console {
+				defer r.Close()
+			}
+			var src io.Reader = r
+			if attach != nil {
+				src = io.TeeReader(r, attach.writer(stream))
+			}
+			// reading the terminal fails with EIO once the container exits
+			if err := logger.Copy(stream, src); err != nil && r != p.console {
+				logrus.WithError(err).Errorf("cannot copy %s to log", stream)
+			}
+		}(stream, r)
+	}
+	go func() {
+		wg.Wait()
+		close(p.outputDone)
+	}()
+	return p, nil
+}
+
+// runtimeErrorTimeout limits how long the error of the runtime is read for.
+// Process left by the runtime may keep the pipe open.
+const runtimeErrorTimeout = time.Second
+
+// readRuntimeError returns what the runtime which has failed wrote to the
+// pipe r.
+func readRuntimeError(r *os.File) string {
+	r.SetReadDeadline(time.Now().Add(runtimeErrorTimeout))
+	b, _ := io.ReadAll(io.LimitReader(r, 4096))
+	return strings.TrimSpace(string(b))
+}
+
+// setupPipes gives the pipes to the container as its stdio, and returns the
+// read ends of the output. stdin is open only if it is asked.
+func (p *process) setupPipes(cmd *exec.Cmd) (map[Stream]*os.File, error) {
+	outputs := map[Stream]*os.File{}
+	for _, stream := range []Stream{Stdout, Stderr} {
+		r, w, err := os.Pipe()
+		if err != nil {
+			for _, r := range outputs {
+				r.Close()
+			}
+			return nil, err
+		}
+		outputs[stream] = r
+		if stream == Stdout {
+			cmd.Stdout = w
+		} else {
+			cmd.Stderr = w
+		}
+	}
+	if openStdin {
+		r, w, err := os.Pipe()
+		if err != nil {
+			for _, r := range outputs {
+				r.Close()
+			}
+			return nil, err
+		}
+		cmd.Stdin = r
+		p.stdin = w
+	}
+	return outputs, nil
+}
+
+// consoleSocket is where the OCI runtime sends the terminal of the
+// container to. It is in a temp dir of its own as the path of unix socket
+// is limited in length.
+type consoleSocket struct {
+	path     string
+	listener *net.UnixListener
+}
+
+func newConsoleSocket() (*consoleSocket, error) {
+	dir, err := ioutil.TempDir("", "zcm-console-")
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create console socket dir")
+	}
+	path := filepath.Join(dir, "console.sock")
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, errors.Wrap(err, "cannot listen on console socket")
+	}
+	return &consoleSocket{path: path, listener: l}, nil
+}
+
+// receive returns the terminal sent by the OCI runtime.
+func (s *consoleSocket) receive() (*os.File, error) {
+	conn, err := s.listener.AcceptUnix()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot accept console socket")
+	}
+	defer conn.Close()
+	return receiveFile(conn)
+}
+
+func (s *consoleSocket) Close() error {
+	s.listener.Close()
+	return os.RemoveAll(filepath.Dir(s.path))
+}
+
+// specTerminal tells whether the container process has a terminal.
+func specTerminal() (bool, error) {
+	b, err := ioutil.ReadFile(filepath.Join(bundle, "config.json"))
+	if err != nil {
+		return false, errors.Wrap(err, "cannot read OCI runtime spec file")
+	}
+	spec := &specs.Spec{}
+	if err := json.Unmarshal(b, spec); err != nil {
+		return false, errors.Wrap(err, "cannot decode OCI runtime spec file")
+	}
+	return spec.Process != nil && spec.Process.Terminal, nil
+}
+
+// ociState is the output of `<runtime> state`
+type ociState struct {
+	Status string `json:"status"`
+}
+
+// state returns the status of the container reported by the OCI runtime.
+// The container the shim has reaped is stopped.
+func (p *process) state() (string, error) {
+	if p.hasExited() {
+		return "stopped", nil
+	}
+	b, err := runCommand(runtimeCommand("state", containerId))
+	if err != nil {
+		return "", err
+	}
+	state := &ociState{}
+	if err := json.Unmarshal(b, state); err != nil {
+		return "", errors.Wrap(err, "cannot decode state of OCI runtime")
+	}
+	return state.Status, nil
+}
+
+func (p *process) kill(signal syscall.Signal, all bool) error {
+	cmd := runtimeCommand("kill")
+	if all {
+		cmd.Args = append(cmd.Args, "--all")
+	}
+	cmd.Args = append(cmd.Args, containerId, strconv.Itoa(int(signal)))
+	_, err := runCommand(cmd)
+	return err
+}
+
+// closeIO closes the stdin of the container. Closing it twice is not an
+// error.
+func (p *process) closeIO() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stdin == nil {
+		return nil
+	}
+	err := p.stdin.Close()
+	p.stdin = nil
+	return err
+}
+
+// writeStdin writes the input to the stdin of the container, which is the
+// terminal if it has one. Input is dropped unless the stdin is open.
+func (p *process) writeStdin(b []byte) error {
+	if !openStdin {
+		return nil
+	}
+	if p.console != nil {
+		_, err := p.console.Write(b)
+		return err
+	}
+	p.mu.Lock()
+	stdin := p.stdin
+	p.mu.Unlock()
+	if stdin == nil {
+		return nil
+	}
+	_, err := stdin.Write(b)
+	return err
+}
+
+func (p *process) resize(width, height uint16) error {
+	if p.console == nil {
+		return errors.New("container has no terminal")
+	}
+	return resizeConsole(p.console, width, height)
+}
+
+// outputDrainTimeout limits how long the output is waited for after the
+// container exits. Processes left in the container may keep the pipes open.
+const outputDrainTimeout = 2 * time.Second
+
+// exited records the exit code once the output is all written, and closes
+// the log.
+func (p *process) exited(code int) error {
+	select {
+	case <-p.outputDone:
+	case <-time.After(outputDrainTimeout):
+		logrus.Warn("output of container is not closed, stop writing log")
+	}
+	if err := p.logger.Close(); err != nil {
+		logrus.WithError(err).Warn("cannot close log")
+	}
+	if p.attach != nil {
+		if err := p.attach.Close(); err != nil {
+			logrus.WithError(err).Warn("cannot close attach socket")
+		}
+	}
+	p.closeIO()
+	if p.console != nil {
+		p.console.Close()
+	}
+
+	p.mu.Lock()
+	p.exitCode = code
+	p.exitedAt = time.Now()
+	p.mu.Unlock()
+	// the exit file is there for the ones waiting for the exit
+	err := writeFileAtomic(containerExitFile, []byte(strconv.Itoa(code)))
+	close(p.exitCh)
+	return err
+}
+
+func (p *process) hasExited() bool {
+	select {
+	case <-p.exitCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// exitStatus returns the exit code and the time of the exited container.
+func (p *process) exitStatus() (int, time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.exitCode, p.exitedAt
+}
+
+// runtimeCommand returns the OCI runtime command with the global options,
+// so that every command sees the containers in the same state dir.
+func runtimeCommand(args ...string) *exec.Cmd {
+	globalArgs := []string{}
+	if runtimeRoot != "" {
+		globalArgs = append(globalArgs, "--root", runtimeRoot)
+	}
+	if systemdCgroup {
+		globalArgs = append(globalArgs, "--systemd-cgroup")
+	}
+	return exec.Command(runtime, append(globalArgs, args...)...)
+}
+
+// runCommand runs the OCI runtime command, and returns its stdout.
+func runCommand(cmd *exec.Cmd) ([]byte, error) {
+	reaperMu.RLock()
+	defer reaperMu.RUnlock()
+	output, err := cmd.Output()
+	if ee, ok := err.(*exec.ExitError); ok {
+		err = errors.Wrapf(err, "stderr=[%s]", strings.TrimSpace(string(ee.Stderr)))
+	}
+	return output, err
+}
+
+func readPidFile(path string) (int, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, errors.Wrap(err, "cannot read pid file")
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return 0, errors.Wrapf(err, "malformed pid file [%s]", string(b))
+	}
+	return pid, nil
+}
+
+func writeFileAtomic(path string, b []byte) error {
+	tmp := filepath.Join(filepath.Dir(path), fmt.Sprintf(".%s", filepath.Base(path)))
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,105 @@
+package runtime
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// fakeRuntime sets up the script as the OCI runtime, which records its args
+// in the returned file line by line. `create` writes the pid file, and
+// `state` reports the container running.
+func fakeRuntime(t *testing.T, root string, systemd bool) string {
+	t.Helper()
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "args")
+	script := "#!/bin/sh\n" +
+		"echo \"$@\" >> " + argsFile + "\n" +
+		"while [ $# -gt 0 ]; do\n" +
+		"\tcase \"$1\" in\n" +
+		"\t--pid-file) echo $$ > \"$2\"; shift;;\n" +
+		"\tstate) echo '{\"status\": \"running\"}';;\n" +
+		"\tesac\n" +
+		"\tshift\n" +
+		"done\n"
+	if err := os.WriteFile(filepath.Join(dir, "runc"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	bundleDir := filepath.Join(dir, "bundle")
+	if err := os.Mkdir(bundleDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(bundleDir, "config.json"), []byte(`{"process": {}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	saved := []string{runtime, runtimeRoot, bundle, containerId, containerPidFile}
+	savedSystemd := systemdCgroup
+	t.Cleanup(func() {
+		runtime, runtimeRoot, bundle, containerId, containerPidFile = saved[0], saved[1], saved[2], saved[3], saved[4]
+		systemdCgroup = savedSystemd
+	})
+	runtime = filepath.Join(dir, "runc")
+	runtimeRoot = root
+	systemdCgroup = systemd
+	bundle = bundleDir
+	containerId = "c1"
+	containerPidFile = filepath.Join(dir, "container.pid")
+	return argsFile
+}
+
+func TestRuntimeGlobalOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		root    string
+		systemd bool
+		want    string
+	}{
+		{"default root", "", false, ""},
+		{"root", "/run/zcm/runc", false, "--root /run/zcm/runc "},
+		{"root and systemd cgroup", "/run/zcm/runc", true, "--root /run/zcm/runc --systemd-cgroup "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			argsFile := fakeRuntime(t, tt.root, tt.systemd)
+			logger, err := NewLogger(filepath.Join(t.TempDir(), "log"), LogOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer logger.Close()
+
+			p, err := createContainer(logger, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			<-p.outputDone
+			status, err := p.state()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status != "running" {
+				t.Errorf("status = %s, want running", status)
+			}
+			if err := p.kill(syscall.SIGTERM, true); err != nil {
+				t.Fatal(err)
+			}
+
+			b, err := os.ReadFile(argsFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			calls := strings.Split(strings.TrimSpace(string(b)), "\n")
+			commands := []string{"create", "state", "kill"}
+			if len(calls) != len(commands) {
+				t.Fatalf("runtime calls = %q", calls)
+			}
+			for i, call := range calls {
+				if !strings.HasPrefix(call, tt.want+commands[i]+" ") {
+					t.Errorf("call %q does not start with %q", call, tt.want+commands[i])
+				}
+			}
+		})
+	}
+}
@@ -2,8 +2,6 @@ package runc
 
 import (
 	"context"
-	"fmt"
-	"io/ioutil"
 	"os"
 	"os/exec"
 	"simpleconman/runtime"
@@ -12,8 +10,23 @@ import (
 	"github.com/pkg/errors"
 )
 
+// New returns the bootstrapper of the shim which runs the container with
+// runc.
+func New() runtime.Bootstrapper {
+	return bootstrapper{}
+}
+
+type bootstrapper struct{}
+
+func (bootstrapper) Bootstrap() runtime.Shim {
+	return &service{}
+}
+
 type service struct{}
 
+// Start starts the shim daemon in a process group of its own, so that it
+// outlives the manager, and waits until the daemon has created the
+// container.
 func (s *service) Start(ctx context.Context, id string) (_ string, retErr error) {
 	self, err := os.Executable()
 	if err != nil {
@@ -23,14 +36,12 @@ func (s *service) Start(ctx context.Context, id string) (_ string, retErr error)
 	if err != nil {
 		return "", err
 	}
-	// TODO: fill the args to run the shim daemon
-	args := []string{}
-	cmd := exec.Command(self, args...)
+	cmd := exec.Command(self, runtime.DaemonArgs()...)
 	cmd.Dir = cwd
 	cmd.SysProcAttr = &syscall.SysProcAttr{
 		Setpgid: true,
 	}
-	addr, err := runtime.SocketAddr(ctx, "zcm", id)
+	addr, err := runtime.ShimAddr(ctx, runtime.RunDir(), id)
 	if err != nil {
 		return "", err
 	}
@@ -60,27 +71,37 @@ func (s *service) Start(ctx context.Context, id string) (_ string, retErr error)
 	if err != nil {
 		return "", err
 	}
+	defer f.Close()
+	syncRead, syncWrite, err := os.Pipe()
+	if err != nil {
+		return "", err
+	}
+	defer syncRead.Close()
 
-	cmd.ExtraFiles = append(cmd.ExtraFiles, f)
+	// fd 3 is the socket and fd 4 is the sync pipe of the daemon
+	cmd.ExtraFiles = append(cmd.ExtraFiles, f, syncWrite)
 
-	if err := cmd.Start(); err != nil {
-		f.Close()
+	err = cmd.Start()
+	// only the daemon holds the write end, so reading ends if it exits
+	syncWrite.Close()
+	if err != nil {
 		return "", err
 	}
+	waitCh := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(waitCh)
+	}()
+	// the daemon which has failed is gone once the error is returned
 	defer func() {
 		if retErr != nil {
 			cmd.Process.Kill()
+			<-waitCh
 		}
 	}()
 
-	go cmd.Wait()
-
-	data, err := ioutil.ReadAll(os.Stdin)
-	if err != nil {
-		return addr, nil
+	if _, err := runtime.WaitCreated(syncRead); err != nil {
+		return "", err
 	}
-
-	// TODO: parse data with runc options.Options then do something
-	fmt.Println("data", data)
 	return addr, nil
 }
@@ -2,6 +2,7 @@ package runtime
 
 import (
 	"context"
+	"errors"
 	"net"
 	"net/rpc"
 	"os"
@@ -11,6 +12,7 @@ import (
 
 type server struct {
 	sigChan chan os.Signal
+	process *process
 }
 
 func (s *server) serve(ctx context.Context) error {
@@ -22,11 +24,26 @@ func (s *server) serve(ctx context.Context) error {
 	}
 	logrus.WithField("socket", path).Info("serving api on socket")
 
-	// for now, it is empty service rpc server
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	rpcServer := rpc.NewServer()
+	svc := &service{
+		process:  s.process,
+		shutdown: cancel,
+	}
+	if err := rpcServer.RegisterName(ServiceName, svc); err != nil {
+		l.Close()
+		return err
+	}
 	go func() {
 		defer l.Close()
-		rpc.Accept(l)
+		rpcServer.Accept(l)
 	}()
 
-	return handleSignals(ctx, s.sigChan)
+	err = handleSignals(ctx, s.sigChan, s.process)
+	if errors.Is(err, context.Canceled) {
+		logrus.Info("shim is shut down")
+		return nil
+	}
+	return err
 }
@@ -0,0 +1,102 @@
+package runtime
+
+import (
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ServiceName is the name of the RPC service of the shim.
+const ServiceName = "Shim"
+
+// Empty is the request and the response of the calls which have nothing to
+// pass.
+type Empty struct{}
+
+type StateResponse struct {
+	Pid int
+	// Status is the one reported by the OCI runtime such as "created" and
+	// "running". It is "stopped" once the shim has reaped the container.
+	Status    string
+	CreatedAt time.Time
+	// ExitCode and ExitedAt are set if the container is stopped
+	ExitCode int
+	ExitedAt time.Time
+}
+
+type KillRequest struct {
+	Signal int
+	// All sends the signal to every process in the container
+	All bool
+}
+
+type WaitResponse struct {
+	ExitCode int
+	ExitedAt time.Time
+}
+
+type ResizePtyRequest struct {
+	Width  uint16
+	Height uint16
+}
+
+// service is the RPC service of the shim for the container it runs.
+type service struct {
+	process *process
+	// shutdown stops the shim
+	shutdown func()
+}
+
+func (s *service) State(_ Empty, resp *StateResponse) error {
+	status, err := s.process.state()
+	if err != nil {
+		return err
+	}
+	*resp = StateResponse{
+		Pid:       s.process.pid,
+		Status:    status,
+		CreatedAt: s.process.createdAt,
+	}
+	if s.process.hasExited() {
+		resp.ExitCode, resp.ExitedAt = s.process.exitStatus()
+	}
+	return nil
+}
+
+func (s *service) Kill(req KillRequest, _ *Empty) error {
+	return s.process.kill(syscall.Signal(req.Signal), req.All)
+}
+
+// Wait blocks until the container exits.
+func (s *service) Wait(_ Empty, resp *WaitResponse) error {
+	<-s.process.exitCh
+	resp.ExitCode, resp.ExitedAt = s.process.exitStatus()
+	return nil
+}
+
+// ResizePty resizes the terminal of the container.
+func (s *service) ResizePty(req ResizePtyRequest, _ *Empty) error {
+	return s.process.resize(req.Width, req.Height)
+}
+
+// CloseIO closes the stdin of the container, which reads EOF then.
+func (s *service) CloseIO(_ Empty, _ *Empty) error {
+	return s.process.closeIO()
+}
+
+// ReopenLog closes and reopens the log file of the container, which has
+// been rotated by others.
+func (s *service) ReopenLog(_ Empty, _ *Empty) error {
+	return s.process.logger.Reopen()
+}
+
+// Shutdown stops the shim once the container has exited. The shim may exit
+// before the response is sent.
+func (s *service) Shutdown(_ Empty, _ *Empty) error {
+	if !s.process.hasExited() {
+		return errors.New("container is still running")
+	}
+	s.shutdown()
+	return nil
+}
@@ -3,7 +3,12 @@ package runtime
 import (
 	"context"
 	"flag"
+	"fmt"
 	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 )
 
 type Shim interface {
@@ -15,34 +20,76 @@ type Bootstrapper interface {
 }
 
 var (
-	shimPidFile string
-	runtime     string
-	bundle      string
-	action      string
+	shimPidFile   string
+	runtime       string
+	runtimeRoot   string
+	runDir        string
+	systemdCgroup bool
+	bundle        string
+	action        string
 
 	containerId       string
 	containerPidFile  string
 	containerLogFile  string
 	containerExitFile string
+	attachFile        string
+	openStdin         bool
+	stdinOnce         bool
+
+	logMaxLineSize int
+	logSync        string
+	logMaxSize     int64
+	logMaxFiles    int
 )
 
 func parseFlags() {
-	flag.StringVar(&shimPidFile, "shim-pid", "", "path to file which contains shim pid")
+	flag.StringVar(&shimPidFile, "shim-pid", "", "path to file the shim daemon writes its pid to")
 	flag.StringVar(&runtime, "runtime", "", "path to runtime binary")
+	flag.StringVar(&runtimeRoot, "runtime-root", "", "path to state dir of runtime, default of runtime if empty")
+	flag.BoolVar(&systemdCgroup, "systemd-cgroup", false, "make runtime manage cgroups via systemd")
+	flag.StringVar(&runDir, "run-dir", "/run/zcm", "path to run dir of manager, which the RPC socket is in")
 	flag.StringVar(&bundle, "bundle", "", "path to bundle")
 	flag.StringVar(&action, "action", "", "action for shim")
 	flag.StringVar(&containerId, "id", "", "container id")
 	flag.StringVar(&containerPidFile, "pid-file", "", "path to container pid file")
 	flag.StringVar(&containerLogFile, "log-file", "", "path to container log file")
 	flag.StringVar(&containerExitFile, "exit-file", "", "path to container exit file")
+	flag.StringVar(&attachFile, "attach-file", "", "path to attach socket of container, none if empty")
+	flag.BoolVar(&openStdin, "stdin", false, "open stdin of container")
+	flag.BoolVar(&stdinOnce, "stdin-once", false, "close stdin of container once the first attach client closes it")
+	flag.IntVar(&logMaxLineSize, "log-max-line-size", DefaultMaxLineSize, "max size of container log line, longer line is split")
+	flag.StringVar(&logSync, "log-sync", string(SyncNone), "when container log is synced to disk, none, line or periodic")
+	flag.Int64Var(&logMaxSize, "log-max-size", 0, "size in bytes container log is rotated over, 0 not to rotate")
+	flag.IntVar(&logMaxFiles, "log-max-files", 5, "number of rotated container log files to keep")
+	flag.Parse()
+}
+
+// DaemonArgs returns the flags the shim is run with but the action, which
+// run the shim daemon of the container.
+func DaemonArgs() []string {
+	args := []string{}
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name != "action" {
+			args = append(args, fmt.Sprintf("--%s=%s", f.Name, f.Value.String()))
+		}
+	})
+	return args
 }
 
+// Run runs the shim. The error is written to stderr, which the manager
+// reports as the error of the container creation.
 func Run(bootstrapper Bootstrapper) {
 	if err := run(bootstrapper); err != nil {
-		// TODO: write error to stderr
+		fmt.Fprintf(os.Stderr, "shim of container [%s]: %s\n", containerId, err)
+		os.Exit(1)
 	}
 }
 
+// RunDir returns the run dir of the manager the shim is started with.
+func RunDir() string {
+	return runDir
+}
+
 func run(bootstrapper Bootstrapper) error {
 	parseFlags()
 
@@ -55,8 +102,10 @@ func run(bootstrapper Bootstrapper) error {
 	}
 
 	switch action {
-	// "start" runs runtime to create container and create unix socket. That address is
-	// returned from shim.Start(). Then shim starts itself again with no action args.
+	// "start" starts the shim again with no action as the daemon, which
+	// creates the container and serves RPC on the unix socket. The address
+	// of the socket is returned from shim.Start() once the container is
+	// created.
 	case "start":
 		addr, err := shim.Start(ctx, containerId)
 		if err != nil {
@@ -68,16 +117,77 @@ func run(bootstrapper Bootstrapper) error {
 		return nil
 	}
 
-	// set self as subreaper
+	process, err := startContainer()
+	if err := reportCreated(processPid(process), err); err != nil {
+		logrus.WithError(err).Warn("cannot report creation of container")
+	}
+	if err != nil {
+		return err
+	}
 
 	// serve rpc server and waits for container with pid killed by SIGCHLD sig
 	server := &server{
 		sigChan: sigChan,
+		process: process,
 	}
-	if err := server.serve(ctx); err != nil {
-		return err
+	err = server.serve(ctx)
+	if addr, addrErr := ShimAddr(ctx, runDir, containerId); addrErr == nil {
+		RemoveSocket(addr)
+	}
+	return err
+}
+
+// startContainer creates the container whose output is written to the log
+// and to the attach socket.
+func startContainer() (*process, error) {
+	// the manager kills the shim by the pid if it cannot shut it down
+	if shimPidFile != "" {
+		if err := writeFileAtomic(shimPidFile, []byte(strconv.Itoa(os.Getpid()))); err != nil {
+			return nil, errors.Wrap(err, "cannot write shim pid file")
+		}
+	}
+	// set self as subreaper
+	if err := setSubreaper(); err != nil {
+		return nil, err
+	}
+
+	syncPolicy, err := ParseSyncPolicy(logSync)
+	if err != nil {
+		return nil, err
+	}
+	logger, err := NewLogger(containerLogFile, LogOptions{
+		MaxLineSize: logMaxLineSize,
+		Sync:        syncPolicy,
+		MaxSize:     logMaxSize,
+		MaxFiles:    logMaxFiles,
+	})
+	if err != nil {
+		return nil, err
 	}
+	var attach *attachServer
+	if attachFile != "" {
+		if attach, err = newAttachServer(attachFile); err != nil {
+			logger.Close()
+			return nil, err
+		}
+	}
+	process, err := createContainer(logger, attach)
+	if err != nil {
+		logger.Close()
+		if attach != nil {
+			attach.Close()
+		}
+		return nil, err
+	}
+	if attach != nil {
+		go attach.serve(process)
+	}
+	return process, nil
+}
 
-	// TODO: clean up
-	return nil
+func processPid(p *process) int {
+	if p == nil {
+		return 0
+	}
+	return p.pid
 }
@@ -4,15 +4,16 @@ package runtime
 
 import (
 	"context"
+	"net"
 	"os"
 	"os/signal"
 
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sys/unix"
 )
 
-// setupSignals creates a new signal handler for all signals and sets the shim as a
-// sub-reaper so that the container processes are reparented
+// setupSignals creates a new signal handler for all signals the shim handles
 func setupSignals() (chan os.Signal, error) {
 	sigChan := make(chan os.Signal, 32)
 	signals := []os.Signal{unix.SIGTERM, unix.SIGINT, unix.SIGPIPE, unix.SIGCHLD}
@@ -20,7 +21,15 @@ func setupSignals() (chan os.Signal, error) {
 	return sigChan, nil
 }
 
-func handleSignals(ctx context.Context, sigChan chan os.Signal) error {
+// setSubreaper sets the shim as a sub-reaper so that the container processes
+// are reparented to it
+func setSubreaper() error {
+	return unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, 1, 0, 0, 0)
+}
+
+// handleSignals reaps the children, and records the exit of the container
+// process, until ctx is done.
+func handleSignals(ctx context.Context, sigChan chan os.Signal, p *process) error {
 	logrus.Info("starting signal loop")
 
 	for {
@@ -30,9 +39,77 @@ func handleSignals(ctx context.Context, sigChan chan os.Signal) error {
 		case s := <-sigChan:
 			switch s {
 			case unix.SIGCHLD:
-				// TODO: reap child
+				code, exited := reap(p.pid)
+				if exited {
+					logrus.WithField("code", code).Info("container exited")
+					if err := p.exited(code); err != nil {
+						logrus.WithError(err).Error("cannot record exit of container")
+					}
+				}
 			case unix.SIGPIPE:
 			}
 		}
 	}
 }
+
+// reap waits for the exited children. It returns the exit code of pid if
+// it is one of them. Killed process exits with 128 + signal.
+func reap(pid int) (int, bool) {
+	reaperMu.Lock()
+	defer reaperMu.Unlock()
+
+	var (
+		code   int
+		exited bool
+	)
+	for {
+		var status unix.WaitStatus
+		child, err := unix.Wait4(-1, &status, unix.WNOHANG, nil)
+		if err != nil || child <= 0 {
+			return code, exited
+		}
+		if child != pid {
+			continue
+		}
+		exited = true
+		code = status.ExitStatus()
+		if status.Signaled() {
+			code = 128 + int(status.Signal())
+		}
+	}
+}
+
+// receiveFile receives the file sent over the connection as SCM_RIGHTS.
+func receiveFile(conn *net.UnixConn) (*os.File, error) {
+	name := make([]byte, 4096)
+	oob := make([]byte, unix.CmsgSpace(4))
+	n, oobn, _, _, err := conn.ReadMsgUnix(name, oob)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot receive file")
+	}
+	msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parse control message")
+	}
+	if len(msgs) != 1 {
+		return nil, errors.Errorf("expected 1 control message, got %d", len(msgs))
+	}
+	fds, err := unix.ParseUnixRights(&msgs[0])
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parse unix rights")
+	}
+	if len(fds) != 1 {
+		for _, fd := range fds {
+			unix.Close(fd)
+		}
+		return nil, errors.Errorf("expected 1 file, got %d", len(fds))
+	}
+	return os.NewFile(uintptr(fds[0]), string(name[:n])), nil
+}
+
+func resizeConsole(console *os.File, width, height uint16) error {
+	return unix.IoctlSetWinsize(int(console.Fd()), unix.TIOCSWINSZ, &unix.Winsize{
+		Row: height,
+		Col: width,
+	})
+}
@@ -4,6 +4,8 @@ package runtime
 
 import (
 	"context"
+	"errors"
+	"net"
 	"os"
 )
 
@@ -11,6 +13,18 @@ func setupSignals() (chan os.Signal, error) {
 	return nil, nil
 }
 
-func handleSignals(ctx context.Context, sigChan chan os.Signal) error {
+func setSubreaper() error {
 	return nil
 }
+
+func handleSignals(ctx context.Context, sigChan chan os.Signal, p *process) error {
+	return nil
+}
+
+func receiveFile(conn *net.UnixConn) (*os.File, error) {
+	return nil, errors.New("not supported")
+}
+
+func resizeConsole(console *os.File, width, height uint16) error {
+	return errors.New("not supported")
+}
@@ -23,11 +23,21 @@ func SocketPath(addr string) string {
 	return socket(addr).path()
 }
 
-const socketRoot = "/run/zcm"
+// SocketAddr returns the address of the socket of the id in the dir "s" of
+// the run dir. The id is hashed as the path of unix socket is limited in
+// length.
+func SocketAddr(ctx context.Context, runDir, id string) (string, error) {
+	if runDir == "" {
+		return "", errors.New("run dir of socket is not specified")
+	}
+	d := sha256.Sum256([]byte(id))
+	return fmt.Sprintf("unix://%s/%x", filepath.Join(runDir, "s"), d), nil
+}
 
-func SocketAddr(ctx context.Context, socketPath, id string) (string, error) {
-	d := sha256.Sum256([]byte(filepath.Join(socketPath, id)))
-	return fmt.Sprintf("unix://%s/%x", filepath.Join(socketRoot, "s"), d), nil
+// ShimAddr returns the address of the RPC socket of the shim of the
+// container in the run dir of the manager.
+func ShimAddr(ctx context.Context, runDir, id string) (string, error) {
+	return SocketAddr(ctx, runDir, id)
 }
 
 func NewSocket(addr string) (*net.UnixListener, error) {
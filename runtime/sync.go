@@ -0,0 +1,44 @@
+package runtime
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// syncFd is the pipe the shim daemon reports on once it has created the
+// container. fd 3 is the RPC socket.
+const syncFd = 4
+
+// createResult is what the shim daemon reports on the sync pipe.
+type createResult struct {
+	Pid   int    `json:"pid,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// reportCreated tells the shim which has started the daemon whether the
+// container is created.
+func reportCreated(pid int, createErr error) error {
+	f := os.NewFile(syncFd, "sync")
+	defer f.Close()
+	result := createResult{Pid: pid}
+	if createErr != nil {
+		result.Error = createErr.Error()
+	}
+	return json.NewEncoder(f).Encode(result)
+}
+
+// WaitCreated waits until the shim daemon reports on the sync pipe, and
+// returns the pid of the container it has created.
+func WaitCreated(r io.Reader) (int, error) {
+	result := createResult{}
+	if err := json.NewDecoder(r).Decode(&result); err != nil {
+		return 0, errors.Wrap(err, "shim exited before creating container")
+	}
+	if result.Error != "" {
+		return 0, errors.New(result.Error)
+	}
+	return result.Pid, nil
+}